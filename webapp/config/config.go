@@ -3,12 +3,14 @@ package config
 
 import (
 	"context"
+	"crypto/rand"
 	"io"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
 	"runtime"
+	"time"
 )
 
 type key int
@@ -25,7 +27,100 @@ const (
 	//CERT : TLS CERT FILE
 	CERT = "cert.pem"
 	//LOG : Logging file
-	LOG              = "log.txt"
+	LOG = "log.txt"
+	//DATA : file users, venues, bookings and sessions are stored in
+	DATA = "data.db"
+	//JOURNAL : directory of the journal and snapshot when STORE is "journal"
+	JOURNAL = "journal"
+	//STORE : how data is kept, "bolt" for the DATA file,
+	//"journal" for an in memory model journaled to JOURNAL, or "memory"
+	STORE = "journal"
+	//SnapshotEvery : how often the journal is folded into a snapshot
+	SnapshotEvery = 10 * time.Minute
+	//ShutdownTimeout : how long requests in flight may take to finish on shutdown
+	ShutdownTimeout = 30 * time.Second
+	//AccessTokenTTL : how long an api access token is accepted
+	AccessTokenTTL = 15 * time.Minute
+	//RefreshTokenTTL : how long an api refresh token can be swapped for new tokens
+	RefreshTokenTTL = 30 * 24 * time.Hour
+	//SessionMaxAge : how long a browser login lasts however much it is used
+	SessionMaxAge = 24 * time.Hour
+	//SessionIdle : how long a browser login lasts without a request
+	SessionIdle = 2 * time.Hour
+	//SessionSweepEvery : how often expired logins are deleted
+	SessionSweepEvery = 10 * time.Minute
+	//PasswordMinLength : shortest password allowed
+	PasswordMinLength = 8
+	//PasswordMaxLength : longest password allowed, bcrypt ignores more than 72 bytes
+	PasswordMaxLength = 72
+	//PasswordMixedCase : passwords need upper and lower case letters
+	PasswordMixedCase = true
+	//PasswordDigit : passwords need a digit
+	PasswordDigit = true
+	//PasswordSymbol : passwords need a symbol
+	PasswordSymbol = false
+	//BcryptCost : cost passwords are hashed with, older hashes of a lower
+	//cost are replaced when their user next logs in
+	BcryptCost = 12
+	//LockoutThreshold : failed logins in a row that lock an account
+	LockoutThreshold = 5
+	//LockoutDuration : how long a locked account cannot log in
+	LockoutDuration = 15 * time.Minute
+	//LoginRateEvery : each ip may try a login or signup this often
+	LoginRateEvery = 6 * time.Second
+	//LoginBurst : tries an ip may make at once before LoginRateEvery applies
+	LoginBurst = 10
+	//SITE : address of the site, for links in emails
+	SITE = "https://localhost" + PORT
+	//SECRET : file of the key emailed links are signed with, made on first run
+	SECRET = "secret.key"
+	//ResetLinkTTL : how long a password reset link works
+	ResetLinkTTL = time.Hour
+	//VerifyLinkTTL : how long an email verification link works
+	VerifyLinkTTL = 48 * time.Hour
+	//MAILER : how email is sent, "smtp" through SMTPHost,
+	//"file" appended to MAIL, or "stdout" for local development
+	MAILER = "stdout"
+	//MAIL : file emails are written to when MAILER is "file"
+	MAIL = "mail.txt"
+	//MailFrom : sender of every email
+	MailFrom = "Venue booking <noreply@localhost>"
+	//SMTPHost : smtp server, its login is read from
+	//SMTP_USER and SMTP_PASSWORD in the environment
+	SMTPHost = "localhost"
+	//SMTPPort : smtp server port
+	SMTPPort = 587
+	//WEBHOOK : url booking notifications are also posted to as json, "" for none
+	WEBHOOK = ""
+	//WebhookTimeout : how long a webhook post may take
+	WebhookTimeout = 10 * time.Second
+	//ReminderLead : how long before a booking starts its reminder is sent
+	ReminderLead = 24 * time.Hour
+	//NotifyEvery : how often notifications that are due are looked for
+	NotifyEvery = 30 * time.Second
+	//NotifyRetryBase : wait after a notification first fails to go out,
+	//it doubles with each failure up to NotifyRetryMax
+	NotifyRetryBase = time.Minute
+	//NotifyRetryMax : longest wait between tries of a notification
+	NotifyRetryMax = time.Hour
+	//NotifyAttempts : tries before a notification is given up on
+	NotifyAttempts = 20
+	//UPLOADS : directory venue photos and floor plans are kept in
+	UPLOADS = "uploads"
+	//UploadMaxBytes : largest photo or floor plan that can be uploaded
+	UploadMaxBytes = 10 << 20
+	//RequestMaxBytes : largest form that is read, uploads included
+	RequestMaxBytes = 32 << 20
+	//MultipartMemory : bytes of a form kept in memory, uploads past it go to temporary files
+	MultipartMemory = 1 << 20
+	//MediaPerVenue : most photos and floor plans a venue can have
+	MediaPerVenue = 20
+	//MaxImagePixels : largest photo in pixels, larger ones take too much memory to decode
+	MaxImagePixels = 40000000
+	//ThumbSize : longest side of photo thumbnails, in pixels
+	ThumbSize = 320
+	//ICalRefresh : how often calendar apps are asked to fetch feeds again
+	ICalRefresh      = time.Hour
 	requestIDKey key = 0
 )
 
@@ -38,6 +133,16 @@ var (
 	KeyPath = Root + "/" + KEY
 	//CertPath : TLS CERT PATH
 	CertPath = Root + "/" + CERT
+	//DataPath : DATA FILE PATH
+	DataPath = Root + "/" + DATA
+	//JournalPath : JOURNAL DIRECTORY PATH
+	JournalPath = Root + "/" + JOURNAL
+	//SecretPath : SECRET FILE PATH
+	SecretPath = Root + "/" + SECRET
+	//MailPath : MAIL FILE PATH
+	MailPath = Root + "/" + MAIL
+	//UploadsPath : UPLOADS DIRECTORY PATH
+	UploadsPath = Root + "/" + UPLOADS
 )
 
 //Logging :
@@ -99,3 +204,20 @@ func Tracing(nextRequestID func() string) func(http.Handler) http.Handler {
 		})
 	}
 }
+
+//LoadSecret : key kept in the file at path, a new random one is
+//written there if the file does not exist yet
+func LoadSecret(path string) ([]byte, error) {
+	key, err := os.ReadFile(path)
+	if err == nil {
+		return key, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+	key = make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, os.WriteFile(path, key, 0600)
+}
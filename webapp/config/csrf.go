@@ -0,0 +1,97 @@
+package config
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"net/http"
+)
+
+const (
+	//NCSRF : Name of csrf cookie
+	NCSRF = "vbscsrf"
+	//CSRFField : form field forms send the csrf token back in
+	CSRFField = "csrf"
+	//CSRFHeader : header scripts send the csrf token back in
+	CSRFHeader = "X-CSRF-Token"
+
+	csrfKey key = 1
+)
+
+// newCSRFToken : random url safe token
+func newCSRFToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// safeMethod : true for methods that must not change anything
+func safeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+//CSRFToken : csrf token of the request set by CSRF, for forms to send back
+func CSRFToken(r *http.Request) string {
+	token, _ := r.Context().Value(csrfKey).(string)
+	return token
+}
+
+//CSRF : closure for http handler to refuse cross site requests with a
+//double submitted token. The token is kept in a cookie other sites cannot
+//read, and every request that is not a GET must send it back in the
+//CSRFField form field or the CSRFHeader header. Forms are parsed here,
+//uploads included, and refused past RequestMaxBytes. Requests exempt
+//returns true for are let through unchecked
+func CSRF(exempt func(r *http.Request) bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var token string
+			if c, err := r.Cookie(NCSRF); err == nil && c.Value != "" {
+				token = c.Value
+			} else {
+				var err error
+				if token, err = newCSRFToken(); err != nil {
+					http.Error(w, "Internal server error", http.StatusInternalServerError)
+					return
+				}
+				http.SetCookie(w, &http.Cookie{
+					Name:     NCSRF,
+					Value:    token,
+					Path:     "/",
+					Secure:   true,
+					HttpOnly: true,
+					SameSite: http.SameSiteLaxMode,
+				})
+			}
+			if !safeMethod(r.Method) && !exempt(r) {
+				sent := r.Header.Get(CSRFHeader)
+				if sent == "" {
+					// the body is capped before it is read for the token,
+					// so an upload cannot fill the disk before it is checked
+					r.Body = http.MaxBytesReader(w, r.Body, RequestMaxBytes)
+					var tooBig *http.MaxBytesError
+					if err := r.ParseMultipartForm(MultipartMemory); errors.As(err, &tooBig) {
+						http.Error(w, "Request too large", http.StatusRequestEntityTooLarge)
+						return
+					}
+					sent = r.PostFormValue(CSRFField)
+				}
+				// a new cookie was never sent, so nothing can match it
+				c, err := r.Cookie(NCSRF)
+				if err != nil || c.Value == "" || subtle.ConstantTimeCompare([]byte(sent), []byte(c.Value)) != 1 {
+					http.Error(w, "Forbidden: invalid CSRF token", http.StatusForbidden)
+					return
+				}
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), csrfKey, token)))
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package config
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestCSRF(t *testing.T) {
+	const token = "cookie-token"
+	exempt := func(r *http.Request) bool {
+		return r.Header.Get("Authorization") != ""
+	}
+	handler := CSRF(exempt)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	tests := []struct {
+		name   string
+		method string
+		cookie string // empty for no cookie
+		field  string // sent in the form
+		header string // sent in CSRFHeader
+		auth   bool
+		want   int
+	}{
+		{"get without a cookie", http.MethodGet, "", "", "", false, http.StatusNoContent},
+		{"get ignores a wrong token", http.MethodGet, token, "wrong", "", false, http.StatusNoContent},
+		{"post with the token in the form", http.MethodPost, token, token, "", false, http.StatusNoContent},
+		{"post with the token in the header", http.MethodPost, token, "", token, false, http.StatusNoContent},
+		{"post without the token", http.MethodPost, token, "", "", false, http.StatusForbidden},
+		{"post with a wrong token", http.MethodPost, token, "wrong", "", false, http.StatusForbidden},
+		{"post with a token but no cookie", http.MethodPost, "", token, "", false, http.StatusForbidden},
+		{"post with an empty cookie and token", http.MethodPost, "", "", "", false, http.StatusForbidden},
+		{"delete with a wrong header", http.MethodDelete, token, "", "wrong", false, http.StatusForbidden},
+		{"exempt post", http.MethodPost, "", "", "", true, http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		form := url.Values{}
+		if tt.field != "" {
+			form.Set(CSRFField, tt.field)
+		}
+		req := httptest.NewRequest(tt.method, "/", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if tt.cookie != "" {
+			req.AddCookie(&http.Cookie{Name: NCSRF, Value: tt.cookie})
+		}
+		if tt.header != "" {
+			req.Header.Set(CSRFHeader, tt.header)
+		}
+		if tt.auth {
+			req.Header.Set("Authorization", "Bearer x")
+		}
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+		if res.Code != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, res.Code, tt.want)
+		}
+	}
+}
+
+func TestCSRFToken(t *testing.T) {
+	var seen string
+	handler := CSRF(func(*http.Request) bool { return false })(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = CSRFToken(r)
+	}))
+	// a first visit is given a token in a new cookie
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/", nil))
+	cookies := res.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != NCSRF || cookies[0].Value == "" || cookies[0].Value != seen {
+		t.Fatalf("first visit set cookies %v with token %q", cookies, seen)
+	}
+	if !cookies[0].HttpOnly || !cookies[0].Secure {
+		t.Fatalf("csrf cookie readable by scripts or sent in clear, %v", cookies[0])
+	}
+	// later visits keep it
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(cookies[0])
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	if len(res.Result().Cookies()) != 0 || seen != cookies[0].Value {
+		t.Fatalf("second visit set cookies %v with token %q, want %q kept", res.Result().Cookies(), seen, cookies[0].Value)
+	}
+}
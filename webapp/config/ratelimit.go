@@ -0,0 +1,100 @@
+package config
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// bucket : tokens left for one client, as of last
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter : token bucket per client ip. Each bucket holds up to burst
+// tokens, gains one every interval, and each request takes one
+type Limiter struct {
+	mu      sync.Mutex
+	every   time.Duration
+	burst   int
+	buckets map[string]*bucket
+	pruned  time.Time
+}
+
+//NewLimiter : limiter allowing burst requests at once and one more every interval
+func NewLimiter(every time.Duration, burst int) *Limiter {
+	return &Limiter{
+		every:   every,
+		burst:   burst,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+//Allow : take a token for key at now. If there is none, false and how
+//long until there is
+func (l *Limiter) Allow(key string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.prune(now)
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.burst), last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(l.burst), b.tokens+float64(now.Sub(b.last))/float64(l.every))
+	b.last = now
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) * float64(l.every))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// prune : forget buckets that have filled up again, at most once per
+// time a bucket takes to fill
+func (l *Limiter) prune(now time.Time) {
+	full := l.every * time.Duration(l.burst)
+	if now.Sub(l.pruned) < full {
+		return
+	}
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= full {
+			delete(l.buckets, key)
+		}
+	}
+	l.pruned = now
+}
+
+// clientIP : ip of the connection, headers are not trusted
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+//Limit : closure for http handler to refuse posts from an ip beyond the
+//limit with 429, pages can still be viewed
+func (l *Limiter) Limit(logger *Logging) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				next.ServeHTTP(w, r)
+				return
+			}
+			ip := clientIP(r)
+			if ok, wait := l.Allow(ip, time.Now()); !ok {
+				logger.Warning.Println("Rate limited ", r.URL.Path, " from ", ip, " ", r.UserAgent())
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				http.Error(w, "Too many requests, try again later", http.StatusTooManyRequests)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package config
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	l := NewLimiter(10*time.Second, 2)
+	start := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	steps := []struct {
+		name string
+		key  string
+		at   time.Duration
+		ok   bool
+		wait time.Duration
+	}{
+		{"first of the burst", "a", 0, true, 0},
+		{"second of the burst", "a", 0, true, 0},
+		{"burst used up", "a", 0, false, 10 * time.Second},
+		{"other clients have their own", "b", 0, true, 0},
+		{"part of a token back", "a", 5 * time.Second, false, 5 * time.Second},
+		{"a token back", "a", 10 * time.Second, true, 0},
+		{"used again", "a", 10 * time.Second, false, 10 * time.Second},
+		{"refills only up to the burst", "a", time.Hour, true, 0},
+		{"second after the refill", "a", time.Hour, true, 0},
+		{"third after the refill", "a", time.Hour, false, 10 * time.Second},
+	}
+	for _, tt := range steps {
+		ok, wait := l.Allow(tt.key, start.Add(tt.at))
+		if ok != tt.ok || wait != tt.wait {
+			t.Errorf("%s: allowed %t, wait %v, want %t, %v", tt.name, ok, wait, tt.ok, tt.wait)
+		}
+	}
+	// full buckets are forgotten rather than kept for every ip ever seen
+	if _, kept := l.buckets["b"]; kept {
+		t.Errorf("bucket of b kept after it filled up")
+	}
+}
+
+func TestLimit(t *testing.T) {
+	discard := log.New(io.Discard, "", 0)
+	logger := &Logging{Trace: discard, Info: discard, Warning: discard, Error: discard}
+	handler := NewLimiter(time.Minute, 1).Limit(logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	requests := []struct {
+		name   string
+		method string
+		addr   string
+		want   int
+	}{
+		{"post within the limit", http.MethodPost, "10.0.0.1:1000", http.StatusNoContent},
+		{"post over it", http.MethodPost, "10.0.0.1:1001", http.StatusTooManyRequests},
+		{"pages are still shown", http.MethodGet, "10.0.0.1:1002", http.StatusNoContent},
+		{"other ip", http.MethodPost, "10.0.0.2:1000", http.StatusNoContent},
+	}
+	for _, tt := range requests {
+		req := httptest.NewRequest(tt.method, "/login", nil)
+		req.RemoteAddr = tt.addr
+		// a client cannot pick its own ip
+		req.Header.Set("X-Forwarded-For", "10.0.0.9")
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+		if res.Code != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, res.Code, tt.want)
+		}
+		if res.Code == http.StatusTooManyRequests && res.Header().Get("Retry-After") != "60" {
+			t.Errorf("%s: Retry-After %q, want 60", tt.name, res.Header().Get("Retry-After"))
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package controller
+
+import (
+	"errors"
+	config "gia/config"
+	mail "gia/mail"
+	model "gia/model"
+	"net/http"
+	netmail "net/mail"
+	"net/url"
+)
+
+var errEmail = errors.New("A valid email address is required")
+
+// parseEmail : bare address of s, "Name <a@b.c>" gives "a@b.c"
+func parseEmail(s string) (string, error) {
+	addr, err := netmail.ParseAddress(s)
+	if err != nil {
+		return "", errEmail
+	}
+	return addr.Address, nil
+}
+
+// sendMail : send m, logging rather than failing the request
+// if it cannot be sent
+func (a *Ctl) sendMail(m mail.Message) {
+	if err := a.Mailer.Send(m); err != nil {
+		a.Logging.Error.Println("Sending \"", m.Subject, "\" to ", m.To, ", ", err)
+		return
+	}
+	a.Logging.Info.Println("Sent \"", m.Subject, "\" to ", m.To)
+}
+
+// sendVerification : email u a link to verify their email with
+func (a *Ctl) sendVerification(u User) {
+	if u.Email == "" || u.Verified {
+		return
+	}
+	token, err := a.Signer.VerifyLink(u, config.VerifyLinkTTL)
+	if err != nil {
+		a.Logging.Error.Println("Signing verification link of ", u.Username, ", ", err)
+		return
+	}
+	a.sendMail(mail.Message{
+		To:      u.Email,
+		Subject: "Verify your email",
+		Body: "Hi " + u.First + ",\n\n" +
+			"Please verify the email of your venue booking account " + u.Username + " by opening\n\n" +
+			config.SITE + "/verify?token=" + url.QueryEscape(token) + "\n\n" +
+			"The link works for " + config.VerifyLinkTTL.String() + ".\n",
+	})
+}
+
+// accountPage : what the account pages show
+type accountPage struct {
+	Page
+	User    User
+	Token   string
+	Message string
+	Error   string
+}
+
+// Verify : email verification link
+func (a *Ctl) Verify(res http.ResponseWriter, req *http.Request) {
+	d := accountPage{
+		User: a.getUser(res, req),
+	}
+	u, err := a.Model.UserDB.VerifyEmail(a.Signer, req.URL.Query().Get("token"))
+	if err != nil {
+		a.Logging.Warning.Println("Email verification failed, ", err, " from ", req.UserAgent())
+		d.Error = model.ErrLinkInvalid.Error()
+		res.WriteHeader(http.StatusBadRequest)
+		a.render(res, req, "verify.html", &d)
+		return
+	}
+	a.Logging.Info.Println("Email of ", u.Username, " verified from ", req.UserAgent())
+	d.Message = "Your email " + u.Email + " is verified."
+	a.render(res, req, "verify.html", &d)
+}
+
+// ResendVerification : send the logged in user another verification link
+func (a *Ctl) ResendVerification(res http.ResponseWriter, req *http.Request) {
+	u := a.getUser(res, req)
+	if !a.alreadyLoggedIn(req) {
+		http.Redirect(res, req, "/login", http.StatusSeeOther)
+		return
+	}
+	if req.Method == http.MethodPost {
+		a.sendVerification(u)
+	}
+	http.Redirect(res, req, "/profile", http.StatusSeeOther)
+}
+
+// Forgot : ask for a password reset link. The answer is the same whether
+// or not the email is known, so it cannot be used to find accounts
+func (a *Ctl) Forgot(res http.ResponseWriter, req *http.Request) {
+	d := accountPage{
+		User: a.getUser(res, req),
+	}
+	if req.Method == http.MethodPost {
+		email, err := parseEmail(req.FormValue("email"))
+		if err != nil {
+			d.Error = err.Error()
+			res.WriteHeader(http.StatusBadRequest)
+			a.render(res, req, "forgot.html", &d)
+			return
+		}
+		users, err := a.Model.UserDB.ByEmail(email)
+		if err != nil {
+			a.Logging.Error.Println("Finding users by email, ", err, " from ", req.UserAgent())
+		}
+		for _, u := range users {
+			// an unverified email may belong to someone else
+			if !u.Verified {
+				continue
+			}
+			a.sendReset(u)
+		}
+		a.Logging.Info.Println("Password reset requested from ", req.UserAgent())
+		d.Message = "If a verified account uses " + email + ", a link to reset its password has been sent there."
+	}
+	a.render(res, req, "forgot.html", &d)
+}
+
+// sendReset : email u a link to reset their password with
+func (a *Ctl) sendReset(u User) {
+	token, err := a.Signer.ResetLink(u, config.ResetLinkTTL)
+	if err != nil {
+		a.Logging.Error.Println("Signing reset link of ", u.Username, ", ", err)
+		return
+	}
+	a.sendMail(mail.Message{
+		To:      u.Email,
+		Subject: "Reset your password",
+		Body: "Hi " + u.First + ",\n\n" +
+			"To choose a new password for your venue booking account " + u.Username + ", open\n\n" +
+			config.SITE + "/reset?token=" + url.QueryEscape(token) + "\n\n" +
+			"The link works once, for " + config.ResetLinkTTL.String() + ". " +
+			"If you did not ask for it, you can ignore this email.\n",
+	})
+}
+
+// Reset : choose a new password with a reset link. Every session of the
+// user is ended, whoever knew the old password is logged out
+func (a *Ctl) Reset(res http.ResponseWriter, req *http.Request) {
+	d := accountPage{
+		User:  a.getUser(res, req),
+		Token: req.FormValue("token"),
+	}
+	fail := func(status int, err error) {
+		a.Logging.Warning.Println("Password reset failed, ", err, " from ", req.UserAgent())
+		d.Error = err.Error()
+		res.WriteHeader(status)
+		a.render(res, req, "reset.html", &d)
+	}
+	u, err := a.Model.UserDB.ResetUser(a.Signer, d.Token)
+	if err != nil {
+		// without a good link there is no form to show
+		d.Token = ""
+		fail(http.StatusBadRequest, err)
+		return
+	}
+	username := u.Username
+	if req.Method == http.MethodPost {
+		password := req.FormValue("password")
+		if err := PasswordPolicy.Check(username, password); err != nil {
+			fail(http.StatusBadRequest, err)
+			return
+		}
+		hash, err := hashPassword(password)
+		if err != nil {
+			a.Logging.Error.Println("Hashing password, ", err)
+			http.Error(res, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if _, err := a.Model.UserDB.ResetPassword(a.Signer, d.Token, hash); err != nil {
+			d.Token = ""
+			fail(http.StatusBadRequest, err)
+			return
+		}
+		if _, err := a.Model.UserDB.DeleteSessions(username); err != nil {
+			a.Logging.Error.Println("Deleting sessions of ", username, ", ", err)
+		}
+		if _, err := a.Model.UserDB.RevokeTokens(username); err != nil {
+			a.Logging.Error.Println("Revoking tokens of ", username, ", ", err)
+		}
+		clearCookie(res)
+		a.Logging.Info.Println("Password of ", username, " reset from ", req.UserAgent())
+		d = accountPage{Message: "Your password has been changed, you can now log in with it."}
+	}
+	a.render(res, req, "reset.html", &d)
+}
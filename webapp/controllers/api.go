@@ -0,0 +1,520 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	model "gia/model"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// APIPrefix : path the versioned JSON api is served under
+const APIPrefix = "/api/v1/"
+
+// apiVenue : venue as sent by the api
+type apiVenue struct {
+	ID        int                `json:"id"`
+	Name      string             `json:"name"`
+	Kind      string             `json:"kind"`
+	Location  string             `json:"location"`
+	Capacity  int                `json:"capacity"`
+	Desc      string             `json:"desc"`
+	Window    int                `json:"window"`             // days ahead bookable
+	DayParts  []string           `json:"dayParts"`           // "Name HH:MM-HH:MM"
+	Amenities []string           `json:"amenities"`          // keys of the amenities it has
+	Tags      []string           `json:"tags"`               // lower case
+	Attrs     map[string]float64 `json:"attrs"`              // value of each attribute it has
+	Archived  bool               `json:"archived,omitempty"` // closed to new bookings
+	Free      []apiSlot          `json:"free,omitempty"`     // slots free between from and to
+}
+
+// apiSlot : slot with its availability, slot is the key to book it with
+type apiSlot struct {
+	Slot   int64     `json:"slot"`
+	Part   string    `json:"part"`
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+	Status string    `json:"status"`
+}
+
+// apiDay : slots of one day
+type apiDay struct {
+	Date  string    `json:"date"`
+	Slots []apiSlot `json:"slots"`
+}
+
+// apiInterval : free time range
+type apiInterval struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// apiAvailability : what can be booked at a venue
+type apiAvailability struct {
+	VenueID   int           `json:"venueId"`
+	WindowEnd time.Time     `json:"windowEnd"`
+	Days      []apiDay      `json:"days"`
+	Free      []apiInterval `json:"free"`
+}
+
+// apiBooking : booking as sent by the api
+type apiBooking struct {
+	ID        int       `json:"id"`
+	User      string    `json:"user"`
+	VenueID   int       `json:"venueId"`
+	VenueName string    `json:"venueName"`
+	Part      string    `json:"part"`
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+}
+
+// apiBookingRequest : book either a day part slot by its key,
+// or a custom range from/to
+type apiBookingRequest struct {
+	VenueID int       `json:"venueId"`
+	Slot    int64     `json:"slot"`
+	From    time.Time `json:"from"`
+	To      time.Time `json:"to"`
+}
+
+// apiProfile : user as sent by the api, without the password
+type apiProfile struct {
+	Username string `json:"username"`
+	First    string `json:"first"`
+	Last     string `json:"last"`
+	Email    string `json:"email"`
+	Verified bool   `json:"verified"`
+	VIP      bool   `json:"vip"`
+	Bookings []int  `json:"bookings"`
+}
+
+// apiProfileRequest : profile fields that can be changed
+type apiProfileRequest struct {
+	First *string `json:"first"`
+	Last  *string `json:"last"`
+}
+
+// apiErrorBody : body of every error response
+type apiErrorBody struct {
+	Error string `json:"error"`
+}
+
+var (
+	errUnauthorised     = errors.New("login required")
+	errForbidden        = errors.New("forbidden")
+	errNotFound         = errors.New("not found")
+	errMethodNotAllowed = errors.New("method not allowed")
+	errBadRequest       = errors.New("invalid request body")
+)
+
+func writeJSON(res http.ResponseWriter, status int, v interface{}) {
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(status)
+	json.NewEncoder(res).Encode(v)
+}
+
+func writeError(res http.ResponseWriter, status int, err error) {
+	writeJSON(res, status, apiErrorBody{Error: err.Error()})
+}
+
+func toAPIVenue(id int, v model.Venue, rdt *model.ReserveDT) apiVenue {
+	av := apiVenue{
+		ID:        id,
+		Name:      v.Name,
+		Kind:      v.Kind,
+		Location:  v.Location,
+		Capacity:  v.Capacity,
+		Desc:      v.Desc,
+		Amenities: make([]string, 0, len(v.Amenities)),
+		Tags:      make([]string, 0, len(v.Tags)),
+		Attrs:     make(map[string]float64, len(v.Attrs)),
+		Archived:  v.Archived,
+	}
+	av.Amenities = append(av.Amenities, v.Amenities...)
+	av.Tags = append(av.Tags, v.Tags...)
+	for k, n := range v.Attrs {
+		av.Attrs[k] = n
+	}
+	if rdt != nil {
+		av.Window = rdt.Window()
+		for _, p := range rdt.Parts() {
+			av.DayParts = append(av.DayParts, p.String())
+		}
+	}
+	return av
+}
+
+func toAPIBooking(b model.Booking, mapping map[int]string) apiBooking {
+	return apiBooking{
+		ID:        b.IDBook,
+		User:      b.User,
+		VenueID:   b.VenueID,
+		VenueName: mapping[b.VenueID],
+		Part:      b.Slot.Name,
+		Start:     b.Slot.Start,
+		End:       b.Slot.End,
+	}
+}
+
+func toAPIProfile(u User) apiProfile {
+	bookings := u.Bookings
+	if bookings == nil {
+		bookings = []int{}
+	}
+	return apiProfile{
+		Username: u.Username,
+		First:    u.First,
+		Last:     u.Last,
+		Email:    u.Email,
+		Verified: u.Verified,
+		VIP:      u.VIP,
+		Bookings: bookings,
+	}
+}
+
+// apiUser : user the request was authenticated as, see Auth
+func (a *Ctl) apiUser(req *http.Request) (User, bool) {
+	username, ok := requestUser(req)
+	if !ok {
+		return User{}, false
+	}
+	return a.user(username)
+}
+
+// API : handler of the json api, to be mounted at APIPrefix
+//
+//	POST   auth/login                 apiLoginRequest, returns apiTokens
+//	POST   auth/refresh               apiTokenRequest, returns apiTokens
+//	POST   auth/revoke                apiTokenRequest
+//	GET    venues                     filter by kind, location, capMin, capMax
+//	GET    venues/{id}
+//	GET    venues/{id}/availability   optional from, to in RFC 3339
+//	GET    bookings                   bookings of the logged in user
+//	POST   bookings                   apiBookingRequest
+//	GET    bookings/{id}
+//	DELETE bookings/{id}
+//	GET    profile
+//	PATCH  profile                    apiProfileRequest
+func (a *Ctl) API() http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		path := strings.Trim(strings.TrimPrefix(req.URL.Path, APIPrefix), "/")
+		parts := strings.Split(path, "/")
+		switch {
+		case path == "auth/login":
+			a.apiLogin(res, req)
+		case path == "auth/refresh":
+			a.apiRefresh(res, req)
+		case path == "auth/revoke":
+			a.apiRevoke(res, req)
+		case path == "venues":
+			a.apiVenues(res, req)
+		case parts[0] == "venues" && len(parts) == 2:
+			a.apiVenue(res, req, parts[1])
+		case parts[0] == "venues" && len(parts) == 3 && parts[2] == "availability":
+			a.apiAvailability(res, req, parts[1])
+		case path == "bookings":
+			a.apiBookings(res, req)
+		case parts[0] == "bookings" && len(parts) == 2:
+			a.apiBooking(res, req, parts[1])
+		case path == "profile":
+			a.apiProfile(res, req)
+		default:
+			writeError(res, http.StatusNotFound, errNotFound)
+		}
+	})
+}
+
+// allow : true if req uses one of methods, otherwise a 405 is written
+func allow(res http.ResponseWriter, req *http.Request, methods ...string) bool {
+	for _, m := range methods {
+		if req.Method == m {
+			return true
+		}
+	}
+	res.Header().Set("Allow", strings.Join(methods, ", "))
+	writeError(res, http.StatusMethodNotAllowed, errMethodNotAllowed)
+	return false
+}
+
+// apiVenues : venues matching the query, all by default. With q they
+// are the ones matching its words, most relevant first. With from or to
+// only venues with slots free between them are listed, along with the slots.
+// amenity and tag may be repeated, venues need all of them unless match is
+// any. areaMin, priceMax and so on bound the numeric attributes
+func (a *Ctl) apiVenues(res http.ResponseWriter, req *http.Request) {
+	if !allow(res, req, http.MethodGet) {
+		return
+	}
+	q := req.URL.Query()
+	min, max := a.Model.VenueDB.Caps()
+	query := model.Query{
+		Location: "Nil",
+		Kind:     "Nil",
+		CapMin:   min,
+		CapMax:   max,
+	}
+	if s := q.Get("location"); s != "" {
+		query.Location = s
+	}
+	if s := q.Get("kind"); s != "" {
+		query.Kind = s
+	}
+	query.Text = q.Get("q")
+	var err1, err2 error
+	if s := q.Get("capMin"); s != "" {
+		query.CapMin, err1 = strconv.Atoi(s)
+	}
+	if s := q.Get("capMax"); s != "" {
+		query.CapMax, err2 = strconv.Atoi(s)
+	}
+	if err1 != nil || err2 != nil {
+		writeError(res, http.StatusBadRequest, errors.New("capMin and capMax must be integers"))
+		return
+	}
+	if s := q.Get("from"); s != "" {
+		query.DateMin, err1 = time.Parse(time.RFC3339, s)
+	}
+	if s := q.Get("to"); s != "" {
+		query.DateMax, err2 = time.Parse(time.RFC3339, s)
+	}
+	if err1 != nil || err2 != nil {
+		writeError(res, http.StatusBadRequest, errors.New("from and to must be RFC 3339 times"))
+		return
+	}
+	query.Amenities = q["amenity"]
+	query.Tags = q["tag"]
+	query.AnyOf = q.Get("match") == "any"
+	for _, at := range model.Attributes {
+		lo, hasLo := bound(q.Get(at.Key+"Min"), math.Inf(-1))
+		hi, hasHi := bound(q.Get(at.Key+"Max"), math.Inf(1))
+		if (q.Get(at.Key+"Min") != "" && !hasLo) || (q.Get(at.Key+"Max") != "" && !hasHi) {
+			writeError(res, http.StatusBadRequest, errors.New(at.Key+"Min and "+at.Key+"Max must be numbers"))
+			return
+		}
+		if hasLo || hasHi {
+			if query.Attrs == nil {
+				query.Attrs = make(map[string]model.Range)
+			}
+			query.Attrs[at.Key] = model.Range{Min: lo, Max: hi}
+		}
+	}
+	matches := a.Model.Search(query)
+	if query.Text == "" {
+		sort.Slice(matches, func(i, j int) bool { return matches[i].ID < matches[j].ID })
+	}
+	list := make([]apiVenue, 0, len(matches))
+	for _, m := range matches {
+		rdt, _ := a.Model.BookingDB.Venue(m.ID)
+		av := toAPIVenue(m.ID, m.Venue, rdt)
+		for _, slot := range m.Free {
+			av.Free = append(av.Free, apiSlot{
+				Slot:   slot.Key(),
+				Part:   slot.Name,
+				Start:  slot.Start,
+				End:    slot.End,
+				Status: "AVAILABLE",
+			})
+		}
+		list = append(list, av)
+	}
+	writeJSON(res, http.StatusOK, list)
+}
+
+// venueParam : venue id from the path, with its reservations
+func (a *Ctl) venueParam(res http.ResponseWriter, s string) (int, *model.ReserveDT, bool) {
+	id, err := strconv.Atoi(s)
+	rdt, exists := a.Model.BookingDB.Venue(id)
+	if err != nil || !exists {
+		writeError(res, http.StatusNotFound, model.ErrVenueNotFound)
+		return 0, nil, false
+	}
+	return id, rdt, true
+}
+
+func (a *Ctl) apiVenue(res http.ResponseWriter, req *http.Request, s string) {
+	if !allow(res, req, http.MethodGet) {
+		return
+	}
+	id, rdt, ok := a.venueParam(res, s)
+	if !ok {
+		return
+	}
+	v, _ := a.Model.VenueDB.Get(id)
+	writeJSON(res, http.StatusOK, toAPIVenue(id, v, rdt))
+}
+
+// apiAvailability : slots and free ranges of a venue, from now to the
+// end of its booking window unless from/to are given
+func (a *Ctl) apiAvailability(res http.ResponseWriter, req *http.Request, s string) {
+	if !allow(res, req, http.MethodGet) {
+		return
+	}
+	id, rdt, ok := a.venueParam(res, s)
+	if !ok {
+		return
+	}
+	from := time.Now().Truncate(time.Minute)
+	to := rdt.WindowEnd()
+	q := req.URL.Query()
+	var err1, err2 error
+	if v := q.Get("from"); v != "" {
+		from, err1 = time.Parse(time.RFC3339, v)
+	}
+	if v := q.Get("to"); v != "" {
+		to, err2 = time.Parse(time.RFC3339, v)
+	}
+	if err1 != nil || err2 != nil || !to.After(from) {
+		writeError(res, http.StatusBadRequest, errors.New("from and to must be RFC 3339 times, from before to"))
+		return
+	}
+	avail := apiAvailability{
+		VenueID:   id,
+		WindowEnd: rdt.WindowEnd(),
+		Days:      make([]apiDay, 0),
+		Free:      make([]apiInterval, 0),
+	}
+	for _, day := range rdt.GetDate(from, to) {
+		d := apiDay{
+			Date:  day.Date.Format("2006-01-02"),
+			Slots: make([]apiSlot, 0, len(day.Slots)),
+		}
+		for _, slot := range day.Slots {
+			if slot.Status == "" {
+				continue
+			}
+			d.Slots = append(d.Slots, apiSlot{
+				Slot:   slot.Key(),
+				Part:   slot.Name,
+				Start:  slot.Start,
+				End:    slot.End,
+				Status: slot.Status,
+			})
+		}
+		avail.Days = append(avail.Days, d)
+	}
+	for _, iv := range a.Model.BookingDB.FreeIntervals(id, from, to) {
+		avail.Free = append(avail.Free, apiInterval{Start: iv.Start, End: iv.End})
+	}
+	writeJSON(res, http.StatusOK, avail)
+}
+
+// apiBookings : list or create bookings of the logged in user
+func (a *Ctl) apiBookings(res http.ResponseWriter, req *http.Request) {
+	if !allow(res, req, http.MethodGet, http.MethodPost) {
+		return
+	}
+	u, ok := a.apiUser(req)
+	if !ok {
+		writeError(res, http.StatusUnauthorized, errUnauthorised)
+		return
+	}
+	mapping := a.Model.VenueDB.Names()
+	if req.Method == http.MethodGet {
+		list := make([]apiBooking, 0, len(u.Bookings))
+		for _, id := range u.Bookings {
+			if b, exists := a.Model.BookingDB.Get(id); exists {
+				list = append(list, toAPIBooking(*b, mapping))
+			}
+		}
+		writeJSON(res, http.StatusOK, list)
+		return
+	}
+	if !u.Can(model.PermBook) {
+		writeError(res, http.StatusForbidden, errForbidden)
+		return
+	}
+	var r apiBookingRequest
+	if err := json.NewDecoder(req.Body).Decode(&r); err != nil {
+		writeError(res, http.StatusBadRequest, errBadRequest)
+		return
+	}
+	rdt, exists := a.Model.BookingDB.Venue(r.VenueID)
+	if !exists {
+		writeError(res, http.StatusNotFound, model.ErrVenueNotFound)
+		return
+	}
+	var slot model.Slot
+	if r.Slot != 0 {
+		var err error
+		if slot, err = slotAt(rdt, r.Slot); err != nil {
+			writeError(res, bookingStatus(err), err)
+			return
+		}
+	} else {
+		slot = model.CustomSlot(model.Interval{Start: r.From, End: r.To})
+	}
+	id, err := a.book(u.Username, r.VenueID, slot)
+	if err != nil {
+		a.Logging.Warning.Println("Booking rejected, ", err, " from ", req.UserAgent())
+		writeError(res, bookingStatus(err), err)
+		return
+	}
+	a.Logging.Info.Println("Booking confirmed from ", req.UserAgent())
+	b, _ := a.Model.BookingDB.Get(id)
+	res.Header().Set("Location", APIPrefix+"bookings/"+strconv.Itoa(id))
+	writeJSON(res, http.StatusCreated, toAPIBooking(*b, mapping))
+}
+
+// apiBooking : get or cancel one booking of the logged in user
+func (a *Ctl) apiBooking(res http.ResponseWriter, req *http.Request, s string) {
+	if !allow(res, req, http.MethodGet, http.MethodDelete) {
+		return
+	}
+	u, ok := a.apiUser(req)
+	if !ok {
+		writeError(res, http.StatusUnauthorized, errUnauthorised)
+		return
+	}
+	id, err := strconv.Atoi(s)
+	b, exists := a.Model.BookingDB.Get(id)
+	// bookings the user may not cancel are not found rather than forbidden
+	if err != nil || !exists || !a.canCancel(u, b) {
+		writeError(res, http.StatusNotFound, errNotFound)
+		return
+	}
+	if req.Method == http.MethodGet {
+		writeJSON(res, http.StatusOK, toAPIBooking(*b, a.Model.VenueDB.Names()))
+		return
+	}
+	if err := a.cancelBooking(b.User, id); err != nil {
+		a.Logging.Error.Println("Cancelling booking ", id, ", ", err, " from ", req.UserAgent())
+		writeError(res, http.StatusInternalServerError, errors.New("internal server error"))
+		return
+	}
+	a.Logging.Info.Println("Booking cancelled from ", req.UserAgent())
+	res.WriteHeader(http.StatusNoContent)
+}
+
+// apiProfile : get or edit the logged in user
+func (a *Ctl) apiProfile(res http.ResponseWriter, req *http.Request) {
+	if !allow(res, req, http.MethodGet, http.MethodPatch) {
+		return
+	}
+	u, ok := a.apiUser(req)
+	if !ok {
+		writeError(res, http.StatusUnauthorized, errUnauthorised)
+		return
+	}
+	if req.Method == http.MethodGet {
+		writeJSON(res, http.StatusOK, toAPIProfile(u))
+		return
+	}
+	var r apiProfileRequest
+	if err := json.NewDecoder(req.Body).Decode(&r); err != nil {
+		writeError(res, http.StatusBadRequest, errBadRequest)
+		return
+	}
+	u, ok = a.updateUser(u.Username, func(u *User) {
+		u.SetName(r.First, r.Last)
+	})
+	if !ok {
+		writeError(res, http.StatusInternalServerError, errors.New("internal server error"))
+		return
+	}
+	a.Logging.Info.Println("Profile edited from ", req.UserAgent())
+	writeJSON(res, http.StatusOK, toAPIProfile(u))
+}
@@ -0,0 +1,160 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	model "gia/model"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAPI(t *testing.T) {
+	a := newTestCtl(t)
+	ann := loginAs(t, a, "ann")
+	bob := loginAs(t, a, "bob")
+	rdt, _ := a.Model.BookingDB.Venue(1)
+	slot := rdt.ReadAvailable()[len(rdt.Parts())]
+	booking := fmt.Sprintf(`{"venueId":1,"slot":%d}`, slot.Key())
+	api := a.Auth()(a.API())
+	// in order, each against what the ones before it did
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		cookie *http.Cookie
+		want   int
+	}{
+		{"venues", http.MethodGet, "venues", "", nil, http.StatusOK},
+		{"venue", http.MethodGet, "venues/1", "", nil, http.StatusOK},
+		{"no such venue", http.MethodGet, "venues/9", "", nil, http.StatusNotFound},
+		{"venues free between", http.MethodGet, "venues?from=2030-01-01T08:00:00Z&to=2030-01-01T12:00:00Z", "", nil, http.StatusOK},
+		{"from not a time", http.MethodGet, "venues?from=tomorrow", "", nil, http.StatusBadRequest},
+		{"availability", http.MethodGet, "venues/1/availability", "", nil, http.StatusOK},
+		{"no such path", http.MethodGet, "nothing", "", nil, http.StatusNotFound},
+		{"venues are read only", http.MethodDelete, "venues", "", nil, http.StatusMethodNotAllowed},
+		{"bookings need a login", http.MethodGet, "bookings", "", nil, http.StatusUnauthorized},
+		{"book", http.MethodPost, "bookings", booking, ann, http.StatusCreated},
+		{"book it again", http.MethodPost, "bookings", booking, bob, http.StatusConflict},
+		{"book another venue", http.MethodPost, "bookings", `{"venueId":9,"slot":1}`, bob, http.StatusNotFound},
+		{"bad body", http.MethodPost, "bookings", `{`, bob, http.StatusBadRequest},
+		{"own booking", http.MethodGet, "bookings/1", "", ann, http.StatusOK},
+		{"someone else's booking", http.MethodGet, "bookings/1", "", bob, http.StatusNotFound},
+		{"cancel someone else's", http.MethodDelete, "bookings/1", "", bob, http.StatusNotFound},
+		{"cancel", http.MethodDelete, "bookings/1", "", ann, http.StatusNoContent},
+		{"cancelled", http.MethodGet, "bookings/1", "", ann, http.StatusNotFound},
+		{"free to book again", http.MethodPost, "bookings", booking, bob, http.StatusCreated},
+		{"profile", http.MethodGet, "profile", "", ann, http.StatusOK},
+		{"edit profile", http.MethodPatch, "profile", `{"first":"<script>x</script>Ann"}`, ann, http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, APIPrefix+tt.path, strings.NewReader(tt.body))
+		if tt.cookie != nil {
+			req.AddCookie(tt.cookie)
+		}
+		res := httptest.NewRecorder()
+		api.ServeHTTP(res, req)
+		if res.Code != tt.want {
+			t.Errorf("%s: %s %s gave %d, want %d: %s", tt.name, tt.method, tt.path, res.Code, tt.want, res.Body)
+		}
+		if ct := res.Header().Get("Content-Type"); res.Code != http.StatusNoContent && ct != "application/json" {
+			t.Errorf("%s: content type %q, want json", tt.name, ct)
+		}
+	}
+	if u, _ := a.user("ann"); u.First != "Ann" || len(u.Bookings) != 0 {
+		t.Fatalf("ann has name %q and bookings %v, want Ann and none", u.First, u.Bookings)
+	}
+}
+
+func TestAPIVenueSearch(t *testing.T) {
+	a := newTestCtl(t)
+	for _, v := range []model.Venue{
+		{Name: "Garden Room", Kind: "Room", Location: "South", Capacity: 20, Desc: "Opens onto the hall"},
+		{Name: "Studio", Kind: "Room", Location: "North", Capacity: 5, Desc: "Quiet room"},
+	} {
+		if err := a.Model.AddVenue(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		name  string
+		query string
+		want  []int // ids in the order listed
+	}{
+		{"no text lists by id", "", []int{1, 2, 3}},
+		{"ranked by relevance", "?q=hall", []int{1, 2}},
+		{"prefix", "?q=gard", []int{2}},
+		{"with a filter", "?q=room&location=North", []int{3}},
+		{"no match", "?q=kitchen", []int{}},
+	}
+	api := a.API()
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, APIPrefix+"venues"+tt.query, nil)
+		res := httptest.NewRecorder()
+		api.ServeHTTP(res, req)
+		var venues []apiVenue
+		if err := json.NewDecoder(res.Body).Decode(&venues); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		var ids []int
+		for _, v := range venues {
+			ids = append(ids, v.ID)
+		}
+		if fmt.Sprint(ids) != fmt.Sprint(tt.want) {
+			t.Errorf("%s: listed %v, want %v", tt.name, ids, tt.want)
+		}
+	}
+}
+
+func TestAPIVenueFeatures(t *testing.T) {
+	a := newTestCtl(t)
+	for _, v := range []model.Venue{
+		{Name: "Barn", Kind: "Barn", Location: "South", Capacity: 40, Amenities: []string{"kitchen"}, Tags: []string{"rustic"}, Attrs: map[string]float64{"area": 150, "price": 30}},
+		{Name: "Studio", Kind: "Room", Location: "North", Capacity: 5, Amenities: []string{"projector", "av"}, Tags: []string{"quiet"}, Attrs: map[string]float64{"area": 30}},
+	} {
+		if err := a.Model.AddVenue(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		name   string
+		query  string
+		status int
+		want   []int // ids listed, if the status is OK
+	}{
+		{"amenity", "?amenity=kitchen", http.StatusOK, []int{2}},
+		{"all of two amenities", "?amenity=projector&amenity=av", http.StatusOK, []int{3}},
+		{"any of two amenities", "?amenity=kitchen&amenity=av&match=any", http.StatusOK, []int{2, 3}},
+		{"tag", "?tag=quiet", http.StatusOK, []int{3}},
+		{"attribute range", "?areaMin=100&areaMax=200", http.StatusOK, []int{2}},
+		{"attribute minimum only", "?areaMin=10", http.StatusOK, []int{2, 3}},
+		{"attribute and filter", "?areaMin=10&location=North", http.StatusOK, []int{3}},
+		{"attribute not a number", "?priceMax=cheap", http.StatusBadRequest, nil},
+	}
+	api := a.API()
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, APIPrefix+"venues"+tt.query, nil)
+		res := httptest.NewRecorder()
+		api.ServeHTTP(res, req)
+		if res.Code != tt.status {
+			t.Errorf("%s: status %d, want %d", tt.name, res.Code, tt.status)
+			continue
+		}
+		if tt.status != http.StatusOK {
+			continue
+		}
+		var venues []apiVenue
+		if err := json.NewDecoder(res.Body).Decode(&venues); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		var ids []int
+		for _, v := range venues {
+			ids = append(ids, v.ID)
+		}
+		if fmt.Sprint(ids) != fmt.Sprint(tt.want) {
+			t.Errorf("%s: listed %v, want %v", tt.name, ids, tt.want)
+		}
+	}
+}
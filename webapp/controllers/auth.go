@@ -0,0 +1,174 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	config "gia/config"
+	model "gia/model"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type ctxKey int
+
+// usernameKey : context key of the username a request is authenticated as
+const usernameKey ctxKey = 0
+
+// requestUser : username set on req by Auth
+func requestUser(req *http.Request) (string, bool) {
+	username, ok := req.Context().Value(usernameKey).(string)
+	return username, ok
+}
+
+// bearerToken : token of an "Authorization: Bearer <token>" header
+func bearerToken(req *http.Request) (string, bool) {
+	h := req.Header.Get("Authorization")
+	if h == "" {
+		return "", false
+	}
+	token, ok := strings.CutPrefix(h, "Bearer ")
+	return token, ok
+}
+
+//Auth : closure for http handler to find who made a request, from a bearer
+//token or else the session cookie. Handlers read it with requestUser.
+//A request with a bad bearer token is refused rather than treated as anonymous
+func (a *Ctl) Auth() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			var username string
+			if _, sent := req.Header["Authorization"]; sent {
+				token, ok := bearerToken(req)
+				var err error
+				if ok {
+					username, err = a.Model.UserDB.Authenticate(token)
+				}
+				if !ok || err != nil {
+					a.Logging.Warning.Println("Invalid bearer token from ", req.UserAgent())
+					res.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+					if strings.HasPrefix(req.URL.Path, APIPrefix) {
+						writeError(res, http.StatusUnauthorized, model.ErrTokenInvalid)
+					} else {
+						http.Error(res, model.ErrTokenInvalid.Error(), http.StatusUnauthorized)
+					}
+					return
+				}
+			} else if myCookie, err := req.Cookie(config.NCOOKIE); err == nil {
+				var ok bool
+				if username, ok = a.sessionUser(myCookie.Value); !ok {
+					// expired or logged out elsewhere
+					clearCookie(res)
+				}
+			}
+			if username != "" {
+				req = req.WithContext(context.WithValue(req.Context(), usernameKey, username))
+			}
+			next.ServeHTTP(res, req)
+		})
+	}
+}
+
+// apiLoginRequest : credentials, checked like the login page does
+type apiLoginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// apiTokenRequest : a previously issued token
+type apiTokenRequest struct {
+	Token string `json:"token"`
+}
+
+// apiTokens : bearer tokens, expiresIn is seconds until the access token expires
+type apiTokens struct {
+	AccessToken  string `json:"accessToken"`
+	RefreshToken string `json:"refreshToken"`
+	TokenType    string `json:"tokenType"`
+	ExpiresIn    int    `json:"expiresIn"`
+}
+
+func toAPITokens(p model.TokenPair) apiTokens {
+	return apiTokens{
+		AccessToken:  p.Access,
+		RefreshToken: p.Refresh,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(time.Until(p.Expires).Seconds()),
+	}
+}
+
+// apiLogin : issue tokens for a username and password
+func (a *Ctl) apiLogin(res http.ResponseWriter, req *http.Request) {
+	if !allow(res, req, http.MethodPost) {
+		return
+	}
+	var r apiLoginRequest
+	if err := json.NewDecoder(req.Body).Decode(&r); err != nil {
+		writeError(res, http.StatusBadRequest, errBadRequest)
+		return
+	}
+	u, err := a.checkLogin(santizeString(r.Username), r.Password)
+	if err == errLocked {
+		a.Logging.Warning.Println("Login to locked account ", r.Username, " from ", req.UserAgent())
+		writeError(res, http.StatusForbidden, errors.New("too many failed logins, try again later"))
+		return
+	}
+	if err != nil {
+		a.Logging.Info.Println(err, " from ", req.UserAgent())
+		writeError(res, http.StatusUnauthorized, errors.New("username and/or password do not match"))
+		return
+	}
+	pair, err := a.Model.UserDB.IssueTokens(u.Username, config.AccessTokenTTL, config.RefreshTokenTTL)
+	if err != nil {
+		a.Logging.Error.Println("Issuing tokens, ", err, " from ", req.UserAgent())
+		writeError(res, http.StatusInternalServerError, errors.New("internal server error"))
+		return
+	}
+	a.Logging.Info.Println("Tokens issued from ", req.UserAgent())
+	writeJSON(res, http.StatusOK, toAPITokens(pair))
+}
+
+// apiRefresh : swap a refresh token for new tokens
+func (a *Ctl) apiRefresh(res http.ResponseWriter, req *http.Request) {
+	if !allow(res, req, http.MethodPost) {
+		return
+	}
+	var r apiTokenRequest
+	if err := json.NewDecoder(req.Body).Decode(&r); err != nil {
+		writeError(res, http.StatusBadRequest, errBadRequest)
+		return
+	}
+	pair, err := a.Model.UserDB.Refresh(r.Token, config.AccessTokenTTL, config.RefreshTokenTTL)
+	if err == model.ErrTokenInvalid {
+		writeError(res, http.StatusUnauthorized, err)
+		return
+	}
+	if err != nil {
+		a.Logging.Error.Println("Refreshing tokens, ", err, " from ", req.UserAgent())
+		writeError(res, http.StatusInternalServerError, errors.New("internal server error"))
+		return
+	}
+	writeJSON(res, http.StatusOK, toAPITokens(pair))
+}
+
+// apiRevoke : revoke a token and the other token issued with it.
+// Revoking an unknown token succeeds, so tokens cannot be probed
+func (a *Ctl) apiRevoke(res http.ResponseWriter, req *http.Request) {
+	if !allow(res, req, http.MethodPost) {
+		return
+	}
+	var r apiTokenRequest
+	if err := json.NewDecoder(req.Body).Decode(&r); err != nil {
+		writeError(res, http.StatusBadRequest, errBadRequest)
+		return
+	}
+	err := a.Model.UserDB.Revoke(r.Token)
+	if err != nil && err != model.ErrTokenInvalid {
+		a.Logging.Error.Println("Revoking token, ", err, " from ", req.UserAgent())
+		writeError(res, http.StatusInternalServerError, errors.New("internal server error"))
+		return
+	}
+	a.Logging.Info.Println("Token revoked from ", req.UserAgent())
+	res.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,78 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// apiCall : status and body of an api request through Auth, with an
+// Authorization header if auth is not empty
+func apiCall(a *Ctl, method string, path string, body string, auth string) (int, string) {
+	req := httptest.NewRequest(method, APIPrefix+path, strings.NewReader(body))
+	if auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+	res := httptest.NewRecorder()
+	a.Auth()(a.API()).ServeHTTP(res, req)
+	return res.Code, res.Body.String()
+}
+
+func TestBearerAuth(t *testing.T) {
+	a := newTestCtl(t)
+	password, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err := a.Model.UserDB.Add(User{Username: "ann", Password: password}); err != nil {
+		t.Fatal(err)
+	}
+	if code, _ := apiCall(a, http.MethodPost, "auth/login", `{"username":"ann","password":"wrong"}`, ""); code != http.StatusUnauthorized {
+		t.Fatalf("login with a wrong password gave %d, want 401", code)
+	}
+	login := func() apiTokens {
+		t.Helper()
+		code, body := apiCall(a, http.MethodPost, "auth/login", `{"username":"ann","password":"secret"}`, "")
+		var tokens apiTokens
+		if code != http.StatusOK || json.Unmarshal([]byte(body), &tokens) != nil {
+			t.Fatalf("login gave %d %s", code, body)
+		}
+		return tokens
+	}
+	tokens := login()
+	tests := []struct {
+		name string
+		auth string
+		want int
+	}{
+		{"access token", "Bearer " + tokens.AccessToken, http.StatusOK},
+		{"refresh token", "Bearer " + tokens.RefreshToken, http.StatusUnauthorized},
+		{"unknown token", "Bearer nonsense", http.StatusUnauthorized},
+		{"not a bearer token", "Basic YW5uOnNlY3JldA==", http.StatusUnauthorized},
+		{"no token", "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		if code, body := apiCall(a, http.MethodGet, "bookings", "", tt.auth); code != tt.want {
+			t.Errorf("%s: bookings gave %d, want %d: %s", tt.name, code, tt.want, body)
+		}
+	}
+
+	code, body := apiCall(a, http.MethodPost, "auth/refresh", `{"token":"`+tokens.RefreshToken+`"}`, "")
+	var next apiTokens
+	if code != http.StatusOK || json.Unmarshal([]byte(body), &next) != nil {
+		t.Fatalf("refresh gave %d %s", code, body)
+	}
+	if code, _ := apiCall(a, http.MethodGet, "bookings", "", "Bearer "+tokens.AccessToken); code != http.StatusUnauthorized {
+		t.Fatalf("access token of a refreshed pair gave %d, want 401", code)
+	}
+	if code, _ := apiCall(a, http.MethodPost, "auth/revoke", `{"token":"`+next.RefreshToken+`"}`, ""); code != http.StatusNoContent {
+		t.Fatalf("revoke gave %d, want 204", code)
+	}
+	if code, _ := apiCall(a, http.MethodGet, "bookings", "", "Bearer "+next.AccessToken); code != http.StatusUnauthorized {
+		t.Fatalf("access token of a revoked pair gave %d, want 401", code)
+	}
+	if code, _ := apiCall(a, http.MethodPost, "auth/revoke", `{"token":"unknown"}`, ""); code != http.StatusNoContent {
+		t.Fatalf("revoking an unknown token gave %d, want 204", code)
+	}
+}
@@ -2,8 +2,10 @@
 package controller
 
 import (
+	"errors"
 	"fmt"
 	config "gia/config"
+	mail "gia/mail"
 	model "gia/model"
 	"html/template"
 	"net/http"
@@ -12,7 +14,6 @@ import (
 	"time"
 
 	"github.com/microcosm-cc/bluemonday"
-	uuid "github.com/satori/go.uuid"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -31,43 +32,24 @@ type Booking struct {
 	User      string
 	VenueID   int
 	VenueName string
-	Date      int
+	Date      string
 	Time      string
 }
 
 func convertBooking(booking model.Booking, mapping map[int]string) Booking {
-
-	date := booking.Datetime / 10
-	time := booking.Datetime % 10
-	ctime := "nil time"
-	switch time {
-	case 1:
-		ctime = "Morning"
-	case 2:
-		ctime = "Afternoon"
-	case 3:
-		ctime = "Evening"
-	}
-
 	b := Booking{
 		IDBook:    booking.IDBook,
 		User:      booking.User,
 		VenueID:   booking.VenueID,
 		VenueName: mapping[booking.VenueID],
-		Date:      date,
-		Time:      ctime,
+		Date:      booking.Slot.Date(),
+		Time:      booking.Slot.Time(),
 	}
 	return b
 }
 
 // User : User object
-type User struct {
-	Username string
-	Password []byte
-	First    string
-	Last     string
-	Bookings []int
-}
+type User = model.User
 
 type wrongUserError struct {
 	user1, user2 string //error message
@@ -78,34 +60,42 @@ func (p *wrongUserError) Error() string {
 	return fmt.Sprintf(format, p.user1, p.user2)
 }
 
-type mapUsers map[string]User
-type mapSessions map[string]string
-
 //Ctl : controller that holds all needed obj
 type Ctl struct {
-	Users    mapUsers
-	Sessions mapSessions
 	Template *template.Template
 	Model    model.Model
 	Logging  *config.Logging
+	Mailer   mail.Mailer
+	Signer   *model.Signer   // signs emailed links
+	Channels []string        // names of the channels notifications go out on
+	Blobs    model.BlobStore // venue photos and floor plans
 }
 
-//getUser :
-func (a *Ctl) getUser(res http.ResponseWriter, req *http.Request) User {
-	// get current session cookie
-	myCookie, err := req.Cookie(config.NCOOKIE)
-	if err != nil {
-		id := uuid.NewV4()
-		myCookie = &http.Cookie{
-			Name:  config.NCOOKIE,
-			Value: id.String(),
-		}
+// user : look up user by username
+func (a *Ctl) user(username string) (User, bool) {
+	u, err := a.Model.UserDB.Get(username)
+	if err != nil && err != model.ErrUserNotFound {
+		a.Logging.Error.Println("Reading user ", username, ", ", err)
+	}
+	return u, err == nil
+}
+
+// updateUser : apply fn to the stored user in one step, so concurrent
+// edits of the same user are not lost. false if there is no such user
+func (a *Ctl) updateUser(username string, fn func(u *User)) (User, bool) {
+	u, err := a.Model.UserDB.Update(username, fn)
+	if err != nil && err != model.ErrUserNotFound {
+		a.Logging.Error.Println("Updating user ", username, ", ", err)
 	}
-	http.SetCookie(res, myCookie)
+	return u, err == nil
+}
+
+//getUser : logged in user, or the zero User
+func (a *Ctl) getUser(res http.ResponseWriter, req *http.Request) User {
 	// if the user exists already, get user
 	var myUser User
-	if username, ok := a.Sessions[myCookie.Value]; ok {
-		myUser = a.Users[username]
+	if username, ok := requestUser(req); ok {
+		myUser, _ = a.user(username)
 	}
 	return myUser
 }
@@ -113,56 +103,73 @@ func (a *Ctl) getUser(res http.ResponseWriter, req *http.Request) User {
 // Index : landing page
 func (a *Ctl) Index(res http.ResponseWriter, req *http.Request) {
 	type pageData struct {
+		Page
 		User User
 	}
 	d := pageData{
 		User: a.getUser(res, req),
 	}
-	a.Template.ExecuteTemplate(res, "index.html", d)
+	a.render(res, req, "index.html", &d)
 }
 
 // Profile : user profile page
 func (a *Ctl) Profile(res http.ResponseWriter, req *http.Request) {
 	type pageData struct {
+		Page
 		User User
 	}
-	d := pageData{
-		User: a.getUser(res, req),
-	}
-	if !a.alreadyLoggedIn(req) {
-		a.Logging.Warning.Println("Unauthorised access to Profile from ", req.UserAgent())
-		http.Redirect(res, req, "/", http.StatusSeeOther)
+	u, ok := a.require(res, req, model.PermBook)
+	if !ok {
 		return
 	}
-	a.Template.ExecuteTemplate(res, "profile.html", d)
+	d := pageData{
+		User: u,
+	}
+	a.render(res, req, "profile.html", &d)
 }
 
 // EditProfile :
 func (a *Ctl) EditProfile(res http.ResponseWriter, req *http.Request) {
 	type pageData struct {
+		Page
 		User User
 	}
-	d := pageData{
-		User: a.getUser(res, req),
-	}
-	if !a.alreadyLoggedIn(req) {
-		a.Logging.Warning.Println("Unauthorised access to EditProfile from ", req.UserAgent())
-		http.Redirect(res, req, "/", http.StatusSeeOther)
+	u, ok := a.require(res, req, model.PermBook)
+	if !ok {
 		return
 	}
+	d := pageData{
+		User: u,
+	}
 	if req.Method == http.MethodPost {
 		// get form values
 		firstname := req.FormValue("firstname")
 		lastname := req.FormValue("lastname")
-		d.User.First = firstname
-		d.User.Last = lastname
-		a.Users[d.User.Username] = d.User
+		var email string
+		if s := req.FormValue("email"); s != "" {
+			var err error
+			if email, err = parseEmail(s); err != nil {
+				http.Error(res, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		u, _ := a.updateUser(d.User.Username, func(u *User) {
+			u.SetName(&firstname, &lastname)
+			// a new email has to be verified again
+			if email != "" && email != u.Email {
+				u.Email = email
+				u.Verified = false
+			}
+		})
+		if email != "" && email != d.User.Email {
+			a.sendVerification(u)
+		}
 		// redirect to profile
 		a.Logging.Info.Println("Profile edited from ", req.UserAgent())
 		http.Redirect(res, req, "/profile", http.StatusSeeOther)
 		return
 	}
-	a.Template.ExecuteTemplate(res, "editProfile.html", d)
+	a.render(res, req, "editProfile.html", &d)
 }
 
 // Signup :
@@ -176,26 +183,22 @@ func (a *Ctl) Signup(res http.ResponseWriter, req *http.Request) {
 	if req.Method == http.MethodPost {
 		// get form values
 		username := santizeString(req.FormValue("username"))
-		password := santizeString(req.FormValue("password"))
-		firstname := santizeString(req.FormValue("firstname"))
-		lastname := santizeString(req.FormValue("lastname"))
+		// passwords are only ever hashed, so they are kept as typed
+		password := req.FormValue("password")
+		firstname := req.FormValue("firstname")
+		lastname := req.FormValue("lastname")
 		if username != "" {
-			// check if username exist/ taken
-			if _, ok := a.Users[username]; ok {
-				http.Error(res, "Username already taken", http.StatusForbidden)
-				a.Logging.Info.Println("Signup with existing username from ", req.UserAgent())
+			email, err := parseEmail(req.FormValue("email"))
+			if err != nil {
+				http.Error(res, err.Error(), http.StatusBadRequest)
 				return
 			}
-			// create session
-			id := uuid.NewV4()
-			myCookie := &http.Cookie{
-				Name:    config.NCOOKIE,
-				Value:   id.String(),
-				Expires: time.Now().Add(2 * time.Hour),
+			if err := PasswordPolicy.Check(username, password); err != nil {
+				http.Error(res, "Password not accepted: "+err.Error(), http.StatusBadRequest)
+				a.Logging.Info.Println("Signup with weak password, ", err, " from ", req.UserAgent())
+				return
 			}
-			http.SetCookie(res, myCookie)
-			a.Sessions[myCookie.Value] = username
-			bPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+			bPassword, err := hashPassword(password)
 			if err != nil {
 				http.Error(res, "Internal server error", http.StatusInternalServerError)
 				a.Logging.Error.Println("Error with password from ", req.UserAgent())
@@ -205,17 +208,31 @@ func (a *Ctl) Signup(res http.ResponseWriter, req *http.Request) {
 				Username: username,
 
 				Password: bPassword,
-				First:    firstname,
-				Last:     lastname,
+				Email:    email,
 			}
-			a.Users[username] = myUser
+			myUser.SetName(&firstname, &lastname)
+			// check if username exist/ taken
+			err = a.Model.UserDB.Add(myUser)
+			if err == model.ErrUserExists {
+				http.Error(res, "Username already taken", http.StatusForbidden)
+				a.Logging.Info.Println("Signup with existing username from ", req.UserAgent())
+				return
+			}
+			if err != nil {
+				http.Error(res, "Internal server error", http.StatusInternalServerError)
+				a.Logging.Error.Println("Saving new user, ", err, " from ", req.UserAgent())
+				return
+			}
+			// create session
+			a.startSession(res, req, username)
+			a.sendVerification(myUser)
 			a.Logging.Info.Println("New user sign up from ", req.UserAgent())
 		}
 		// redirect to main index
 		http.Redirect(res, req, "/", http.StatusSeeOther)
 		return
 	}
-	a.Template.ExecuteTemplate(res, "signup.html", myUser)
+	a.render(res, req, "signup.html", &Page{})
 }
 
 // Login :
@@ -227,66 +244,95 @@ func (a *Ctl) Login(res http.ResponseWriter, req *http.Request) {
 	// process form submission
 	if req.Method == http.MethodPost {
 		username := santizeString(req.FormValue("username"))
-		password := santizeString(req.FormValue("password"))
-		// check if user exist with username
-		myUser, ok := a.Users[username]
-		if !ok {
-			http.Error(res, "Username and/or password do not match", http.
-				StatusForbidden)
-			a.Logging.Info.Println("Unexisting username login from ", req.UserAgent())
+		password := req.FormValue("password")
+		if _, err := a.checkLogin(username, password); err == errLocked {
+			http.Error(res, "Too many failed logins, try again later", http.StatusForbidden)
+			a.Logging.Warning.Println("Login to locked account ", username, " from ", req.UserAgent())
 			return
-		}
-		// Matching of password entered
-		err := bcrypt.CompareHashAndPassword(myUser.Password, []byte(password))
-		if err != nil {
+		} else if err != nil {
 			http.Error(res, "Username and/or password do not match", http.
 				StatusForbidden)
-			a.Logging.Info.Println("Wrong password from ", req.UserAgent())
+			a.Logging.Info.Println(err, " from ", req.UserAgent())
 			return
 		}
-		// create session
-		id := uuid.NewV4()
-		myCookie := &http.Cookie{
-			Name:    config.NCOOKIE,
-			Value:   id.String(),
-			Expires: time.Now().Add(2 * time.Hour),
+		// create session, never reusing an id the browser already had
+		if !a.startSession(res, req, username) {
+			http.Error(res, "Internal server error", http.StatusInternalServerError)
+			return
 		}
-		http.SetCookie(res, myCookie)
-		a.Sessions[myCookie.Value] = username
 		http.Redirect(res, req, "/", http.StatusSeeOther)
 		a.Logging.Info.Println("Successful login from ", req.UserAgent())
 		return
 	}
-	a.Template.ExecuteTemplate(res, "login.html", nil)
+	a.render(res, req, "login.html", &Page{})
+}
+
+// errors of checkLogin, the first two are shown to the user as the same message
+var (
+	errUnknownUser   = errors.New("Unexisting username login")
+	errWrongPassword = errors.New("Wrong password")
+	errLocked        = errors.New("Account locked")
+)
+
+// checkLogin : user with username if password is theirs. Failures count
+// towards locking the account, and a hash of an old cost is replaced
+func (a *Ctl) checkLogin(username string, password string) (User, error) {
+	// check if user exist with username
+	myUser, ok := a.user(username)
+	if !ok {
+		return User{}, errUnknownUser
+	}
+	now := time.Now()
+	if myUser.Locked(now) {
+		return User{}, errLocked
+	}
+	// Matching of password entered
+	matched, legacy := matchPassword(myUser.Password, password)
+	if !matched {
+		u, err := a.Model.UserDB.LoginFailed(username, Lockout, now)
+		if err != nil {
+			a.Logging.Error.Println("Counting failed login of ", username, ", ", err)
+		} else if u.Locked(now) {
+			a.Logging.Warning.Println("Account ", username, " locked after ", Lockout.Threshold, " failed logins")
+		}
+		return User{}, errWrongPassword
+	}
+	var rehash []byte
+	if cost, err := bcrypt.Cost(myUser.Password); err != nil || cost < config.BcryptCost || legacy {
+		if rehash, err = hashPassword(password); err != nil {
+			a.Logging.Error.Println("Rehashing password of ", username, ", ", err)
+			rehash = nil
+		} else {
+			a.Logging.Info.Println("Password of ", username, " rehashed")
+		}
+	}
+	if myUser.FailedLogins > 0 || rehash != nil {
+		if _, err := a.Model.UserDB.LoginSucceeded(username, rehash); err != nil {
+			a.Logging.Error.Println("Saving login of ", username, ", ", err)
+		}
+	}
+	return myUser, nil
 }
 
 // Logout :
 func (a *Ctl) Logout(res http.ResponseWriter, req *http.Request) {
-	if !a.alreadyLoggedIn(req) {
+	// only a form post logs out, so other sites cannot link to it
+	if !a.alreadyLoggedIn(req) || req.Method != http.MethodPost {
 		http.Redirect(res, req, "/", http.StatusSeeOther)
 		return
 	}
-	myCookie, _ := req.Cookie(config.NCOOKIE)
-	// delete the session
-	delete(a.Sessions, myCookie.Value)
-	// remove the cookie
-	myCookie = &http.Cookie{
-		Name:   config.NCOOKIE,
-		Value:  "",
-		MaxAge: -1,
-	}
-	http.SetCookie(res, myCookie)
+	// delete the session and remove the cookie
+	a.endSession(res, req)
 	a.Logging.Info.Println("User logout from ", req.UserAgent())
 	http.Redirect(res, req, "/", http.StatusSeeOther)
 }
 
 func (a *Ctl) alreadyLoggedIn(req *http.Request) bool {
-	myCookie, err := req.Cookie(config.NCOOKIE)
-	if err != nil {
+	username, ok := requestUser(req)
+	if !ok {
 		return false
 	}
-	username := a.Sessions[myCookie.Value]
-	_, ok := a.Users[username]
+	_, ok = a.user(username)
 	return ok
 }
 
@@ -320,25 +366,40 @@ func mapNilAll(s string) string {
 // Browse : venues
 func (a *Ctl) Browse(res http.ResponseWriter, req *http.Request) {
 	type pageData struct {
+		Page
 		User     User
 		Venues   map[int]model.Venue
+		Order    []int // ids of Venues, best match first
 		Kind     []string
 		Location []string
 		MaxCap   int
 		MinCap   int
 		SMaxCap  int
 		SMinCap  int
+		Search   string
+		Features browseFeatures
+		From     string               // free from, as a datetime-local value
+		To       string               // free until
+		Free     map[int][]model.Slot // slots free between From and To, by venue id
 	}
 	min, max := a.Model.VenueDB.Caps()
 	data := pageData{
 		User:     a.getUser(res, req),
-		Venues:   a.Model.VenueDB.Venues,
+		Venues:   a.Model.VenueDB.Active(),
 		Kind:     prependStr(a.Model.VenueDB.KindList(), "All"),
 		Location: prependStr(a.Model.VenueDB.LocationList(), "All"),
 		MinCap:   min,
 		MaxCap:   max,
 	}
+	for id := range data.Venues {
+		data.Order = append(data.Order, id)
+	}
+	sort.Ints(data.Order)
+	if req.Method != http.MethodPost {
+		data.Features = a.featureQuery(req, &model.Query{})
+	}
 	if req.Method == http.MethodPost {
+		search := santizeString(req.FormValue("search"))
 		venueKind := santizeString(req.FormValue("venueKind"))
 		venueLocation := santizeString(req.FormValue("venueLocation"))
 		venueMinCap, _ := strconv.Atoi(req.FormValue("venueMinCap"))
@@ -348,18 +409,40 @@ func (a *Ctl) Browse(res http.ResponseWriter, req *http.Request) {
 			CapMin:   venueMinCap,
 			CapMax:   venueMaxCap,
 			Kind:     mapNilAll(venueKind),
+			Text:     search,
+		}
+		// left empty, or not a time, there is no limit on that side
+		q.DateMin, _ = time.ParseInLocation(rangeLayout, req.FormValue("availableFrom"), model.Location)
+		q.DateMax, _ = time.ParseInLocation(rangeLayout, req.FormValue("availableTo"), model.Location)
+		data.Features = a.featureQuery(req, &q)
+		matches := a.Model.Search(q)
+		if search == "" {
+			sort.Slice(matches, func(i, j int) bool { return matches[i].ID < matches[j].ID })
+		}
+		data.Venues = make(map[int]model.Venue, len(matches))
+		data.Order = make([]int, 0, len(matches))
+		data.Free = make(map[int][]model.Slot, len(matches))
+		for _, m := range matches {
+			data.Venues[m.ID] = m.Venue
+			data.Order = append(data.Order, m.ID)
+			data.Free[m.ID] = m.Free
+		}
+		data.Search = search
+		if !q.DateMin.IsZero() {
+			data.From = q.DateMin.Format(rangeLayout)
+		}
+		if !q.DateMax.IsZero() {
+			data.To = q.DateMax.Format(rangeLayout)
 		}
-		venues, _ := a.Model.VenueDB.Filter(q)
-		data.Venues = venues
 		data.Kind = reorderStr(data.Kind, venueKind)
 		data.Location = reorderStr(data.Location, venueLocation)
 		data.SMaxCap = venueMaxCap
 		data.SMinCap = venueMinCap
-		a.Template.ExecuteTemplate(res, "browse.html", data)
+		a.render(res, req, "browse.html", &data)
 		a.Logging.Trace.Println("Venue search from ", req.UserAgent())
 		return
 	}
-	a.Template.ExecuteTemplate(res, "browse.html", data)
+	a.render(res, req, "browse.html", &data)
 }
 
 // Book :
@@ -376,89 +459,221 @@ func (a *Ctl) Book(res http.ResponseWriter, req *http.Request) {
 		http.Redirect(res, req, "/browse", http.StatusSeeOther)
 		return
 	}
-	venue := a.Model.VenueDB.Venues[vID]
+	rdt, exists := a.Model.BookingDB.Venue(vID)
+	if !exists {
+		http.Redirect(res, req, "/browse", http.StatusSeeOther)
+		return
+	}
+	venue, _ := a.Model.VenueDB.Get(vID)
 	type data struct {
-		Venue model.Venue
-		Avail map[int]map[int]string
-		Order []int
-		Vid   int
-		User  User
+		Page
+		Venue   model.Venue
+		Parts   []model.DayPart
+		Days    []model.DayState
+		Free    []model.Interval
+		MinTime string
+		MaxTime string
+		Vid     int
+		User    User
 	}
-	avail, order := a.Model.BookingDB.VenueReserve[vID].GetDate(model.MinDate, model.MaxDate)
+	now := time.Now()
+	end := rdt.WindowEnd()
 	d := data{
-		Venue: venue,
-		Avail: avail,
-		Order: order,
-		Vid:   vID,
-		User:  a.getUser(res, req),
+		Venue:   venue,
+		Parts:   rdt.Parts(),
+		Days:    rdt.GetDate(now, now.AddDate(1, 0, 0)),
+		Free:    a.Model.BookingDB.FreeIntervals(vID, now.Truncate(time.Minute), end),
+		MinTime: now.In(model.Location).Format(rangeLayout),
+		MaxTime: end.Format(rangeLayout),
+		Vid:     vID,
+		User:    a.getUser(res, req),
 	}
 	a.Logging.Trace.Println("Booking attempt from ", req.UserAgent())
-	a.Template.ExecuteTemplate(res, "book.html", &d)
+	a.render(res, req, "book.html", &d)
 }
 
-// ConfirmBook :
-func (a *Ctl) ConfirmBook(res http.ResponseWriter, req *http.Request) {
+// rangeLayout : format of datetime-local inputs
+const rangeLayout = "2006-01-02T15:04"
+
+// slotParam : slot chosen on the book page, either ?slot=<unix start>,
+// a custom ?from=&to= range or the old ?date=YYMMDD&time=T encoding
+func slotParam(req *http.Request, rdt *model.ReserveDT) (model.Slot, error) {
+	q := req.URL.Query()
+	if q.Get("from") != "" || q.Get("to") != "" {
+		from, err1 := time.ParseInLocation(rangeLayout, q.Get("from"), model.Location)
+		to, err2 := time.ParseInLocation(rangeLayout, q.Get("to"), model.Location)
+		if err1 != nil || err2 != nil {
+			return model.Slot{}, model.ErrInvalidRange
+		}
+		return model.CustomSlot(model.Interval{Start: from, End: to}), nil
+	}
+	var key int64
+	if s := q.Get("slot"); s != "" {
+		k, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return model.Slot{}, model.ErrSlotUnavailable
+		}
+		key = k
+	} else {
+		date, err1 := strconv.Atoi(q.Get("date"))
+		t, err2 := strconv.Atoi(q.Get("time"))
+		if err1 != nil || err2 != nil {
+			return model.Slot{}, model.ErrSlotUnavailable
+		}
+		slot, err := model.ParseSlotCode(date*10+t, rdt.Parts())
+		if err != nil {
+			return model.Slot{}, model.ErrSlotUnavailable
+		}
+		key = slot.Key()
+	}
+	return slotAt(rdt, key)
+}
+
+// slotAt : slot of rdt starting at key
+func slotAt(rdt *model.ReserveDT, key int64) (model.Slot, error) {
+	slot, ok := rdt.GetSlot(key)
+	if !ok {
+		return model.Slot{}, model.ErrSlotUnavailable
+	}
+	return slot, nil
+}
 
-	vIDs, ok1 := req.URL.Query()["venueId"]
-	dates, ok2 := req.URL.Query()["date"]
-	times, ok3 := req.URL.Query()["time"]
+// bookingStatus : http status for a booking error from the model
+func bookingStatus(err error) int {
+	switch {
+	case errors.Is(err, model.ErrVenueNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, model.ErrSlotTaken), errors.Is(err, model.ErrOverlap),
+		errors.Is(err, model.ErrSlotFree), errors.Is(err, model.ErrAlreadyWaiting),
+		errors.Is(err, model.ErrVenueArchived):
+		return http.StatusConflict
+	}
+	return http.StatusBadRequest
+}
 
-	if !ok1 || len(vIDs[0]) < 1 || !ok2 || len(dates[0]) < 1 || !ok3 || len(times[0]) < 1 {
-		a.Logging.Warning.Println("Incorrect booking parameter from ", req.UserAgent())
-		http.Redirect(res, req, "/browse", http.StatusSeeOther)
+// ConfirmBook :
+func (a *Ctl) ConfirmBook(res http.ResponseWriter, req *http.Request) {
+	u, ok := a.require(res, req, model.PermBook)
+	if !ok {
 		return
 	}
-	u := a.getUser(res, req)
-	if !a.alreadyLoggedIn(req) {
-		a.Logging.Warning.Println("Unauthorised booking attempt from ", req.UserAgent())
-		http.Redirect(res, req, "/login", http.StatusSeeOther)
-		return
+	type data struct {
+		Page
+		User  User
+		Venue model.Venue
+		Vid   int
+		Date  string
+		Time  string
+		Error string
+	}
+	d := data{
+		User: u,
+	}
+	// fail : show why the booking cannot be made
+	fail := func(err error) {
+		a.Logging.Warning.Println("Booking rejected, ", err, " from ", req.UserAgent())
+		d.Error = err.Error()
+		res.WriteHeader(bookingStatus(err))
+		a.render(res, req, "confirmBook.html", &d)
 	}
 
 	// Query()["key"] will return an array of items,
 	// we only want the single item.
-	vID, valid1 := strconv.Atoi(vIDs[0])
-	date, valid2 := strconv.Atoi(dates[0])
-	time, valid3 := strconv.Atoi(times[0])
-	if valid1 != nil || valid2 != nil || valid3 != nil {
-		a.Logging.Error.Println("Error converting parameter to integer from ", req.UserAgent())
-		http.Redirect(res, req, "/browse", http.StatusSeeOther)
+	vID, valid := strconv.Atoi(req.URL.Query().Get("venueId"))
+	rdt, exists := a.Model.BookingDB.Venue(vID)
+	if valid != nil || !exists {
+		fail(model.ErrVenueNotFound)
+		return
+	}
+	d.Vid = vID
+	d.Venue, _ = a.Model.VenueDB.Get(vID)
+	slot, err := slotParam(req, rdt)
+	if err != nil {
+		fail(err)
+		return
+	}
+	d.Date = slot.Date()
+	d.Time = slot.Time()
+	if req.Method == http.MethodPost {
+		if _, err := a.book(u.Username, vID, slot); err != nil {
+			fail(err)
+			return
+		}
+		a.Logging.Info.Println("Booking confirmed from ", req.UserAgent())
+		http.Redirect(res, req, "/book?venueId="+fmt.Sprint(vID), http.StatusSeeOther)
+		return
+	}
+	if err := a.Model.BookingDB.Check(vID, slot); err != nil {
+		fail(err)
+		return
+	}
+	a.render(res, req, "confirmBook.html", &d)
+}
+
+// Waitlist : join the waitlist of an unavailable slot
+func (a *Ctl) Waitlist(res http.ResponseWriter, req *http.Request) {
+	u, ok := a.require(res, req, model.PermBook)
+	if !ok {
 		return
 	}
-	venue := a.Model.VenueDB.Venues[vID]
 	type data struct {
+		Page
 		User  User
 		Venue model.Venue
-		Date  int
+		Vid   int
+		Date  string
 		Time  string
-	}
-	timing := "nil time"
-	switch time {
-	case 1:
-		timing = "Morning"
-	case 2:
-		timing = "Afternoon"
-	case 3:
-		timing = "Evening"
+		Error string
 	}
 	d := data{
-		User:  u,
-		Venue: venue,
-		Date:  date,
-		Time:  timing,
+		User: u,
+	}
+	fail := func(err error) {
+		a.Logging.Warning.Println("Waitlist rejected, ", err, " from ", req.UserAgent())
+		d.Error = err.Error()
+		res.WriteHeader(bookingStatus(err))
+		a.render(res, req, "waitlist.html", &d)
+	}
+	vID, valid := strconv.Atoi(req.URL.Query().Get("venueId"))
+	rdt, exists := a.Model.BookingDB.Venue(vID)
+	if valid != nil || !exists {
+		fail(model.ErrVenueNotFound)
+		return
 	}
+	d.Vid = vID
+	d.Venue, _ = a.Model.VenueDB.Get(vID)
+	slot, err := slotParam(req, rdt)
+	if err != nil {
+		fail(err)
+		return
+	}
+	d.Date = slot.Date()
+	d.Time = slot.Time()
 	if req.Method == http.MethodPost {
-		username := u.Username
-		datetime := date*10 + time
-		// check if user exist with username
-		bookingID := a.Model.BookingDB.Reserve(vID, datetime, username)
-		u.Bookings = append(u.Bookings, bookingID)
-		a.Logging.Info.Println("Booking confirmed from ", req.UserAgent())
-		a.Users[u.Username] = u
-		http.Redirect(res, req, "/book?venueId="+fmt.Sprint(vID), http.StatusSeeOther)
+		if _, err := a.Model.BookingDB.Waitlist(vID, slot, u.Username, u.VIP); err != nil {
+			fail(err)
+			return
+		}
+		a.Logging.Info.Println("Waitlist joined from ", req.UserAgent())
+		http.Redirect(res, req, "/viewBook", http.StatusSeeOther)
 		return
 	}
-	a.Template.ExecuteTemplate(res, "confirmBook.html", &d)
+	a.render(res, req, "waitlist.html", &d)
+}
+
+// book : reserve slot of venue vID for username and add it to their bookings
+func (a *Ctl) book(username string, vID int, slot model.Slot) (int, error) {
+	bookingID, err := a.Model.BookingDB.Reserve(vID, slot, username)
+	if err != nil {
+		return 0, err
+	}
+	a.updateUser(username, func(u *User) {
+		u.Bookings = append(u.Bookings, bookingID)
+	})
+	if b, exists := a.Model.BookingDB.Get(bookingID); exists {
+		a.notifyBooked(*b, false)
+	}
+	return bookingID, nil
 }
 
 // Find : check for existing string in string slice
@@ -471,75 +686,117 @@ func Find(a []string, x string) bool {
 	return false
 }
 
+// clearNotices : drop the first shown notices of username, those a page
+// has shown. Any added since the page read the user are kept for next time
+func (a *Ctl) clearNotices(username string, shown int) {
+	a.updateUser(username, func(u *User) {
+		if shown > len(u.Notices) {
+			shown = len(u.Notices)
+		}
+		u.Notices = append([]string(nil), u.Notices[shown:]...)
+	})
+}
+
 // ViewBook :
 func (a *Ctl) ViewBook(res http.ResponseWriter, req *http.Request) {
 	//a.Model.BookingDB.VenueReserve
-	mapping := a.Model.VenueDB.VenueMap
+	mapping := a.Model.VenueDB.Names()
+	type waiting struct {
+		VenueName string
+		Date      string
+		Time      string
+		Position  int
+	}
 	type pageData struct {
-		User   User
-		Venues map[string]model.Venue
-		BkData map[string][]Booking
-		Order  []string
+		Page
+		User    User
+		Venues  map[string]model.Venue
+		BkData  map[string][]Booking
+		Order   []string
+		Waiting []waiting
+		FeedURL string // for calendar apps to subscribe to
+	}
+	u, ok := a.require(res, req, model.PermBook)
+	if !ok {
+		return
 	}
 	data := pageData{
-		User:   a.getUser(res, req),
+		User:   u,
 		Venues: make(map[string]model.Venue),
 		BkData: make(map[string][]Booking),
 	}
-	if !a.alreadyLoggedIn(req) {
-		http.Redirect(res, req, "/", http.StatusSeeOther)
-		return
+	// notices are only shown once
+	if shown := len(data.User.Notices); shown > 0 {
+		a.clearNotices(data.User.Username, shown)
+	}
+	for _, w := range a.Model.BookingDB.Waiting(data.User.Username) {
+		data.Waiting = append(data.Waiting, waiting{
+			VenueName: mapping[w.VenueID],
+			Date:      w.Slot.Date(),
+			Time:      w.Slot.Time(),
+			Position:  w.Position,
+		})
 	}
 	for _, i := range data.User.Bookings {
-		mbooking := a.Model.BookingDB.Bookings[i]
+		mbooking, exists := a.Model.BookingDB.Get(i)
+		if !exists {
+			continue
+		}
 		booking := convertBooking(*mbooking, mapping)
 		venueName := booking.VenueName
 		if Find(data.Order, venueName) {
 			data.BkData[venueName] = append(data.BkData[venueName], booking)
 		} else {
 			data.Order = append(data.Order, venueName)
-			data.Venues[venueName] = a.Model.VenueDB.Venues[booking.VenueID]
+			data.Venues[venueName], _ = a.Model.VenueDB.Get(booking.VenueID)
 			data.BkData[venueName] = append(data.BkData[venueName], booking)
 		}
 
 	}
 	sort.Strings(data.Order)
+	data.FeedURL = a.feedURL(data.User)
 
-	a.Template.ExecuteTemplate(res, "viewBooking.html", data)
+	a.render(res, req, "viewBooking.html", &data)
 }
 
+// removeInt : copy of ints without in, ints itself may be shared with
+// other copies of the user so it is left untouched
 func removeInt(ints []int, in int) []int {
-	var i int
-	for i = 0; i < len(ints); i++ {
-		if ints[i] == in {
-			break
+	result := make([]int, 0, len(ints))
+	for _, i := range ints {
+		if i != in {
+			result = append(result, i)
 		}
 	}
-	copy(ints[i:], ints[i+1:])
-	ints[len(ints)-1] = 0
-	ints = ints[:len(ints)-1]
-	return ints
+	return result
 }
 
 // DeleteBook : cancellation
 func (a *Ctl) DeleteBook(res http.ResponseWriter, req *http.Request) {
-
-	u := a.getUser(res, req)
-	if !a.alreadyLoggedIn(req) {
-		http.Redirect(res, req, "/login", http.StatusSeeOther)
+	u, ok := a.require(res, req, model.PermBook)
+	if !ok {
 		return
 	}
+	// managers come from, and go back to, their venue bookings
+	back := "/viewBook"
 	bIDs, ok := req.URL.Query()["bID"]
 
 	if !ok || len(bIDs[0]) < 1 {
-		http.Redirect(res, req, "/viewBook", http.StatusSeeOther)
+		http.Redirect(res, req, back, http.StatusSeeOther)
 		return
 	}
 
 	bID, valid := strconv.Atoi(bIDs[0])
-	booking := a.Model.BookingDB.Bookings[bID]
+	booking, exists := a.Model.BookingDB.Get(bID)
+	if valid != nil || !exists {
+		http.Redirect(res, req, back, http.StatusSeeOther)
+		return
+	}
+	if booking.User != u.Username {
+		back = "/manageVenues"
+	}
 
-	if valid != nil || booking.User != u.Username || u.Username != "admin" {
+	if !a.canCancel(u, booking) {
 		userE := wrongUserError{
 			user1: u.Username,
 			user2: booking.User}
@@ -548,51 +805,96 @@ func (a *Ctl) DeleteBook(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 	type pageData struct {
+		Page
 		User    User
 		Booking Booking
 	}
 
 	d := pageData{
 		User:    u,
-		Booking: convertBooking(*booking, a.Model.VenueDB.VenueMap),
+		Booking: convertBooking(*booking, a.Model.VenueDB.Names()),
 	}
 
 	if req.Method == http.MethodPost {
 		IDBook := req.FormValue("IDBook")
-		fmt.Println(IDBook)
 		bID, _ := strconv.Atoi(IDBook)
-		booking := a.Model.BookingDB.Bookings[bID]
-		if booking.User != u.Username {
+		booking, exists := a.Model.BookingDB.Get(bID)
+		if !exists || !a.canCancel(u, booking) {
 			a.Logging.Warning.Println("Invalid credential POST booking deletion attempt from ",
 				req.UserAgent())
 			http.Redirect(res, req, "/viewBook", http.StatusSeeOther)
 			return
 		}
 
-		// check if user exist with username
-		a.Model.BookingDB.DelReserve(booking.VenueID, booking.Datetime)
-		u.Bookings = removeInt(u.Bookings, bID)
-		a.Users[u.Username] = u
-		a.Logging.Info.Println("Booking cancelled from ", req.UserAgent())
-		http.Redirect(res, req, "/viewBook", http.StatusSeeOther)
+		// the booking comes off its owner's list, who may not be u
+		if err := a.cancelBooking(booking.User, bID); err != nil {
+			a.Logging.Error.Println("Cancelling booking ", bID, ", ", err, " from ", req.UserAgent())
+			http.Error(res, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		a.Logging.Info.Println("Booking cancelled by ", u.Username, " from ", req.UserAgent())
+		http.Redirect(res, req, back, http.StatusSeeOther)
 		return
 	}
-	a.Template.ExecuteTemplate(res, "deleteBooking.html", &d)
+	a.render(res, req, "deleteBooking.html", &d)
+}
+
+// cancelBooking : cancel booking bID of username, passing what it
+// freed on to waitlisted users
+func (a *Ctl) cancelBooking(username string, bID int) error {
+	booking, exists := a.Model.BookingDB.Get(bID)
+	if !exists {
+		return nil
+	}
+	cancelled := *booking
+	promoted, err := a.Model.BookingDB.DelReserve(bID)
+	if _, exists := a.Model.BookingDB.Get(bID); exists {
+		return err
+	}
+	if err != nil {
+		// cancelled, but a promoted booking may not have been saved
+		a.Logging.Error.Println("Cancelling booking ", bID, ", ", err)
+	}
+	a.updateUser(username, func(u *User) {
+		u.Bookings = removeInt(u.Bookings, bID)
+	})
+	venue, _ := a.Model.VenueDB.Get(cancelled.VenueID)
+	a.notifyCancelled(cancelled, venue, "")
+	a.promote(promoted)
+	return nil
+}
+
+// promote : hand bookings made for waitlisted users to them,
+// and let them know
+func (a *Ctl) promote(bookings []*model.Booking) {
+	for _, b := range bookings {
+		a.updateUser(b.User, func(u *User) {
+			u.Bookings = append(u.Bookings, b.IDBook)
+		})
+		a.notifyBooked(*b, true)
+		a.Logging.Info.Println("Waitlisted user ", b.User, " promoted to booking ", b.IDBook)
+	}
 }
 
 // AddVenue :
 func (a *Ctl) AddVenue(res http.ResponseWriter, req *http.Request) {
 
-	u := a.getUser(res, req)
-	if u.Username != "admin" {
-		http.Redirect(res, req, "/", http.StatusSeeOther)
+	u, ok := a.require(res, req, model.PermManageVenues)
+	if !ok {
 		return
 	}
 	type pageData struct {
-		User User
+		Page
+		User     User
+		DayParts []model.DayPart
+		Window   int
+		Features venueFeatures
 	}
 	d := pageData{
-		User: u,
+		User:     u,
+		DayParts: model.DefaultDayParts,
+		Window:   model.DaysLimit,
+		Features: featureFields(model.Venue{}),
 	}
 	if req.Method == http.MethodPost {
 		vName := santizeString(req.FormValue("name"))
@@ -600,23 +902,47 @@ func (a *Ctl) AddVenue(res http.ResponseWriter, req *http.Request) {
 		vLocation := santizeString(req.FormValue("location"))
 		vDesc := santizeString(req.FormValue("desc"))
 		vCap, _ := strconv.Atoi(req.FormValue("capacity"))
-		// check if user exist with username
-		for _, v := range a.Model.VenueDB.VenueMap {
-			if v == vName {
-				http.Redirect(res, req, "/addVenue", http.StatusSeeOther)
-				return
-			}
+		vWindow, _ := strconv.Atoi(req.FormValue("window"))
+		vParts, err := model.ParseDayParts(santizeString(req.FormValue("dayparts")))
+		if err != nil {
+			a.Logging.Warning.Println("Invalid day parts ", err, " from ", req.UserAgent())
+			http.Redirect(res, req, "/addVenue", http.StatusSeeOther)
+			return
 		}
-		a.Model.AddVenue(model.Venue{
+		v := model.Venue{
 			Capacity: vCap,
 			Kind:     vKind,
 			Location: vLocation,
 			Name:     vName,
 			Desc:     vDesc,
-		})
+			DayParts: vParts,
+			Window:   vWindow,
+			Owner:    u.Username,
+		}
+		if err := parseFeatures(req, &v); err != nil {
+			a.Logging.Warning.Println("Invalid venue attributes ", err, " from ", req.UserAgent())
+			http.Redirect(res, req, "/addVenue", http.StatusSeeOther)
+			return
+		}
+		// check if user exist with username
+		err = a.Model.AddVenue(v)
+		if err != nil {
+			a.Logging.Warning.Println(err, " from ", req.UserAgent())
+			http.Redirect(res, req, "/addVenue", http.StatusSeeOther)
+			return
+		}
 		a.Logging.Info.Println("Venue added from ", req.UserAgent())
+		vID, _ := a.Model.VenueDB.GetID(v.Name)
+		if _, err := a.addUploads(req, vID); err != nil {
+			// the venue stands, its edit page says what was wrong with the files
+			a.Logging.Warning.Println("Upload to new venue ", vID, " refused, ", err, " from ", req.UserAgent())
+			venue, _ := a.Model.VenueDB.Get(vID)
+			res.WriteHeader(uploadStatus(err))
+			a.render(res, req, "editVenue.html", a.editVenueData(u, vID, venue, err))
+			return
+		}
 		http.Redirect(res, req, "/browse", http.StatusSeeOther)
 		return
 	}
-	a.Template.ExecuteTemplate(res, "addVenue.html", &d)
+	a.render(res, req, "addVenue.html", &d)
 }
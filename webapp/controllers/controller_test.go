@@ -0,0 +1,287 @@
+package controller
+
+import (
+	"fmt"
+	config "gia/config"
+	model "gia/model"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestCtl : controller over a model in memory with one venue,
+// logging nowhere
+func newTestCtl(t *testing.T) *Ctl {
+	t.Helper()
+	m, err := model.InitModel(model.NewMemStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AddVenue(model.Venue{Name: "Hall", Kind: "Hall", Location: "North", Capacity: 10}); err != nil {
+		t.Fatal(err)
+	}
+	discard := log.New(io.Discard, "", 0)
+	return &Ctl{
+		Template: template.Must(template.New("").Funcs(TemplateFuncs).ParseGlob("../templates/*.html")),
+		Model:    m,
+		Logging:  &config.Logging{Trace: discard, Info: discard, Warning: discard, Error: discard},
+		Signer:   model.NewSigner([]byte("test key")),
+	}
+}
+
+// loginAs : session cookie of a new user with username
+func loginAs(t *testing.T, a *Ctl, username string) *http.Cookie {
+	t.Helper()
+	if err := a.Model.UserDB.Add(User{Username: username}); err != nil {
+		t.Fatal(err)
+	}
+	s, err := a.Model.UserDB.StartSession(username, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &http.Cookie{Name: config.NCOOKIE, Value: s.ID}
+}
+
+func TestConfirmBookRace(t *testing.T) {
+	a := newTestCtl(t)
+	rdt, _ := a.Model.BookingDB.Venue(1)
+	slot := rdt.ReadAvailable()[len(rdt.Parts())]
+	target := "/confirmBook?venueId=1&slot=" + strconv.FormatInt(slot.Key(), 10)
+	handler := a.Auth()(http.HandlerFunc(a.ConfirmBook))
+
+	const n = 32
+	cookies := make([]*http.Cookie, n)
+	for i := range cookies {
+		cookies[i] = loginAs(t, a, fmt.Sprint("user", i))
+	}
+	codes := make([]int, n)
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			req := httptest.NewRequest(http.MethodPost, target, nil)
+			req.AddCookie(cookies[i])
+			res := httptest.NewRecorder()
+			<-start
+			handler.ServeHTTP(res, req)
+			codes[i] = res.Code
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	winner := -1
+	for i, code := range codes {
+		switch code {
+		case http.StatusSeeOther:
+			if winner >= 0 {
+				t.Fatalf("user%d and user%d both booked the slot", winner, i)
+			}
+			winner = i
+		case http.StatusConflict:
+		default:
+			t.Fatalf("user%d got status %d, want 303 or 409", i, code)
+		}
+	}
+	if winner < 0 {
+		t.Fatal("nobody booked the slot")
+	}
+	for i := 0; i < n; i++ {
+		u, _ := a.user(fmt.Sprint("user", i))
+		want := 0
+		if i == winner {
+			want = 1
+		}
+		if len(u.Bookings) != want {
+			t.Fatalf("user%d has %d bookings, want %d", i, len(u.Bookings), want)
+		}
+	}
+}
+
+func TestBookingStatus(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{model.ErrVenueNotFound, http.StatusNotFound},
+		{model.ErrSlotTaken, http.StatusConflict},
+		{model.ErrOverlap, http.StatusConflict},
+		{fmt.Errorf("venue 1: %w", model.ErrSlotTaken), http.StatusConflict},
+		{model.ErrSlotUnavailable, http.StatusBadRequest},
+		{model.ErrSlotInPast, http.StatusBadRequest},
+		{model.ErrOutsideWindow, http.StatusBadRequest},
+		{model.ErrInvalidRange, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if got := bookingStatus(tt.err); got != tt.want {
+			t.Errorf("bookingStatus(%v) = %d, want %d", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestConfirmBookShowsReason(t *testing.T) {
+	a := newTestCtl(t)
+	cookie := loginAs(t, a, "alice")
+	rdt, _ := a.Model.BookingDB.Venue(1)
+	slots := rdt.ReadAvailable()
+	taken := slots[len(rdt.Parts())]
+	if _, err := a.Model.BookingDB.Reserve(1, taken, "bob"); err != nil {
+		t.Fatal(err)
+	}
+	free := slots[len(rdt.Parts())+1]
+	key := func(s model.Slot) string { return strconv.FormatInt(s.Key(), 10) }
+	tests := []struct {
+		query string
+		want  int
+		shown error
+	}{
+		{"venueId=1&slot=" + key(free), http.StatusOK, nil},
+		{"venueId=2&slot=" + key(free), http.StatusNotFound, model.ErrVenueNotFound},
+		{"venueId=1&slot=" + key(taken), http.StatusConflict, model.ErrSlotTaken},
+		{"venueId=1&slot=12", http.StatusBadRequest, model.ErrSlotUnavailable},
+		{"venueId=1&from=tomorrow&to=later", http.StatusBadRequest, model.ErrInvalidRange},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/confirmBook?"+tt.query, nil)
+		req.AddCookie(cookie)
+		res := httptest.NewRecorder()
+		a.Auth()(http.HandlerFunc(a.ConfirmBook)).ServeHTTP(res, req)
+		if res.Code != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.query, res.Code, tt.want)
+		}
+		if tt.shown != nil && !strings.Contains(res.Body.String(), tt.shown.Error()) {
+			t.Errorf("%s: page does not say %q", tt.query, tt.shown)
+		}
+	}
+}
+
+func TestEditProfileSanitized(t *testing.T) {
+	a := newTestCtl(t)
+	cookie := loginAs(t, a, "ann")
+	form := url.Values{"firstname": {`<script>alert(1)</script>Ann`}, "lastname": {`<img src=x onerror=alert(1)>Lee`}}
+	req := httptest.NewRequest(http.MethodPost, "/editProfile", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(cookie)
+	res := httptest.NewRecorder()
+	a.Auth()(http.HandlerFunc(a.EditProfile)).ServeHTTP(res, req)
+	if res.Code != http.StatusSeeOther {
+		t.Fatalf("profile edit gave status %d, want 303", res.Code)
+	}
+	u, _ := a.Model.UserDB.Get("ann")
+	if u.First != "Ann" || strings.Contains(u.Last, "onerror") {
+		t.Fatalf("names saved as %q %q, want them without scripts", u.First, u.Last)
+	}
+}
+
+func TestLogoutAllRevokesTokens(t *testing.T) {
+	a := newTestCtl(t)
+	cookie := loginAs(t, a, "ann")
+	pair, err := a.Model.UserDB.IssueTokens("ann", time.Hour, 2*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/logoutAll", nil)
+	req.AddCookie(cookie)
+	res := httptest.NewRecorder()
+	a.Auth()(http.HandlerFunc(a.LogoutAll)).ServeHTTP(res, req)
+	if res.Code != http.StatusSeeOther {
+		t.Fatalf("logout gave status %d, want 303", res.Code)
+	}
+	if _, err := a.Model.UserDB.Authenticate(pair.Access); err == nil {
+		t.Fatal("access token still works after logging out everywhere")
+	}
+}
+
+func TestClearNotices(t *testing.T) {
+	tests := []struct {
+		name    string
+		notices []string // when they are cleared
+		shown   int
+		want    []string
+	}{
+		{"all shown", []string{"a", "b"}, 2, nil},
+		{"one added since", []string{"a", "b", "c"}, 2, []string{"c"}},
+		{"cleared by another page meanwhile", []string{"c"}, 2, nil},
+	}
+	for _, tt := range tests {
+		a := newTestCtl(t)
+		if err := a.Model.UserDB.Add(User{Username: "ann", Notices: tt.notices}); err != nil {
+			t.Fatal(err)
+		}
+		a.clearNotices("ann", tt.shown)
+		u, _ := a.user("ann")
+		if fmt.Sprint(u.Notices) != fmt.Sprint(tt.want) {
+			t.Errorf("%s: notices left %q, want %q", tt.name, u.Notices, tt.want)
+		}
+	}
+}
+
+func TestViewBookShowsNoticesOnce(t *testing.T) {
+	a := newTestCtl(t)
+	cookie := loginAs(t, a, "ann")
+	a.updateUser("ann", func(u *User) { u.Notices = []string{"Booking 7 confirmed"} })
+	handler := a.Auth()(http.HandlerFunc(a.ViewBook))
+	for _, want := range []bool{true, false} {
+		req := httptest.NewRequest(http.MethodGet, "/viewBook", nil)
+		req.AddCookie(cookie)
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+		if shown := strings.Contains(res.Body.String(), "Booking 7 confirmed"); shown != want {
+			t.Fatalf("notice shown %t, want %t", shown, want)
+		}
+	}
+}
+
+func TestDeleteVenueTellsWaiters(t *testing.T) {
+	a := newTestCtl(t)
+	a.Channels = []string{"email"}
+	rdt, _ := a.Model.BookingDB.Venue(1)
+	slot := rdt.ReadAvailable()[len(rdt.Parts())]
+	loginAs(t, a, "ann")
+	loginAs(t, a, "bob")
+	if _, err := a.Model.BookingDB.Reserve(1, slot, "ann"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Model.BookingDB.Waitlist(1, slot, "bob", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Model.UserDB.Add(User{Username: "admin", Role: model.RoleAdmin}); err != nil {
+		t.Fatal(err)
+	}
+	s, err := a.Model.UserDB.StartSession("admin", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	form := url.Values{"cancel": {"on"}}
+	req := httptest.NewRequest(http.MethodPost, "/deleteVenue?venueId=1", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(&http.Cookie{Name: config.NCOOKIE, Value: s.ID})
+	res := httptest.NewRecorder()
+	a.Auth()(http.HandlerFunc(a.DeleteVenue)).ServeHTTP(res, req)
+	if res.Code != http.StatusSeeOther {
+		t.Fatalf("deleting the venue gave status %d, want 303", res.Code)
+	}
+	due, err := a.Model.NotifyDB.Due(slot.End)
+	if err != nil {
+		t.Fatal(err)
+	}
+	told := false
+	for _, n := range due {
+		if n.User == "bob" && n.Kind == model.NotifyCancelled {
+			told = true
+		}
+	}
+	if !told {
+		t.Fatal("waiting user not told the venue is gone")
+	}
+}
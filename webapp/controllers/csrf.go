@@ -0,0 +1,54 @@
+package controller
+
+import (
+	config "gia/config"
+	"html/template"
+	"net/http"
+	"strings"
+)
+
+//TemplateFuncs : functions templates can call, added when they are parsed
+var TemplateFuncs = template.FuncMap{
+	"csrfField": csrfField,
+}
+
+// csrfField : hidden form field sending token back, forms use it as
+// {{csrfField $.CSRF}}
+func csrfField(token string) template.HTML {
+	return template.HTML(`<input type="hidden" name="` + config.CSRFField +
+		`" value="` + template.HTMLEscapeString(token) + `">`)
+}
+
+//Page : embedded in the data of every page, render sets CSRF to the
+//csrf token of the request
+type Page struct {
+	CSRF string
+}
+
+func (p *Page) setCSRF(token string) {
+	p.CSRF = token
+}
+
+// page : data of a page, a pointer to a struct embedding Page
+type page interface {
+	setCSRF(token string)
+}
+
+//CSRFExempt : true for requests that do not rely on the browser's cookies,
+//so another site cannot make them for the user. Bearer tokens are only ever
+//sent on purpose, and the api auth routes take their credentials in the body
+func CSRFExempt(req *http.Request) bool {
+	if _, sent := req.Header["Authorization"]; sent {
+		return true
+	}
+	return strings.HasPrefix(req.URL.Path, APIPrefix+"auth/")
+}
+
+// render : execute template name with data for req, with req's csrf
+// token for its forms
+func (a *Ctl) render(res http.ResponseWriter, req *http.Request, name string, data page) {
+	data.setCSRF(config.CSRFToken(req))
+	if err := a.Template.ExecuteTemplate(res, name, data); err != nil {
+		a.Logging.Error.Println("Rendering ", name, ", ", err)
+	}
+}
@@ -0,0 +1,43 @@
+package controller
+
+import (
+	config "gia/config"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestFormsCarryCSRFToken(t *testing.T) {
+	a := newTestCtl(t)
+	cookie := loginAs(t, a, "ann")
+	// pages only show a user's forms once they have a name
+	a.updateUser("ann", func(u *User) { u.First = "Ann" })
+	const token = "page-token"
+	tests := []struct {
+		name    string
+		target  string
+		handler http.HandlerFunc
+		login   bool
+	}{
+		{"login form", "/login", a.Login, false},
+		{"signup form", "/signup", a.Signup, false},
+		{"sign out in the menu", "/", a.Index, true},
+		{"edit profile form", "/editProfile", a.EditProfile, true},
+		{"browse form", "/browse", a.Browse, true},
+	}
+	want := `name="` + config.CSRFField + `" value="` + token + `"`
+	for _, tt := range tests {
+		handler := config.CSRF(CSRFExempt)(a.Auth()(tt.handler))
+		req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+		req.AddCookie(&http.Cookie{Name: config.NCSRF, Value: token})
+		if tt.login {
+			req.AddCookie(cookie)
+		}
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+		if res.Code != http.StatusOK || !strings.Contains(res.Body.String(), want) {
+			t.Errorf("%s: status %d, body without %s", tt.name, res.Code, want)
+		}
+	}
+}
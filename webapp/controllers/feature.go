@@ -0,0 +1,150 @@
+package controller
+
+import (
+	"errors"
+	model "gia/model"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var errAttribute = errors.New("Attributes must be numbers of 0 or more")
+
+// option : checkbox of an amenity or tag
+type option struct {
+	Key     string
+	Label   string
+	Checked bool
+}
+
+// attrField : input of a numeric attribute of a venue
+type attrField struct {
+	Key   string
+	Label string
+	Unit  string
+	Value string
+}
+
+// venueFeatures : amenity, tag and attribute inputs of the venue forms
+type venueFeatures struct {
+	Amenities []option
+	Tags      string // comma separated
+	Attrs     []attrField
+}
+
+// featureFields : inputs of the features of v, every known amenity and
+// attribute is listed so new ones show up in the forms without changes
+func featureFields(v model.Venue) venueFeatures {
+	f := venueFeatures{Tags: strings.Join(v.Tags, ", ")}
+	for _, a := range model.Amenities {
+		f.Amenities = append(f.Amenities, option{Key: a.Key, Label: a.Label, Checked: hasString(v.Amenities, a.Key)})
+	}
+	for _, a := range model.Attributes {
+		field := attrField{Key: a.Key, Label: a.Label, Unit: a.Unit}
+		if n, ok := v.Attrs[a.Key]; ok {
+			field.Value = strconv.FormatFloat(n, 'f', -1, 64)
+		}
+		f.Attrs = append(f.Attrs, field)
+	}
+	return f
+}
+
+// parseFeatures : set the amenities, tags and attributes of v from the
+// venue form of req. Attributes left empty are not set
+func parseFeatures(req *http.Request, v *model.Venue) error {
+	req.ParseForm()
+	v.Amenities = req.Form["amenity"]
+	v.Tags = model.ParseTags(santizeString(req.FormValue("tags")))
+	v.Attrs = make(map[string]float64)
+	for _, a := range model.Attributes {
+		s := strings.TrimSpace(req.FormValue("attr_" + a.Key))
+		if s == "" {
+			continue
+		}
+		n, err := strconv.ParseFloat(s, 64)
+		if err != nil || n < 0 {
+			return errAttribute
+		}
+		v.Attrs[a.Key] = n
+	}
+	return nil
+}
+
+// attrFilter : min and max inputs of an attribute on the browse page
+type attrFilter struct {
+	Key   string
+	Label string
+	Unit  string
+	Min   string
+	Max   string
+	Lo    string // smallest value among venues, as a hint
+	Hi    string
+}
+
+// browseFeatures : amenity, tag and attribute filters of the browse page,
+// with what was chosen in req
+type browseFeatures struct {
+	Amenities []option
+	Tags      []option
+	AnyOf     bool
+	Attrs     []attrFilter
+}
+
+// featureQuery : filters chosen on the browse page in req, added to q.
+// Bounds that are not numbers are left open
+func (a *Ctl) featureQuery(req *http.Request, q *model.Query) browseFeatures {
+	req.ParseForm()
+	q.Amenities = req.Form["amenity"]
+	q.Tags = req.Form["tag"]
+	q.AnyOf = req.FormValue("match") == "any"
+	f := browseFeatures{AnyOf: q.AnyOf}
+	for _, am := range model.Amenities {
+		f.Amenities = append(f.Amenities, option{Key: am.Key, Label: am.Label, Checked: hasString(q.Amenities, am.Key)})
+	}
+	for _, t := range a.Model.VenueDB.TagList() {
+		f.Tags = append(f.Tags, option{Key: t, Label: t, Checked: hasString(q.Tags, t)})
+	}
+	for _, at := range model.Attributes {
+		filter := attrFilter{
+			Key:   at.Key,
+			Label: at.Label,
+			Unit:  at.Unit,
+			Min:   strings.TrimSpace(req.FormValue("min_" + at.Key)),
+			Max:   strings.TrimSpace(req.FormValue("max_" + at.Key)),
+		}
+		if r, ok := a.Model.VenueDB.AttrRange(at.Key); ok {
+			filter.Lo = strconv.FormatFloat(r.Min, 'f', -1, 64)
+			filter.Hi = strconv.FormatFloat(r.Max, 'f', -1, 64)
+		}
+		lo, hasLo := bound(filter.Min, math.Inf(-1))
+		hi, hasHi := bound(filter.Max, math.Inf(1))
+		if hasLo || hasHi {
+			if q.Attrs == nil {
+				q.Attrs = make(map[string]model.Range)
+			}
+			q.Attrs[at.Key] = model.Range{Min: lo, Max: hi}
+		}
+		f.Attrs = append(f.Attrs, filter)
+	}
+	return f
+}
+
+// bound : s as a number, or open if it is empty or not a number
+func bound(s string, open float64) (float64, bool) {
+	n, err := strconv.ParseFloat(s, 64)
+	if s == "" || err != nil {
+		return open, false
+	}
+	return n, true
+}
+
+// hasString : true if s is in list
+func hasString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,150 @@
+package controller
+
+import (
+	"fmt"
+	config "gia/config"
+	ical "gia/ical"
+	model "gia/model"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// uidDomain : right hand side of event uids, so they are unique to this site
+func uidDomain() string {
+	if u, err := url.Parse(config.SITE); err == nil && u.Hostname() != "" {
+		return u.Hostname()
+	}
+	return "localhost"
+}
+
+// bookingEvent : event of booking b for its user
+func (a *Ctl) bookingEvent(b model.Booking) ical.Event {
+	venue, _ := a.Model.VenueDB.Get(b.VenueID)
+	return ical.Event{
+		UID:         fmt.Sprintf("booking-%d@%s", b.IDBook, uidDomain()),
+		Start:       b.Slot.Start,
+		End:         b.Slot.End,
+		Summary:     venue.Name,
+		Location:    strings.TrimSuffix(venue.Name+", "+venue.Location, ", "),
+		Description: fmt.Sprintf("Booking %d, %s", b.IDBook, b.Slot.Time()),
+		URL:         config.SITE + "/viewBook",
+	}
+}
+
+// reservedEvent : event of booking b on its venue's calendar, which does
+// not say who made it
+func (a *Ctl) reservedEvent(b model.Booking) ical.Event {
+	venue, _ := a.Model.VenueDB.Get(b.VenueID)
+	return ical.Event{
+		UID:      fmt.Sprintf("reserved-%d@%s", b.IDBook, uidDomain()),
+		Start:    b.Slot.Start,
+		End:      b.Slot.End,
+		Summary:  "Reserved",
+		Location: strings.TrimSuffix(venue.Name+", "+venue.Location, ", "),
+	}
+}
+
+// writeCalendar : c as an .ics file named filename, to save if attach
+// is true rather than be read by a calendar app
+func (a *Ctl) writeCalendar(res http.ResponseWriter, req *http.Request, c ical.Calendar, filename string, attach bool) {
+	c.Location = model.Location
+	disposition := "inline"
+	if attach {
+		disposition = "attachment"
+	}
+	res.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	res.Header().Set("Content-Disposition", disposition+`; filename="`+filename+`"`)
+	res.Header().Set("Cache-Control", "private, no-store")
+	if err := c.Encode(res); err != nil {
+		a.Logging.Error.Println("Writing calendar ", filename, ", ", err, " from ", req.UserAgent())
+	}
+}
+
+// feedURL : address of the calendar feed of u, for calendar apps to subscribe to
+func (a *Ctl) feedURL(u User) string {
+	token, err := a.Signer.FeedLink(u)
+	if err != nil {
+		a.Logging.Error.Println("Signing feed link of ", u.Username, ", ", err)
+		return ""
+	}
+	return config.SITE + "/ical/feed?token=" + url.QueryEscape(token)
+}
+
+// BookingICS : one booking as an .ics file to add to a calendar
+func (a *Ctl) BookingICS(res http.ResponseWriter, req *http.Request) {
+	u := a.getUser(res, req)
+	if !a.alreadyLoggedIn(req) {
+		http.Redirect(res, req, "/login", http.StatusSeeOther)
+		return
+	}
+	bID, err := strconv.Atoi(req.URL.Query().Get("bID"))
+	b, exists := a.Model.BookingDB.Get(bID)
+	if err != nil || !exists || !a.canCancel(u, b) {
+		http.NotFound(res, req)
+		return
+	}
+	a.writeCalendar(res, req, ical.Calendar{
+		Events: []ical.Event{a.bookingEvent(*b)},
+	}, fmt.Sprintf("booking-%d.ics", bID), true)
+}
+
+// Feed : calendar of every booking of the user a feed link was made for.
+// Calendar apps cannot log in, so the link is the only credential.
+// Cancelled bookings drop out of it and apps remove them on their next fetch
+func (a *Ctl) Feed(res http.ResponseWriter, req *http.Request) {
+	u, err := a.Model.UserDB.FeedUser(a.Signer, req.URL.Query().Get("token"))
+	if err != nil {
+		a.Logging.Warning.Println("Calendar feed refused, ", err, " from ", req.UserAgent())
+		http.NotFound(res, req)
+		return
+	}
+	c := ical.Calendar{
+		Name:    "Venue bookings of " + u.Username,
+		Refresh: config.ICalRefresh,
+	}
+	for _, id := range u.Bookings {
+		if b, exists := a.Model.BookingDB.Get(id); exists {
+			c.Events = append(c.Events, a.bookingEvent(*b))
+		}
+	}
+	a.writeCalendar(res, req, c, "bookings.ics", false)
+}
+
+// VenueFeed : calendar of when a venue is reserved, open to everyone
+// like the booking page, without who reserved it
+func (a *Ctl) VenueFeed(res http.ResponseWriter, req *http.Request) {
+	vID, err := strconv.Atoi(req.URL.Query().Get("venueId"))
+	venue, exists := a.Model.VenueDB.Get(vID)
+	if err != nil || !exists {
+		http.NotFound(res, req)
+		return
+	}
+	c := ical.Calendar{
+		Name:    venue.Name + " reservations",
+		Refresh: config.ICalRefresh,
+	}
+	for _, b := range a.Model.BookingDB.VenueBookings(vID) {
+		c.Events = append(c.Events, a.reservedEvent(b))
+	}
+	a.writeCalendar(res, req, c, fmt.Sprintf("venue-%d.ics", vID), false)
+}
+
+// ResetFeed : give the user a new feed link, the old one stops working
+func (a *Ctl) ResetFeed(res http.ResponseWriter, req *http.Request) {
+	u := a.getUser(res, req)
+	if !a.alreadyLoggedIn(req) {
+		http.Redirect(res, req, "/login", http.StatusSeeOther)
+		return
+	}
+	if req.Method == http.MethodPost {
+		if _, err := a.Model.UserDB.ResetFeed(u.Username); err != nil {
+			a.Logging.Error.Println("Resetting feed of ", u.Username, ", ", err, " from ", req.UserAgent())
+			http.Error(res, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		a.Logging.Info.Println("Calendar feed link reset from ", req.UserAgent())
+	}
+	http.Redirect(res, req, "/viewBook", http.StatusSeeOther)
+}
@@ -0,0 +1,74 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestFeeds(t *testing.T) {
+	a := newTestCtl(t)
+	cookie := loginAs(t, a, "ann")
+	rdt, _ := a.Model.BookingDB.Venue(1)
+	id, err := a.Model.BookingDB.Reserve(1, rdt.ReadAvailable()[len(rdt.Parts())], "ann")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.updateUser("ann", func(u *User) { u.Bookings = append(u.Bookings, id) })
+	other, err := a.Model.BookingDB.Reserve(1, rdt.ReadAvailable()[len(rdt.Parts())+1], "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := a.user("ann")
+	old := a.feedURL(u)
+	u, err = a.Model.UserDB.ResetFeed("ann")
+	if err != nil {
+		t.Fatal(err)
+	}
+	current := a.feedURL(u)
+	booking := func(id int) string {
+		return "/ical/booking?bID=" + strconv.Itoa(id)
+	}
+	query := func(link string) string {
+		parsed, err := url.Parse(link)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed.RawQuery
+	}
+	tests := []struct {
+		name    string
+		target  string
+		handler http.HandlerFunc
+		status  int
+		has     string
+		hasNot  string
+	}{
+		{"feed", "/ical/feed?" + query(current), a.Feed, http.StatusOK, "UID:booking-" + strconv.Itoa(id) + "@", ""},
+		{"feed link made before a reset", "/ical/feed?" + query(old), a.Feed, http.StatusNotFound, "", ""},
+		{"no token", "/ical/feed", a.Feed, http.StatusNotFound, "", ""},
+		{"venue feed hides who booked", "/ical/venue?venueId=1", a.VenueFeed, http.StatusOK, "SUMMARY:Reserved", "ann"},
+		{"no such venue", "/ical/venue?venueId=9", a.VenueFeed, http.StatusNotFound, "", ""},
+		{"booking download", booking(id), a.BookingICS, http.StatusOK, "DTSTART;TZID=", ""},
+		{"someone else's booking", booking(other), a.BookingICS, http.StatusNotFound, "", ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+		req.AddCookie(cookie)
+		res := httptest.NewRecorder()
+		a.Auth()(tt.handler).ServeHTTP(res, req)
+		body := res.Body.String()
+		if res.Code != tt.status {
+			t.Errorf("%s: status %d, want %d", tt.name, res.Code, tt.status)
+		}
+		if tt.has != "" && !strings.Contains(body, tt.has) {
+			t.Errorf("%s: calendar without %q", tt.name, tt.has)
+		}
+		if tt.hasNot != "" && strings.Contains(body, tt.hasNot) {
+			t.Errorf("%s: calendar shows %q", tt.name, tt.hasNot)
+		}
+	}
+}
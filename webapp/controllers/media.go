@@ -0,0 +1,234 @@
+package controller
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	config "gia/config"
+	model "gia/model"
+	thumb "gia/thumb"
+	"image"
+	_ "image/gif" // decoders of the photo types that can be uploaded
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+var (
+	errNoUpload    = errors.New("Choose a photo or floor plan to upload")
+	errUploadType  = errors.New("Only JPEG, PNG and GIF photos and PDF floor plans can be uploaded")
+	errUploadSize  = fmt.Errorf("Files can be at most %d MB", config.UploadMaxBytes>>20)
+	errUploadImage = fmt.Errorf("Photos must be readable images of at most %d megapixels", config.MaxImagePixels/1000000)
+	errTooMany     = fmt.Errorf("A venue can have at most %d photos and floor plans", config.MediaPerVenue)
+)
+
+// uploadTypes : extension blobs of each type that can be uploaded are
+// saved with. The type is sniffed from the content, not taken on trust
+var uploadTypes = map[string]string{
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"image/gif":       ".gif",
+	"application/pdf": ".pdf",
+}
+
+// blobKey : new key of a file of venue vID, random so it cannot be guessed
+// and never collides with another
+func blobKey(vID int) (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("venue%d-%s", vID, hex.EncodeToString(b)), nil
+}
+
+// storeMedia : validate the upload fh and save it, with a thumbnail for
+// photos, as a new Media of venue vID. Nothing is saved if it is refused
+func (a *Ctl) storeMedia(vID int, fh *multipart.FileHeader) (model.Media, error) {
+	if fh.Size > config.UploadMaxBytes {
+		return model.Media{}, errUploadSize
+	}
+	f, err := fh.Open()
+	if err != nil {
+		return model.Media{}, err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, config.UploadMaxBytes+1))
+	if err != nil {
+		return model.Media{}, err
+	}
+	if len(data) > config.UploadMaxBytes {
+		return model.Media{}, errUploadSize
+	}
+	kind := http.DetectContentType(data)
+	ext, ok := uploadTypes[kind]
+	if !ok {
+		return model.Media{}, errUploadType
+	}
+	key, err := blobKey(vID)
+	if err != nil {
+		return model.Media{}, err
+	}
+	m := model.Media{
+		Key:   key + ext,
+		Type:  kind,
+		Name:  santizeString(filepath.Base(fh.Filename)),
+		Size:  int64(len(data)),
+		Added: time.Now(),
+	}
+	if m.IsImage() {
+		// the size is read first so a small file of huge dimensions is
+		// refused before it is decoded
+		cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+		if err != nil || cfg.Width*cfg.Height > config.MaxImagePixels {
+			return model.Media{}, errUploadImage
+		}
+		img, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			return model.Media{}, errUploadImage
+		}
+		var small bytes.Buffer
+		if err := thumb.Encode(&small, thumb.Make(img, config.ThumbSize)); err != nil {
+			return model.Media{}, err
+		}
+		m.Width, m.Height = cfg.Width, cfg.Height
+		m.Thumb = key + "-thumb.jpg"
+		if err := a.Blobs.Put(m.Thumb, &small); err != nil {
+			return model.Media{}, err
+		}
+	}
+	if err := a.Blobs.Put(m.Key, bytes.NewReader(data)); err != nil {
+		a.deleteBlobs(m)
+		return model.Media{}, err
+	}
+	return m, nil
+}
+
+// deleteBlobs : remove the files of m, failures are only logged as the
+// venue no longer refers to them
+func (a *Ctl) deleteBlobs(m model.Media) {
+	for _, key := range []string{m.Key, m.Thumb} {
+		if key == "" {
+			continue
+		}
+		if err := a.Blobs.Delete(key); err != nil {
+			a.Logging.Error.Println("Deleting blob ", key, ", ", err)
+		}
+	}
+}
+
+// uploadStatus : http status for an upload error
+func uploadStatus(err error) int {
+	switch err {
+	case errUploadSize:
+		return http.StatusRequestEntityTooLarge
+	case errUploadType:
+		return http.StatusUnsupportedMediaType
+	case errNoUpload, errUploadImage, errTooMany:
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// addUploads : save the files uploaded as "media" in req to venue vID,
+// up to MediaPerVenue in all. Files before the first refused one are kept,
+// the files of a refused one are deleted
+func (a *Ctl) addUploads(req *http.Request, vID int) (int, error) {
+	var files []*multipart.FileHeader
+	if req.MultipartForm != nil {
+		files = req.MultipartForm.File["media"]
+	}
+	v, exists := a.Model.VenueDB.Get(vID)
+	if !exists {
+		return 0, model.ErrVenueNotFound
+	}
+	if len(v.Media)+len(files) > config.MediaPerVenue {
+		return 0, errTooMany
+	}
+	for i, fh := range files {
+		m, err := a.storeMedia(vID, fh)
+		if err != nil {
+			return i, err
+		}
+		if err := a.Model.AddMedia(vID, m, config.MediaPerVenue); err != nil {
+			a.deleteBlobs(m)
+			if err == model.ErrTooManyMedia {
+				return i, errTooMany
+			}
+			return i, err
+		}
+		a.Logging.Info.Println("Venue ", vID, " given ", m.Type, " ", m.Key, " from ", req.UserAgent())
+	}
+	return len(files), nil
+}
+
+// UploadMedia : add photos and floor plans to a venue from its edit page
+func (a *Ctl) UploadMedia(res http.ResponseWriter, req *http.Request) {
+	u, vID, v, ok := a.managedVenue(res, req)
+	if !ok {
+		return
+	}
+	if req.Method != http.MethodPost {
+		http.Redirect(res, req, "/editVenue?venueId="+strconv.Itoa(vID), http.StatusSeeOther)
+		return
+	}
+	n, err := a.addUploads(req, vID)
+	if err == nil && n == 0 {
+		err = errNoUpload
+	}
+	if err != nil {
+		status := uploadStatus(err)
+		if status == http.StatusInternalServerError {
+			a.Logging.Error.Println("Uploading to venue ", vID, ", ", err, " from ", req.UserAgent())
+			http.Error(res, "Internal server error", status)
+			return
+		}
+		a.Logging.Warning.Println("Upload to venue ", vID, " refused, ", err, " from ", req.UserAgent())
+		v, _ = a.Model.VenueDB.Get(vID)
+		res.WriteHeader(status)
+		a.render(res, req, "editVenue.html", a.editVenueData(u, vID, v, err))
+		return
+	}
+	http.Redirect(res, req, "/editVenue?venueId="+strconv.Itoa(vID), http.StatusSeeOther)
+}
+
+// DeleteMedia : remove a photo or floor plan of a venue
+func (a *Ctl) DeleteMedia(res http.ResponseWriter, req *http.Request) {
+	u, vID, _, ok := a.managedVenue(res, req)
+	if !ok {
+		return
+	}
+	if req.Method == http.MethodPost {
+		m, err := a.Model.RemoveMedia(vID, req.FormValue("key"))
+		if errors.Is(err, model.ErrMediaNotFound) {
+			http.NotFound(res, req)
+			return
+		}
+		if err != nil {
+			a.Logging.Error.Println("Removing media of venue ", vID, ", ", err, " from ", req.UserAgent())
+			http.Error(res, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		a.deleteBlobs(m)
+		a.Logging.Info.Println("Venue ", vID, " media ", m.Key, " deleted by ", u.Username, " from ", req.UserAgent())
+	}
+	http.Redirect(res, req, "/editVenue?venueId="+strconv.Itoa(vID), http.StatusSeeOther)
+}
+
+// Media : the uploaded files, served from the BlobStore. Keys are never
+// reused so they can be cached for good, and the sniffed type is the only
+// one browsers may assume
+func (a *Ctl) Media() http.Handler {
+	files := http.FileServer(a.Blobs)
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Set("X-Content-Type-Options", "nosniff")
+		res.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		files.ServeHTTP(res, req)
+	})
+}
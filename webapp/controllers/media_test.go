@@ -0,0 +1,104 @@
+package controller
+
+import (
+	"bytes"
+	config "gia/config"
+	model "gia/model"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// pngFile : a w by h png
+func pngFile(t *testing.T, w int, h int) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	if err := png.Encode(&b, image.NewRGBA(image.Rect(0, 0, w, h))); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func TestUploadMedia(t *testing.T) {
+	a := newTestCtl(t)
+	blobs, err := model.OpenDirStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Blobs = blobs
+	if err := a.Model.UserDB.Add(User{Username: "admin", Role: model.RoleAdmin}); err != nil {
+		t.Fatal(err)
+	}
+	s, err := a.Model.UserDB.StartSession("admin", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	type file struct {
+		name string
+		data []byte
+	}
+	tests := []struct {
+		name   string
+		files  []file
+		status int
+		added  int  // media the venue gains
+		thumb  bool // the last one added has a thumbnail
+	}{
+		{"photo", []file{{"hall.png", pngFile(t, 640, 480)}}, http.StatusSeeOther, 1, true},
+		{"floor plan", []file{{"plan.pdf", []byte("%PDF-1.4\n%%EOF\n")}}, http.StatusSeeOther, 1, false},
+		{"two at once", []file{{"a.png", pngFile(t, 10, 10)}, {"b.png", pngFile(t, 10, 10)}}, http.StatusSeeOther, 2, true},
+		{"not a photo", []file{{"notes.png", []byte("just some text")}}, http.StatusUnsupportedMediaType, 0, false},
+		{"kept until one is refused", []file{{"c.png", pngFile(t, 10, 10)}, {"d.txt", []byte("text")}}, http.StatusUnsupportedMediaType, 1, true},
+		{"nothing chosen", nil, http.StatusBadRequest, 0, false},
+	}
+	for _, tt := range tests {
+		var body bytes.Buffer
+		w := multipart.NewWriter(&body)
+		for _, f := range tt.files {
+			part, err := w.CreateFormFile("media", f.name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			part.Write(f.data)
+		}
+		w.Close()
+		req := httptest.NewRequest(http.MethodPost, "/uploadMedia?venueId=1", &body)
+		req.Header.Set("Content-Type", w.FormDataContentType())
+		req.AddCookie(&http.Cookie{Name: config.NCOOKIE, Value: s.ID})
+		// the csrf middleware parses the form in the server
+		if err := req.ParseMultipartForm(1 << 20); err != nil {
+			t.Fatal(err)
+		}
+		before, _ := a.Model.VenueDB.Get(1)
+		res := httptest.NewRecorder()
+		a.Auth()(http.HandlerFunc(a.UploadMedia)).ServeHTTP(res, req)
+		if res.Code != tt.status {
+			t.Errorf("%s: status %d, want %d", tt.name, res.Code, tt.status)
+		}
+		after, _ := a.Model.VenueDB.Get(1)
+		if n := len(after.Media) - len(before.Media); n != tt.added {
+			t.Errorf("%s: %d added, want %d", tt.name, n, tt.added)
+			continue
+		}
+		if tt.added == 0 {
+			continue
+		}
+		last := after.Media[len(after.Media)-1]
+		if (last.Thumb != "") != tt.thumb {
+			t.Errorf("%s: thumbnail %q", tt.name, last.Thumb)
+		}
+		for _, key := range []string{last.Key, last.Thumb} {
+			if key == "" {
+				continue
+			}
+			if f, err := blobs.Open(key); err != nil {
+				t.Errorf("%s: blob %s not stored, %v", tt.name, key, err)
+			} else {
+				f.Close()
+			}
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package controller
+
+import (
+	"fmt"
+	config "gia/config"
+	model "gia/model"
+	"strings"
+	"time"
+)
+
+//RetryPolicy : how notifications that failed to go out are retried
+var RetryPolicy = model.RetryPolicy{
+	Base:     config.NotifyRetryBase,
+	Max:      config.NotifyRetryMax,
+	Attempts: config.NotifyAttempts,
+}
+
+// notify : queue n on every channel, a failure only loses n on that channel
+func (a *Ctl) notify(n model.Notification) {
+	for _, channel := range a.Channels {
+		if _, err := a.Model.NotifyDB.Queue(n, channel); err != nil {
+			a.Logging.Error.Println("Queueing ", n.Kind, " of booking ", n.BookingID, " for ", n.User, " on ", channel, ", ", err)
+		}
+	}
+}
+
+// bookingNote : notification of kind about booking b of venue, saying
+// what about it and listing its details
+func (a *Ctl) bookingNote(b model.Booking, venue model.Venue, kind string, subject string, what string) model.Notification {
+	name := b.User
+	if u, ok := a.user(b.User); ok && u.First != "" {
+		name = u.First
+	}
+	var body strings.Builder
+	fmt.Fprintf(&body, "Hi %s,\n\n%s\n\n", name, what)
+	fmt.Fprintf(&body, "Booking:  %d\n", b.IDBook)
+	fmt.Fprintf(&body, "Venue:    %s, %s\n", venue.Name, venue.Location)
+	fmt.Fprintf(&body, "Date:     %s\n", b.Slot.Date())
+	fmt.Fprintf(&body, "Time:     %s\n\n", b.Slot.Time())
+	fmt.Fprintf(&body, "Your bookings are at %s/viewBook\n", config.SITE)
+	return model.Notification{
+		User:      b.User,
+		Kind:      kind,
+		BookingID: b.IDBook,
+		Subject:   subject,
+		Body:      body.String(),
+	}
+}
+
+// notifyDropped : tell the user of waitlist place w that it is gone
+// with venue, so they do not wait for the slot any longer
+func (a *Ctl) notifyDropped(w model.Waiting, venue model.Venue) {
+	name := w.User
+	if u, ok := a.user(w.User); ok && u.First != "" {
+		name = u.First
+	}
+	var body strings.Builder
+	fmt.Fprintf(&body, "Hi %s,\n\nYour waitlist place has been cancelled, as %s is no longer available.\n\n", name, venue.Name)
+	fmt.Fprintf(&body, "Venue:    %s, %s\n", venue.Name, venue.Location)
+	fmt.Fprintf(&body, "Date:     %s\n", w.Slot.Date())
+	fmt.Fprintf(&body, "Time:     %s\n\n", w.Slot.Time())
+	fmt.Fprintf(&body, "Your bookings are at %s/viewBook\n", config.SITE)
+	a.notify(model.Notification{
+		User:    w.User,
+		Kind:    model.NotifyCancelled,
+		Subject: fmt.Sprintf("Waitlist place cancelled: %s on %s %s", venue.Name, w.Slot.Date(), w.Slot.Time()),
+		Body:    body.String(),
+	})
+}
+
+// notifyBooked : confirm booking b to its user and queue its reminder.
+// waitlisted is true if b was made for them from the waitlist
+func (a *Ctl) notifyBooked(b model.Booking, waitlisted bool) {
+	venue, _ := a.Model.VenueDB.Get(b.VenueID)
+	if waitlisted {
+		a.notify(a.bookingNote(b, venue, model.NotifyConfirmed,
+			fmt.Sprintf("Your waitlist place for %s on %s %s is now confirmed as booking %d",
+				venue.Name, b.Slot.Date(), b.Slot.Time(), b.IDBook),
+			"A slot you were waiting for has been freed and is now booked for you."))
+	} else {
+		a.notify(a.bookingNote(b, venue, model.NotifyConfirmed,
+			fmt.Sprintf("Booking %d confirmed: %s on %s %s", b.IDBook, venue.Name, b.Slot.Date(), b.Slot.Time()),
+			"Your booking is confirmed."))
+	}
+	due := b.Slot.Start.Add(-config.ReminderLead)
+	if !due.After(time.Now()) {
+		// booked at short notice, the confirmation is reminder enough
+		return
+	}
+	n := a.bookingNote(b, venue, model.NotifyReminder,
+		fmt.Sprintf("Reminder: booking %d at %s on %s %s", b.IDBook, venue.Name, b.Slot.Date(), b.Slot.Time()),
+		"Your booking starts soon.")
+	n.Due = due
+	a.notify(n)
+}
+
+// notifyCancelled : tell the user of booking b of venue it is cancelled,
+// and why if why is not empty, then drop its reminders
+func (a *Ctl) notifyCancelled(b model.Booking, venue model.Venue, why string) {
+	if _, err := a.Model.NotifyDB.CancelReminders(b.IDBook); err != nil {
+		a.Logging.Error.Println("Cancelling reminders of booking ", b.IDBook, ", ", err)
+	}
+	what := "Your booking has been cancelled."
+	if why != "" {
+		what = "Your booking has been cancelled, " + why + "."
+	}
+	a.notify(a.bookingNote(b, venue, model.NotifyCancelled,
+		fmt.Sprintf("Booking %d cancelled: %s on %s %s", b.IDBook, venue.Name, b.Slot.Date(), b.Slot.Time()),
+		what))
+}
@@ -0,0 +1,40 @@
+package controller
+
+import (
+	config "gia/config"
+	model "gia/model"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+//PasswordPolicy : rules new passwords must follow
+var PasswordPolicy = model.PasswordPolicy{
+	MinLength:        config.PasswordMinLength,
+	MaxLength:        config.PasswordMaxLength,
+	RequireMixedCase: config.PasswordMixedCase,
+	RequireDigit:     config.PasswordDigit,
+	RequireSymbol:    config.PasswordSymbol,
+}
+
+//Lockout : when failed logins lock an account
+var Lockout = model.Lockout{
+	Threshold: config.LockoutThreshold,
+	Duration:  config.LockoutDuration,
+}
+
+// hashPassword : bcrypt hash of password at the configured cost
+func hashPassword(password string) ([]byte, error) {
+	return bcrypt.GenerateFromPassword([]byte(password), config.BcryptCost)
+}
+
+// matchPassword : true if hash is of password. Passwords used to be
+// sanitized before hashing, so legacy is true if only that form matched
+func matchPassword(hash []byte, password string) (matched bool, legacy bool) {
+	if bcrypt.CompareHashAndPassword(hash, []byte(password)) == nil {
+		return true, false
+	}
+	if s := santizeString(password); s != password && bcrypt.CompareHashAndPassword(hash, []byte(s)) == nil {
+		return true, true
+	}
+	return false, false
+}
@@ -0,0 +1,59 @@
+package controller
+
+import (
+	config "gia/config"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestCheckLogin(t *testing.T) {
+	a := newTestCtl(t)
+	hash, err := bcrypt.GenerateFromPassword([]byte("Secret1<script>x</script>"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// saved before passwords were kept as typed, when the script was stripped
+	legacy, err := bcrypt.GenerateFromPassword([]byte("Secret1"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Model.UserDB.Add(User{Username: "ann", Password: hash}); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Model.UserDB.Add(User{Username: "old", Password: legacy}); err != nil {
+		t.Fatal(err)
+	}
+	type step struct {
+		name     string
+		username string
+		password string
+		want     error
+	}
+	steps := []step{
+		{"unknown user", "nobody", "Secret1<script>x</script>", errUnknownUser},
+		{"right password", "ann", "Secret1<script>x</script>", nil},
+		{"sanitized form of a new password", "ann", "Secret1", errWrongPassword},
+		{"legacy hash", "old", "Secret1<script>x</script>", nil},
+	}
+	// with the failure above, enough in a row to lock ann out
+	for i := 1; i < Lockout.Threshold; i++ {
+		steps = append(steps, step{"wrong password", "ann", "wrong", errWrongPassword})
+	}
+	steps = append(steps, step{"right password once locked", "ann", "Secret1<script>x</script>", errLocked})
+	for _, tt := range steps {
+		if _, err := a.checkLogin(tt.username, tt.password); err != tt.want {
+			t.Errorf("%s: checkLogin gave %v, want %v", tt.name, err, tt.want)
+		}
+	}
+	// the first good login replaced both hashes with ones at the configured cost
+	for _, name := range []string{"ann", "old"} {
+		u, _ := a.user(name)
+		if cost, err := bcrypt.Cost(u.Password); err != nil || cost != config.BcryptCost {
+			t.Errorf("hash of %s has cost %d, %v, want %d", name, cost, err, config.BcryptCost)
+		}
+		if bcrypt.CompareHashAndPassword(u.Password, []byte("Secret1<script>x</script>")) != nil {
+			t.Errorf("rehash of %s is not of the password as typed", name)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package controller
+
+import (
+	model "gia/model"
+	"net/http"
+	"sort"
+)
+
+// require : logged in user of req if their role has perm. Otherwise
+// they are sent to log in, or refused with 403, and ok is false
+func (a *Ctl) require(res http.ResponseWriter, req *http.Request, perm model.Permission) (User, bool) {
+	u := a.getUser(res, req)
+	if !a.alreadyLoggedIn(req) {
+		a.Logging.Warning.Println("Unauthorised access to ", req.URL.Path, " from ", req.UserAgent())
+		http.Redirect(res, req, "/login", http.StatusSeeOther)
+		return u, false
+	}
+	if !u.Can(perm) {
+		a.Logging.Warning.Println(u.Username, " without ", perm, " refused ", req.URL.Path, " from ", req.UserAgent())
+		http.Error(res, "Forbidden", http.StatusForbidden)
+		return u, false
+	}
+	return u, true
+}
+
+// canCancel : true if u may cancel booking b, their own or one
+// at a venue they manage
+func (a *Ctl) canCancel(u User, b *model.Booking) bool {
+	if b.User == u.Username && u.Can(model.PermBook) {
+		return true
+	}
+	v, exists := a.Model.VenueDB.Get(b.VenueID)
+	return exists && u.CanManage(v)
+}
+
+// ManageVenues : venues the user manages with their bookings
+func (a *Ctl) ManageVenues(res http.ResponseWriter, req *http.Request) {
+	u, ok := a.require(res, req, model.PermManageVenues)
+	if !ok {
+		return
+	}
+	type managed struct {
+		ID       int
+		Venue    model.Venue
+		Bookings []Booking
+	}
+	type pageData struct {
+		Page
+		User   User
+		Venues []managed
+	}
+	d := pageData{
+		User: u,
+	}
+	mapping := a.Model.VenueDB.Names()
+	venues := a.Model.VenueDB.All()
+	order := make([]int, 0, len(venues))
+	for id, v := range venues {
+		if u.CanManage(v) {
+			order = append(order, id)
+		}
+	}
+	sort.Ints(order)
+	for _, id := range order {
+		m := managed{ID: id, Venue: venues[id]}
+		for _, b := range a.Model.BookingDB.VenueBookings(id) {
+			m.Bookings = append(m.Bookings, convertBooking(b, mapping))
+		}
+		d.Venues = append(d.Venues, m)
+	}
+	a.render(res, req, "manageVenues.html", &d)
+}
+
+// Roles : admin page to assign roles to users
+func (a *Ctl) Roles(res http.ResponseWriter, req *http.Request) {
+	u, ok := a.require(res, req, model.PermAssignRoles)
+	if !ok {
+		return
+	}
+	if req.Method == http.MethodPost {
+		username := req.FormValue("username")
+		role, err := model.ParseRole(req.FormValue("role"))
+		if err != nil {
+			http.Error(res, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// keep at least the admin making the change
+		if username == u.Username && role != model.RoleAdmin {
+			http.Error(res, "Admins cannot remove their own admin role", http.StatusBadRequest)
+			return
+		}
+		if err := a.Model.UserDB.SetRole(username, role); err != nil {
+			a.Logging.Warning.Println("Setting role of ", username, ", ", err, " from ", req.UserAgent())
+			http.Error(res, err.Error(), http.StatusBadRequest)
+			return
+		}
+		a.Logging.Info.Println("Role of ", username, " set to ", role, " from ", req.UserAgent())
+		http.Redirect(res, req, "/admin/roles", http.StatusSeeOther)
+		return
+	}
+	users, err := a.Model.UserDB.List()
+	if err != nil {
+		a.Logging.Error.Println("Listing users, ", err, " from ", req.UserAgent())
+		http.Error(res, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	type pageData struct {
+		Page
+		User  User
+		Users []User
+		Roles []model.Role
+	}
+	d := pageData{
+		User:  u,
+		Users: users,
+		Roles: model.Roles,
+	}
+	a.render(res, req, "roles.html", &d)
+}
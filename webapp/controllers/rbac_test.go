@@ -0,0 +1,93 @@
+package controller
+
+import (
+	model "gia/model"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// loginWithRole : session cookie of a new user with username and role
+func loginWithRole(t *testing.T, a *Ctl, username string, role model.Role) *http.Cookie {
+	t.Helper()
+	cookie := loginAs(t, a, username)
+	if err := a.Model.UserDB.SetRole(username, role); err != nil {
+		t.Fatal(err)
+	}
+	return cookie
+}
+
+func TestRequire(t *testing.T) {
+	a := newTestCtl(t)
+	cookies := map[model.Role]*http.Cookie{
+		model.RoleUser:    loginWithRole(t, a, "user", model.RoleUser),
+		model.RoleManager: loginWithRole(t, a, "manager", model.RoleManager),
+		model.RoleAdmin:   loginWithRole(t, a, "admin", model.RoleAdmin),
+	}
+	tests := []struct {
+		path    string
+		handler http.HandlerFunc
+		role    model.Role // "" for nobody logged in
+		want    int
+	}{
+		{"/profile", a.Profile, "", http.StatusSeeOther},
+		{"/profile", a.Profile, model.RoleUser, http.StatusOK},
+		{"/viewBook", a.ViewBook, "", http.StatusSeeOther},
+		{"/viewBook", a.ViewBook, model.RoleUser, http.StatusOK},
+		{"/manageVenues", a.ManageVenues, model.RoleUser, http.StatusForbidden},
+		{"/manageVenues", a.ManageVenues, model.RoleManager, http.StatusOK},
+		{"/addVenue", a.AddVenue, model.RoleUser, http.StatusForbidden},
+		{"/addVenue", a.AddVenue, model.RoleManager, http.StatusOK},
+		{"/admin/roles", a.Roles, model.RoleManager, http.StatusForbidden},
+		{"/admin/roles", a.Roles, model.RoleAdmin, http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		if tt.role != "" {
+			req.AddCookie(cookies[tt.role])
+		}
+		res := httptest.NewRecorder()
+		a.Auth()(tt.handler).ServeHTTP(res, req)
+		if res.Code != tt.want {
+			t.Errorf("%s as %q gave %d, want %d", tt.path, tt.role, res.Code, tt.want)
+		}
+		if tt.role == "" && res.Header().Get("Location") != "/login" {
+			t.Errorf("%s logged out sent to %q, want /login", tt.path, res.Header().Get("Location"))
+		}
+	}
+}
+
+func TestRoles(t *testing.T) {
+	a := newTestCtl(t)
+	admin := loginWithRole(t, a, "admin", model.RoleAdmin)
+	loginAs(t, a, "ann")
+	tests := []struct {
+		username string
+		role     string
+		want     int
+	}{
+		{"ann", string(model.RoleManager), http.StatusSeeOther},
+		{"ann", "owner", http.StatusBadRequest},
+		{"nobody", string(model.RoleManager), http.StatusBadRequest},
+		{"admin", string(model.RoleUser), http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		form := url.Values{"username": {tt.username}, "role": {tt.role}}
+		req := httptest.NewRequest(http.MethodPost, "/admin/roles", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.AddCookie(admin)
+		res := httptest.NewRecorder()
+		a.Auth()(http.HandlerFunc(a.Roles)).ServeHTTP(res, req)
+		if res.Code != tt.want {
+			t.Errorf("%s to %q gave %d, want %d", tt.username, tt.role, res.Code, tt.want)
+		}
+	}
+	if u, _ := a.user("ann"); u.GetRole() != model.RoleManager {
+		t.Errorf("ann is %s, want %s", u.GetRole(), model.RoleManager)
+	}
+	if u, _ := a.user("admin"); u.GetRole() != model.RoleAdmin {
+		t.Errorf("admin is %s, want still %s", u.GetRole(), model.RoleAdmin)
+	}
+}
@@ -0,0 +1,98 @@
+package controller
+
+import (
+	config "gia/config"
+	model "gia/model"
+	"net/http"
+	"time"
+)
+
+//SessionPolicy : how long browser logins last
+var SessionPolicy = model.SessionPolicy{
+	MaxAge: config.SessionMaxAge,
+	Idle:   config.SessionIdle,
+}
+
+// sessionCookie : cookie holding session id value until expires.
+// Scripts cannot read it and other sites' forms do not send it
+func sessionCookie(value string, expires time.Time) *http.Cookie {
+	return &http.Cookie{
+		Name:     config.NCOOKIE,
+		Value:    value,
+		Path:     "/",
+		Expires:  expires,
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// clearCookie : tell the browser to drop the session cookie
+func clearCookie(res http.ResponseWriter) {
+	c := sessionCookie("", time.Unix(0, 0))
+	c.MaxAge = -1
+	http.SetCookie(res, c)
+}
+
+// sessionUser : username logged in with session id, if it has not expired
+func (a *Ctl) sessionUser(id string) (string, bool) {
+	s, err := a.Model.UserDB.Session(id, SessionPolicy)
+	if err != nil && err != model.ErrSessionNotFound {
+		a.Logging.Error.Println("Reading session, ", err)
+	}
+	return s.Username, err == nil
+}
+
+// startSession : log username in with a new session id, replacing the
+// session cookie req came with. false if the session could not be saved
+func (a *Ctl) startSession(res http.ResponseWriter, req *http.Request, username string) bool {
+	var previous string
+	if myCookie, err := req.Cookie(config.NCOOKIE); err == nil {
+		previous = myCookie.Value
+	}
+	s, err := a.Model.UserDB.StartSession(username, previous)
+	if err != nil {
+		a.Logging.Error.Println("Saving session of ", username, ", ", err)
+		return false
+	}
+	http.SetCookie(res, sessionCookie(s.ID, s.Created.Add(SessionPolicy.MaxAge)))
+	return true
+}
+
+// endSession : log the session of req out
+func (a *Ctl) endSession(res http.ResponseWriter, req *http.Request) {
+	if myCookie, err := req.Cookie(config.NCOOKIE); err == nil {
+		if err := a.Model.UserDB.DeleteSession(myCookie.Value); err != nil {
+			a.Logging.Error.Println("Deleting session, ", err)
+		}
+	}
+	clearCookie(res)
+}
+
+// LogoutAll : log the user out of every browser they are logged in on
+// and revoke every api token issued to them
+func (a *Ctl) LogoutAll(res http.ResponseWriter, req *http.Request) {
+	u := a.getUser(res, req)
+	if !a.alreadyLoggedIn(req) {
+		http.Redirect(res, req, "/", http.StatusSeeOther)
+		return
+	}
+	if req.Method != http.MethodPost {
+		http.Redirect(res, req, "/profile", http.StatusSeeOther)
+		return
+	}
+	n, err := a.Model.UserDB.DeleteSessions(u.Username)
+	if err != nil {
+		a.Logging.Error.Println("Deleting sessions of ", u.Username, ", ", err, " from ", req.UserAgent())
+		http.Error(res, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if _, err := a.Model.UserDB.RevokeTokens(u.Username); err != nil {
+		a.Logging.Error.Println("Revoking tokens of ", u.Username, ", ", err, " from ", req.UserAgent())
+		http.Error(res, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	clearCookie(res)
+	a.Logging.Info.Println("User logout from ", n, " sessions from ", req.UserAgent())
+	http.Redirect(res, req, "/", http.StatusSeeOther)
+}
@@ -0,0 +1,200 @@
+package controller
+
+import (
+	"errors"
+	model "gia/model"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var errVenueForm = errors.New("A venue needs a name and a capacity of at least 1")
+
+// managedVenue : venue of the venueId query, if the user of req manages it.
+// Otherwise they are sent to log in or refused, and ok is false
+func (a *Ctl) managedVenue(res http.ResponseWriter, req *http.Request) (User, int, model.Venue, bool) {
+	u, ok := a.require(res, req, model.PermManageVenues)
+	if !ok {
+		return u, 0, model.Venue{}, false
+	}
+	vID, err := strconv.Atoi(req.URL.Query().Get("venueId"))
+	v, exists := a.Model.VenueDB.Get(vID)
+	if err != nil || !exists {
+		http.NotFound(res, req)
+		return u, 0, model.Venue{}, false
+	}
+	if !u.CanManage(v) {
+		a.Logging.Warning.Println(u.Username, " refused venue ", vID, " they do not manage from ", req.UserAgent())
+		http.Error(res, "Forbidden", http.StatusForbidden)
+		return u, 0, model.Venue{}, false
+	}
+	return u, vID, v, true
+}
+
+// editVenuePage : data of editVenue.html
+type editVenuePage struct {
+	Page
+	User     User
+	Vid      int
+	Venue    model.Venue
+	Features venueFeatures
+	Error    string
+}
+
+// editVenueData : edit page of venue vID, showing err if it is not nil
+func (a *Ctl) editVenueData(u User, vID int, v model.Venue, err error) *editVenuePage {
+	d := &editVenuePage{
+		User:     u,
+		Vid:      vID,
+		Venue:    v,
+		Features: featureFields(v),
+	}
+	if err != nil {
+		d.Error = err.Error()
+	}
+	return d
+}
+
+// EditVenue : change the name, kind, location, capacity, description and
+// features of a venue. Day parts and the booking window stay as they were added
+func (a *Ctl) EditVenue(res http.ResponseWriter, req *http.Request) {
+	u, vID, v, ok := a.managedVenue(res, req)
+	if !ok {
+		return
+	}
+	d := a.editVenueData(u, vID, v, nil)
+	if req.Method == http.MethodPost {
+		d.Venue.Name = santizeString(req.FormValue("name"))
+		d.Venue.Kind = santizeString(req.FormValue("kind"))
+		d.Venue.Location = santizeString(req.FormValue("location"))
+		d.Venue.Desc = santizeString(req.FormValue("desc"))
+		d.Venue.Capacity, _ = strconv.Atoi(req.FormValue("capacity"))
+		featuresErr := parseFeatures(req, &d.Venue)
+		fail := func(status int, err error) {
+			a.Logging.Warning.Println("Venue ", vID, " not edited, ", err, " from ", req.UserAgent())
+			d.Error = err.Error()
+			d.Features = featureFields(d.Venue)
+			res.WriteHeader(status)
+			a.render(res, req, "editVenue.html", d)
+		}
+		if d.Venue.Name == "" || d.Venue.Capacity < 1 {
+			fail(http.StatusBadRequest, errVenueForm)
+			return
+		}
+		if featuresErr != nil {
+			fail(http.StatusBadRequest, featuresErr)
+			return
+		}
+		_, err := a.Model.VenueDB.Update(vID, func(v *model.Venue) {
+			v.Name = d.Venue.Name
+			v.Kind = d.Venue.Kind
+			v.Location = d.Venue.Location
+			v.Desc = d.Venue.Desc
+			v.Capacity = d.Venue.Capacity
+			v.Amenities = d.Venue.Amenities
+			v.Tags = d.Venue.Tags
+			v.Attrs = d.Venue.Attrs
+		})
+		if errors.Is(err, model.ErrVenueExists) {
+			fail(http.StatusConflict, err)
+			return
+		}
+		if errors.Is(err, model.ErrUnknownAmenity) || errors.Is(err, model.ErrUnknownAttribute) || errors.Is(err, model.ErrInvalidAttribute) {
+			fail(http.StatusBadRequest, err)
+			return
+		}
+		if err != nil {
+			a.Logging.Error.Println("Editing venue ", vID, ", ", err, " from ", req.UserAgent())
+			http.Error(res, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		a.Logging.Info.Println("Venue ", vID, " edited by ", u.Username, " from ", req.UserAgent())
+		http.Redirect(res, req, "/manageVenues", http.StatusSeeOther)
+		return
+	}
+	a.render(res, req, "editVenue.html", d)
+}
+
+// ArchiveVenue : close a venue to new bookings and hide it from browsing,
+// or open it again. Bookings already made stand
+func (a *Ctl) ArchiveVenue(res http.ResponseWriter, req *http.Request) {
+	u, vID, _, ok := a.managedVenue(res, req)
+	if !ok {
+		return
+	}
+	if req.Method == http.MethodPost {
+		archived := req.FormValue("archived") == "true"
+		if err := a.Model.ArchiveVenue(vID, archived); err != nil {
+			a.Logging.Error.Println("Archiving venue ", vID, ", ", err, " from ", req.UserAgent())
+			http.Error(res, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		a.Logging.Info.Println("Venue ", vID, " archived ", archived, " by ", u.Username, " from ", req.UserAgent())
+	}
+	http.Redirect(res, req, "/manageVenues", http.StatusSeeOther)
+}
+
+// DeleteVenue : remove a venue and its bookings. While it has bookings
+// still to come it is refused, unless they are to be cancelled, in which
+// case their users are told, as are the users waiting for them
+func (a *Ctl) DeleteVenue(res http.ResponseWriter, req *http.Request) {
+	u, vID, v, ok := a.managedVenue(res, req)
+	if !ok {
+		return
+	}
+	type pageData struct {
+		Page
+		User     User
+		Vid      int
+		Venue    model.Venue
+		Upcoming []Booking
+		Error    string
+	}
+	d := pageData{
+		User:  u,
+		Vid:   vID,
+		Venue: v,
+	}
+	now := time.Now()
+	mapping := a.Model.VenueDB.Names()
+	for _, b := range a.Model.BookingDB.VenueBookings(vID) {
+		if b.Slot.End.After(now) {
+			d.Upcoming = append(d.Upcoming, convertBooking(b, mapping))
+		}
+	}
+	if req.Method == http.MethodPost {
+		cancel := req.FormValue("cancel") == "on"
+		removed, dropped, err := a.Model.DeleteVenue(vID, cancel)
+		// bookings removed before any error are gone all the same
+		for _, b := range removed {
+			a.updateUser(b.User, func(u *User) {
+				u.Bookings = removeInt(u.Bookings, b.IDBook)
+			})
+			if b.Slot.End.After(now) {
+				a.notifyCancelled(b, v, "as "+v.Name+" is no longer available")
+			}
+		}
+		for _, w := range dropped {
+			a.notifyDropped(w, v)
+		}
+		if errors.Is(err, model.ErrVenueHasBookings) {
+			a.Logging.Warning.Println("Venue ", vID, " not deleted, ", err, " from ", req.UserAgent())
+			d.Error = err.Error()
+			res.WriteHeader(http.StatusConflict)
+			a.render(res, req, "deleteVenue.html", &d)
+			return
+		}
+		if err != nil {
+			a.Logging.Error.Println("Deleting venue ", vID, ", ", err, " from ", req.UserAgent())
+			http.Error(res, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		for _, m := range v.Media {
+			a.deleteBlobs(m)
+		}
+		a.Logging.Info.Println("Venue ", vID, " deleted with ", len(removed), " bookings by ", u.Username, " from ", req.UserAgent())
+		http.Redirect(res, req, "/manageVenues", http.StatusSeeOther)
+		return
+	}
+	a.render(res, req, "deleteVenue.html", &d)
+}
@@ -1,12 +1,20 @@
 module gia
 
-go 1.15
+go 1.21
 
 require (
 	github.com/microcosm-cc/bluemonday v1.0.4
-	github.com/niemeyer/pretty v0.0.0-20200227124842-a10e7caefd8e // indirect
-	github.com/satori/go.uuid v1.2.0
+	go.etcd.io/bbolt v1.3.10
 	golang.org/x/crypto v0.0.0-20201016220609-9e8e0b390897
+)
+
+require (
+	github.com/aymerick/douceur v0.2.0 // indirect
+	github.com/chris-ramon/douceur v0.2.0 // indirect
+	github.com/gorilla/css v1.0.0 // indirect
+	github.com/niemeyer/pretty v0.0.0-20200227124842-a10e7caefd8e // indirect
+	golang.org/x/net v0.0.0-20201021035429-f5854403a974 // indirect
+	golang.org/x/sys v0.4.0 // indirect
 	golang.org/x/tools v0.0.0-20201105220310-78b158585360 // indirect
 	gopkg.in/check.v1 v1.0.0-20200902074654-038fdea0a05b // indirect
 )
@@ -0,0 +1,241 @@
+//Package ical : iCalendar (RFC 5545) files of events, for calendar apps
+package ical
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Event : one VEVENT. UID must stay the same for as long as the event
+// exists, calendar apps use it to update or remove their copy
+type Event struct {
+	UID         string
+	Start       time.Time
+	End         time.Time
+	Summary     string
+	Location    string
+	Description string
+	URL         string
+}
+
+// Calendar : a VCALENDAR of events, with times in Location
+type Calendar struct {
+	Name     string // shown by apps that subscribe to the calendar
+	Location *time.Location
+	Refresh  time.Duration // how often subscribers should fetch again, 0 to not say
+	Events   []Event
+}
+
+// prodID : identifies this app as the maker of calendars
+const prodID = "-//gia//Venue booking//EN"
+
+// stamp : utc date time
+const stamp = "20060102T150405Z"
+
+// local : date time in the zone given by TZID
+const local = "20060102T150405"
+
+// escape : s as a TEXT value
+func escape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`).Replace(s)
+}
+
+// writer : writes content lines, folded to 75 octets and ended by CRLF
+type writer struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (w *writer) line(name string, value string) {
+	if w.err != nil {
+		return
+	}
+	s := name + ":" + value
+	limit := 75
+	for len(s) > limit {
+		// fold on a rune boundary, the space that starts the next line
+		// is not part of the value
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		_, w.err = w.w.WriteString(s[:cut] + "\r\n ")
+		s = s[cut:]
+		limit = 74
+	}
+	_, w.err = w.w.WriteString(s + "\r\n")
+}
+
+// Encode : write c to w
+func (c Calendar) Encode(w io.Writer) error {
+	loc := c.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	out := &writer{w: bufio.NewWriter(w)}
+	out.line("BEGIN", "VCALENDAR")
+	out.line("VERSION", "2.0")
+	out.line("PRODID", prodID)
+	out.line("CALSCALE", "GREGORIAN")
+	out.line("METHOD", "PUBLISH")
+	if c.Name != "" {
+		out.line("X-WR-CALNAME", escape(c.Name))
+	}
+	if c.Refresh > 0 {
+		out.line("REFRESH-INTERVAL;VALUE=DURATION", duration(c.Refresh))
+		out.line("X-PUBLISHED-TTL", duration(c.Refresh))
+	}
+	tzid := ZoneName(loc)
+	from, to := span(c.Events)
+	timezone(out, tzid, loc, from, to)
+	now := time.Now().UTC().Format(stamp)
+	for _, e := range c.Events {
+		out.line("BEGIN", "VEVENT")
+		out.line("UID", e.UID)
+		out.line("DTSTAMP", now)
+		out.line("DTSTART;TZID="+tzid, e.Start.In(loc).Format(local))
+		out.line("DTEND;TZID="+tzid, e.End.In(loc).Format(local))
+		out.line("SUMMARY", escape(e.Summary))
+		if e.Location != "" {
+			out.line("LOCATION", escape(e.Location))
+		}
+		if e.Description != "" {
+			out.line("DESCRIPTION", escape(e.Description))
+		}
+		if e.URL != "" {
+			out.line("URL", e.URL)
+		}
+		out.line("STATUS", "CONFIRMED")
+		out.line("TRANSP", "OPAQUE")
+		out.line("END", "VEVENT")
+	}
+	out.line("END", "VCALENDAR")
+	if out.err != nil {
+		return out.err
+	}
+	return out.w.Flush()
+}
+
+// duration : d as a DURATION value, in whole minutes
+func duration(d time.Duration) string {
+	m := int(d / time.Minute)
+	if m%60 == 0 {
+		return fmt.Sprintf("PT%dH", m/60)
+	}
+	return fmt.Sprintf("PT%dM", m)
+}
+
+// span : earliest start and latest end of events, now if there are none
+func span(events []Event) (time.Time, time.Time) {
+	if len(events) == 0 {
+		now := time.Now()
+		return now, now
+	}
+	from, to := events[0].Start, events[0].End
+	for _, e := range events[1:] {
+		if e.Start.Before(from) {
+			from = e.Start
+		}
+		if e.End.After(to) {
+			to = e.End
+		}
+	}
+	return from, to
+}
+
+//ZoneName : IANA name of loc, which time.Local does not know itself.
+//It is looked for in TZ, then in where /etc/localtime links to
+func ZoneName(loc *time.Location) string {
+	if name := loc.String(); name != "Local" {
+		return name
+	}
+	if tz := strings.TrimPrefix(os.Getenv("TZ"), ":"); tz != "" && !filepath.IsAbs(tz) {
+		return tz
+	}
+	if target, err := filepath.EvalSymlinks("/etc/localtime"); err == nil {
+		if i := strings.Index(target, "zoneinfo/"); i >= 0 {
+			return target[i+len("zoneinfo/"):]
+		}
+	}
+	return "Local"
+}
+
+// transition : moment the offset of a zone changes
+type transition struct {
+	at   time.Time
+	from int // offset before, seconds east of utc
+}
+
+// transitions : when the offset of loc changes between from and to
+func transitions(loc *time.Location, from time.Time, to time.Time) []transition {
+	var found []transition
+	offset := func(t time.Time) int {
+		_, o := t.In(loc).Zone()
+		return o
+	}
+	// no zone changes offset twice within a day
+	for t := from; t.Before(to); t = t.Add(24 * time.Hour) {
+		next := t.Add(24 * time.Hour)
+		before := offset(t)
+		if offset(next) == before {
+			continue
+		}
+		lo, hi := t, next
+		for hi.Sub(lo) > time.Second {
+			mid := lo.Add(hi.Sub(lo) / 2)
+			if offset(mid) == before {
+				lo = mid
+			} else {
+				hi = mid
+			}
+		}
+		found = append(found, transition{at: hi.Truncate(time.Second), from: before})
+	}
+	return found
+}
+
+// utcOffset : offset as +hhmm
+func utcOffset(seconds int) string {
+	sign := "+"
+	if seconds < 0 {
+		sign = "-"
+		seconds = -seconds
+	}
+	return fmt.Sprintf("%s%02d%02d", sign, seconds/3600, seconds/60%60)
+}
+
+// timezone : VTIMEZONE of loc, with the offset in force at from and
+// every change until to, a year either side so apps showing nearby
+// dates get them right too
+func timezone(out *writer, tzid string, loc *time.Location, from time.Time, to time.Time) {
+	from, to = from.AddDate(-1, 0, 0).Truncate(time.Second), to.AddDate(1, 0, 0)
+	observance := func(at time.Time, offsetFrom int) {
+		t := at.In(loc)
+		name, offsetTo := t.Zone()
+		kind := "STANDARD"
+		if t.IsDST() {
+			kind = "DAYLIGHT"
+		}
+		out.line("BEGIN", kind)
+		// onset is given in the local time before it
+		out.line("DTSTART", at.In(time.FixedZone("", offsetFrom)).Format(local))
+		out.line("TZOFFSETFROM", utcOffset(offsetFrom))
+		out.line("TZOFFSETTO", utcOffset(offsetTo))
+		out.line("TZNAME", escape(name))
+		out.line("END", kind)
+	}
+	out.line("BEGIN", "VTIMEZONE")
+	out.line("TZID", tzid)
+	_, initial := from.In(loc).Zone()
+	observance(from, initial)
+	for _, tr := range transitions(loc, from, to) {
+		observance(tr.at, tr.from)
+	}
+	out.line("END", "VTIMEZONE")
+}
@@ -0,0 +1,182 @@
+package ical
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+	"time"
+	_ "time/tzdata" // zones the tests use, whatever the machine has
+)
+
+func TestEscape(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"Main Hall", "Main Hall"},
+		{"Hall, North", `Hall\, North`},
+		{"a;b", `a\;b`},
+		{`C:\venues`, `C:\\venues`},
+		{"two\nlines", `two\nlines`},
+		{"windows\r\nline", `windows\nline`},
+		{"old mac\rline", `old mac\nline`},
+		{`\,`, `\\\,`},
+	}
+	for _, tt := range tests {
+		if got := escape(tt.in); got != tt.want {
+			t.Errorf("escape(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestFold(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		lines int
+	}{
+		{"short", "Hall", 1},
+		{"exactly 75 octets", strings.Repeat("a", 75-len("SUMMARY:")), 1},
+		{"one octet over", strings.Repeat("a", 76-len("SUMMARY:")), 2},
+		{"many lines", strings.Repeat("a", 300), 5},
+		{"multibyte runes", strings.Repeat("é", 100), 3},
+	}
+	for _, tt := range tests {
+		var b strings.Builder
+		out := &writer{w: bufio.NewWriter(&b)}
+		out.line("SUMMARY", tt.value)
+		out.w.Flush()
+		lines := strings.Split(strings.TrimSuffix(b.String(), "\r\n"), "\r\n")
+		if len(lines) != tt.lines {
+			t.Errorf("%s: %d lines, want %d", tt.name, len(lines), tt.lines)
+		}
+		var unfolded strings.Builder
+		for i, l := range lines {
+			if len(l) > 75 {
+				t.Errorf("%s: line %d is %d octets", tt.name, i, len(l))
+			}
+			if i > 0 {
+				if !strings.HasPrefix(l, " ") {
+					t.Errorf("%s: continuation %q does not start with a space", tt.name, l)
+				}
+				l = l[1:]
+			}
+			unfolded.WriteString(l)
+		}
+		if unfolded.String() != "SUMMARY:"+tt.value {
+			t.Errorf("%s: unfolds to %q", tt.name, unfolded.String())
+		}
+	}
+}
+
+// vtimezone : the VTIMEZONE lines of c, unfolded
+func vtimezone(t *testing.T, c Calendar) []string {
+	t.Helper()
+	var b strings.Builder
+	if err := c.Encode(&b); err != nil {
+		t.Fatal(err)
+	}
+	s := b.String()
+	start := strings.Index(s, "BEGIN:VTIMEZONE\r\n")
+	end := strings.Index(s, "END:VTIMEZONE\r\n")
+	if start < 0 || end < start {
+		t.Fatalf("no VTIMEZONE in %q", s)
+	}
+	return strings.Split(s[start:end], "\r\n")
+}
+
+func TestTimezone(t *testing.T) {
+	london, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Fatal(err)
+	}
+	kolkata, err := time.LoadLocation("Asia/Kolkata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	day := func(loc *time.Location, month time.Month, d int) Event {
+		start := time.Date(2025, month, d, 9, 0, 0, 0, loc)
+		return Event{UID: "x", Start: start, End: start.Add(time.Hour), Summary: "x"}
+	}
+	tests := []struct {
+		name string
+		cal  Calendar
+		want []string // lines expected, in order
+	}{
+		{
+			"utc has one observance",
+			Calendar{Location: time.UTC, Events: []Event{day(time.UTC, 6, 1)}},
+			[]string{"TZID:UTC", "BEGIN:STANDARD", "TZOFFSETTO:+0000", "END:STANDARD"},
+		},
+		{
+			"no daylight saving",
+			Calendar{Location: kolkata, Events: []Event{day(kolkata, 6, 1)}},
+			[]string{"TZID:Asia/Kolkata", "BEGIN:STANDARD", "TZOFFSETFROM:+0530", "TZOFFSETTO:+0530", "TZNAME:IST"},
+		},
+		{
+			// a year either side of the event gives the 2024 to 2026 changes
+			"daylight saving",
+			Calendar{Location: london, Events: []Event{day(london, 6, 1)}},
+			[]string{
+				"TZID:Europe/London",
+				"BEGIN:DAYLIGHT", "DTSTART:20240601T090000", "TZOFFSETTO:+0100", "END:DAYLIGHT",
+				"BEGIN:STANDARD", "DTSTART:20241027T020000", "TZOFFSETFROM:+0100", "TZOFFSETTO:+0000", "TZNAME:GMT", "END:STANDARD",
+				"BEGIN:DAYLIGHT", "DTSTART:20250330T010000", "TZOFFSETFROM:+0000", "TZOFFSETTO:+0100", "TZNAME:BST", "END:DAYLIGHT",
+				"BEGIN:STANDARD", "DTSTART:20251026T020000",
+				"BEGIN:DAYLIGHT", "DTSTART:20260329T010000",
+			},
+		},
+	}
+	for _, tt := range tests {
+		lines := vtimezone(t, tt.cal)
+		i := 0
+		for _, l := range lines {
+			if i < len(tt.want) && l == tt.want[i] {
+				i++
+			}
+		}
+		if i < len(tt.want) {
+			t.Errorf("%s: %q not found in order in %q", tt.name, tt.want[i], lines)
+		}
+	}
+	// a zone with daylight saving changes twice a year, and no more
+	lines := vtimezone(t, Calendar{Location: london, Events: []Event{day(london, 6, 1)}})
+	if n := strings.Count(strings.Join(lines, "\n"), "BEGIN:STANDARD") + strings.Count(strings.Join(lines, "\n"), "BEGIN:DAYLIGHT"); n != 5 {
+		t.Errorf("%d observances from mid 2024 to mid 2026, want 1 and 4 changes", n)
+	}
+}
+
+func TestEncodeEvent(t *testing.T) {
+	start := time.Date(2025, 6, 1, 9, 0, 0, 0, time.UTC)
+	c := Calendar{
+		Name:     "Bookings, ann",
+		Location: time.UTC,
+		Refresh:  90 * time.Minute,
+		Events: []Event{{
+			UID:         "booking-7@example.com",
+			Start:       start,
+			End:         start.Add(time.Hour),
+			Summary:     "Hall; morning",
+			Description: "line one\nline two",
+		}},
+	}
+	var b strings.Builder
+	if err := c.Encode(&b); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"BEGIN:VCALENDAR\r\nVERSION:2.0\r\n",
+		"X-WR-CALNAME:Bookings\\, ann\r\n",
+		"REFRESH-INTERVAL;VALUE=DURATION:PT90M\r\n",
+		"UID:booking-7@example.com\r\n",
+		"DTSTART;TZID=UTC:20250601T090000\r\n",
+		"DTEND;TZID=UTC:20250601T100000\r\n",
+		"SUMMARY:Hall\\; morning\r\n",
+		"DESCRIPTION:line one\\nline two\r\n",
+		"END:VEVENT\r\nEND:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("calendar without %q:\n%s", want, b.String())
+		}
+	}
+}
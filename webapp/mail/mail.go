@@ -0,0 +1,96 @@
+//Package mail : sending email to users
+package mail
+
+import (
+	"fmt"
+	"io"
+	"net"
+	netmail "net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message : a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer : something that delivers messages
+type Mailer interface {
+	Send(m Message) error
+}
+
+// headerValue : s on one line, so it cannot add headers of its own
+func headerValue(s string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(s)
+}
+
+// format : m as an RFC 5322 message from from
+func format(from string, m Message) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", headerValue(from))
+	fmt.Fprintf(&b, "To: %s\r\n", headerValue(m.To))
+	fmt.Fprintf(&b, "Subject: %s\r\n", headerValue(m.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(m.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+// SMTPMailer : Mailer sending through an SMTP server
+type SMTPMailer struct {
+	Addr string
+	From string
+	Auth smtp.Auth // nil for servers that do not need a login
+}
+
+//NewSMTPMailer : mailer for the server at host:port, logging in with
+//username and password unless username is empty
+func NewSMTPMailer(host string, port int, username string, password string, from string) *SMTPMailer {
+	s := &SMTPMailer{
+		Addr: net.JoinHostPort(host, strconv.Itoa(port)),
+		From: from,
+	}
+	if username != "" {
+		s.Auth = smtp.PlainAuth("", username, password, host)
+	}
+	return s
+}
+
+//Send : deliver m to the server. From may carry a display name, as in
+//"Venues <noreply@example.com>", only its address is the envelope sender
+func (s *SMTPMailer) Send(m Message) error {
+	from, err := netmail.ParseAddress(s.From)
+	if err != nil {
+		return err
+	}
+	return smtp.SendMail(s.Addr, s.Auth, from.Address, []string{headerValue(m.To)}, format(s.From, m))
+}
+
+// WriterMailer : Mailer writing messages to w instead of sending them,
+// for local development and tests
+type WriterMailer struct {
+	mu   sync.Mutex
+	w    io.Writer
+	From string
+}
+
+//NewWriterMailer : mailer writing every message to w, such as os.Stdout or a file
+func NewWriterMailer(w io.Writer, from string) *WriterMailer {
+	return &WriterMailer{w: w, From: from}
+}
+
+//Send : write m, followed by a blank line
+func (s *WriterMailer) Send(m Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := fmt.Fprintf(s.w, "%s\r\n\r\n", format(s.From, m))
+	return err
+}
@@ -0,0 +1,64 @@
+package mail
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWriterMailer(t *testing.T) {
+	tests := []struct {
+		name    string
+		m       Message
+		headers []string
+		body    string
+	}{
+		{
+			"plain message",
+			Message{To: "ann@example.com", Subject: "Hello", Body: "line one\nline two\n"},
+			[]string{"To: ann@example.com\r\n", "Subject: Hello\r\n"},
+			"\r\n\r\nline one\r\nline two\r\n",
+		},
+		{
+			"header injected in the subject",
+			Message{To: "ann@example.com", Subject: "Hi\r\nBcc: eve@example.com", Body: "x"},
+			[]string{"Subject: HiBcc: eve@example.com\r\n"},
+			"\r\n\r\nx",
+		},
+		{
+			"header injected in the address",
+			Message{To: "ann@example.com\nBcc: eve@example.com", Subject: "Hi", Body: "x"},
+			[]string{"To: ann@example.comBcc: eve@example.com\r\n"},
+			"\r\n\r\nx",
+		},
+	}
+	for _, tt := range tests {
+		var b strings.Builder
+		if err := NewWriterMailer(&b, "Venues <noreply@example.com>").Send(tt.m); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		out := b.String()
+		head, _, _ := strings.Cut(out, "\r\n\r\n")
+		if !strings.HasPrefix(out, "From: Venues <noreply@example.com>\r\n") {
+			t.Errorf("%s: message starts %q", tt.name, out)
+		}
+		for _, h := range tt.headers {
+			if !strings.Contains(head+"\r\n", h) {
+				t.Errorf("%s: headers %q without %q", tt.name, head, h)
+			}
+		}
+		if strings.Contains(head, "\nBcc:") {
+			t.Errorf("%s: injected header in %q", tt.name, head)
+		}
+		if !strings.Contains(out, tt.body+"\r\n\r\n") {
+			t.Errorf("%s: body not %q in %q", tt.name, tt.body, out)
+		}
+	}
+}
+
+func TestSMTPMailerBadFrom(t *testing.T) {
+	// the envelope sender is parsed before anything is sent
+	s := NewSMTPMailer("localhost", 25, "", "", "not an address")
+	if err := s.Send(Message{To: "ann@example.com", Subject: "Hi", Body: "x"}); err == nil {
+		t.Fatal("sent with an unparsable From")
+	}
+}
@@ -1,36 +1,138 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	config "gia/config"
 	control "gia/controllers"
+	mail "gia/mail"
 	model "gia/model"
+	notify "gia/notify"
 	"html/template"
 	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
 )
 
 var tpl *template.Template
-var mapUsers = map[string]control.User{}
-var mapSessions = map[string]string{}
-var ctl = control.Ctl{
-	Users:    mapUsers,
-	Sessions: mapSessions,
-}
+var ctl = control.Ctl{}
 
 func init() {
 	ctl.Logging = config.CreateLogging()
-	tpl = template.Must(template.ParseGlob("templates/*.html"))
+	tpl = template.Must(template.New("").Funcs(control.TemplateFuncs).ParseGlob("templates/*.html"))
 	ctl.Template = tpl
-	bPassword, _ := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
-	ctl.Users["admin"] = control.User{
-		Username: "admin",
-		Password: bPassword,
-		First:    "admin",
-		Last:     "admin"}
-	ctl.Model = model.InitModel()
+	store, err := openStore()
+	if err != nil {
+		ctl.Logging.Error.Fatalln("Opening store, ", err)
+	}
+	ctl.Model, err = model.InitModel(store)
+	if err != nil {
+		ctl.Logging.Error.Fatalln("Loading store, ", err)
+	}
+	key, err := config.LoadSecret(config.SecretPath)
+	if err != nil {
+		ctl.Logging.Error.Fatalln("Loading secret, ", err)
+	}
+	ctl.Signer = model.NewSigner(key)
+	ctl.Mailer, err = openMailer()
+	if err != nil {
+		ctl.Logging.Error.Fatalln("Opening mailer, ", err)
+	}
+	ctl.Blobs, err = model.OpenDirStore(config.UploadsPath)
+	if err != nil {
+		ctl.Logging.Error.Fatalln("Opening uploads, ", err)
+	}
+	channels = openChannels()
+	for name := range channels {
+		ctl.Channels = append(ctl.Channels, name)
+	}
+	sort.Strings(ctl.Channels)
+	seed()
+}
+
+// channels : notifications are delivered through, by name
+var channels map[string]model.Channel
+
+// openChannels : the in app inbox and email, and the webhook if
+// config.WEBHOOK is set
+func openChannels() map[string]model.Channel {
+	channels := map[string]model.Channel{
+		"inbox": notify.Inbox{Users: ctl.Model.UserDB},
+		"email": notify.Email{Mailer: ctl.Mailer},
+	}
+	if config.WEBHOOK != "" {
+		channels["webhook"] = notify.NewWebhook(config.WEBHOOK, config.WebhookTimeout)
+	}
+	return channels
+}
+
+// openStore : the store picked by config.STORE
+func openStore() (model.Store, error) {
+	switch config.STORE {
+	case "bolt":
+		return model.OpenBoltStore(config.DataPath)
+	case "journal":
+		return model.OpenJournalStore(config.JournalPath, config.SnapshotEvery)
+	}
+	return model.NewMemStore(), nil
+}
+
+// seededCounter : set once the demo venues have been added, so they are
+// not added again after every venue has been deleted
+const seededCounter = "seeded"
+
+// openMailer : the mailer picked by config.MAILER
+func openMailer() (mail.Mailer, error) {
+	switch config.MAILER {
+	case "smtp":
+		return mail.NewSMTPMailer(config.SMTPHost, config.SMTPPort,
+			os.Getenv("SMTP_USER"), os.Getenv("SMTP_PASSWORD"), config.MailFrom), nil
+	case "file":
+		f, err := os.OpenFile(config.MailPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+		if err != nil {
+			return nil, err
+		}
+		return mail.NewWriterMailer(f, config.MailFrom), nil
+	}
+	return mail.NewWriterMailer(os.Stdout, config.MailFrom), nil
+}
+
+// seed : admin user and demo venues for a new data file
+func seed() {
+	u, err := ctl.Model.UserDB.Get("admin")
+	if err == model.ErrUserNotFound {
+		bPassword, _ := bcrypt.GenerateFromPassword([]byte("password"), config.BcryptCost)
+		ctl.Model.UserDB.Add(control.User{
+			Username: "admin",
+			Password: bPassword,
+			First:    "admin",
+			Last:     "admin",
+			Role:     model.RoleAdmin,
+			VIP:      true})
+	} else if err == nil && u.Role == "" {
+		// saved before roles, admin was the username with every right
+		ctl.Model.UserDB.SetRole("admin", model.RoleAdmin)
+	}
+	if n, err := ctl.Model.Store.Counter(seededCounter); err != nil || n > 0 {
+		return
+	}
+	// a data file from before the counter was seeded if it has venues
+	if len(ctl.Model.VenueDB.All()) == 0 {
+		seedVenues()
+	}
+	if err := ctl.Model.Store.PutCounter(seededCounter, 1); err != nil {
+		ctl.Logging.Error.Println("Saving seeded, ", err)
+	}
+}
+
+// seedVenues : demo venues to browse and book
+func seedVenues() {
 	ctl.Model.AddVenue(model.Venue{
 		Capacity: 1235,
 		Kind:     "Stadium",
@@ -52,36 +154,104 @@ func init() {
 		Name:     "Room151",
 		Desc:     "for lessons",
 	})
-
 }
 
 func main() {
 	nextRequestID := func() string {
 		return fmt.Sprintf("%d", time.Now().UnixNano())
 	}
+	// SIGINT and SIGTERM shut the server down cleanly, so the store is
+	// flushed and closed instead of the process being killed
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	scheduler := ctl.Model.StartScheduler()
+	sweeper := ctl.Model.StartSweeper(control.SessionPolicy, config.SessionSweepEvery, func(what string, n int, err error) {
+		if err != nil {
+			ctl.Logging.Error.Println("Sweeping ", what, ", ", err)
+		} else if n > 0 {
+			ctl.Logging.Info.Println("Swept ", n, " expired ", what)
+		}
+	})
+	notifier := ctl.Model.StartNotifier(channels, control.RetryPolicy, config.NotifyEvery, func(n model.Notification, err error) {
+		switch {
+		case err == nil:
+			ctl.Logging.Info.Println("Sent ", n.Kind, " of booking ", n.BookingID, " to ", n.User, " on ", n.Channel)
+		case errors.Is(err, model.ErrUndeliverable):
+			ctl.Logging.Warning.Println("Dropped ", n.Kind, " of booking ", n.BookingID, " to ", n.User, " on ", n.Channel, ", ", err)
+		case n.ID == 0:
+			ctl.Logging.Error.Println("Reading notifications, ", err)
+		default:
+			ctl.Logging.Warning.Println("Retrying ", n.Kind, " of booking ", n.BookingID, " to ", n.User, " on ", n.Channel, " at ", n.Due, ", ", err)
+		}
+	})
 	router := http.NewServeMux()
 	router.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("static"))))
+	router.Handle("/media/", http.StripPrefix("/media/", ctl.Media()))
 	router.HandleFunc("/", ctl.Index)
 	router.HandleFunc("/browse", ctl.Browse)
 	router.HandleFunc("/book", ctl.Book)
 	router.HandleFunc("/confirmBook", ctl.ConfirmBook)
+	router.HandleFunc("/waitlist", ctl.Waitlist)
 	router.HandleFunc("/viewBook", ctl.ViewBook)
 	router.HandleFunc("/deleteBook", ctl.DeleteBook)
 	router.HandleFunc("/addVenue", ctl.AddVenue)
+	router.HandleFunc("/manageVenues", ctl.ManageVenues)
+	router.HandleFunc("/editVenue", ctl.EditVenue)
+	router.HandleFunc("/archiveVenue", ctl.ArchiveVenue)
+	router.HandleFunc("/deleteVenue", ctl.DeleteVenue)
+	router.HandleFunc("/uploadMedia", ctl.UploadMedia)
+	router.HandleFunc("/deleteMedia", ctl.DeleteMedia)
+	router.HandleFunc("/admin/roles", ctl.Roles)
 	router.HandleFunc("/profile", ctl.Profile)
 	router.HandleFunc("/editProfile", ctl.EditProfile)
-	router.HandleFunc("/signup", ctl.Signup)
-	router.HandleFunc("/login", ctl.Login)
+	// logins and signups are limited per ip, on top of account lockout
+	limit := config.NewLimiter(config.LoginRateEvery, config.LoginBurst).Limit(ctl.Logging)
+	router.Handle("/signup", limit(http.HandlerFunc(ctl.Signup)))
+	router.Handle("/login", limit(http.HandlerFunc(ctl.Login)))
 	router.HandleFunc("/logout", ctl.Logout)
+	router.HandleFunc("/logoutAll", ctl.LogoutAll)
+	router.HandleFunc("/verify", ctl.Verify)
+	router.HandleFunc("/resendVerification", ctl.ResendVerification)
+	router.Handle("/forgot", limit(http.HandlerFunc(ctl.Forgot)))
+	router.Handle("/reset", limit(http.HandlerFunc(ctl.Reset)))
+	router.HandleFunc("/ical/booking", ctl.BookingICS)
+	router.HandleFunc("/ical/feed", ctl.Feed)
+	router.HandleFunc("/ical/venue", ctl.VenueFeed)
+	router.HandleFunc("/resetFeed", ctl.ResetFeed)
+	api := ctl.API()
+	router.Handle(control.APIPrefix, api)
+	router.Handle(control.APIPrefix+"auth/login", limit(api))
 	router.Handle("/favicon.ico", http.NotFoundHandler())
+	// photos and floor plans take a while to send on a slow link, a
+	// client that is slow to send its headers is still cut off quickly
 	server := &http.Server{
-		Addr:         config.PORT,
-		Handler:      config.Tracing(nextRequestID)(ctl.Logging.Infologging()(router)),
-		ErrorLog:     ctl.Logging.Error,
-		ReadTimeout:  5 * time.Second,
-		WriteTimeout: 10 * time.Second,
-		IdleTimeout:  15 * time.Second,
+		Addr:              config.PORT,
+		Handler:           config.Tracing(nextRequestID)(ctl.Logging.Infologging()(config.CSRF(control.CSRFExempt)(ctl.Auth()(router)))),
+		ErrorLog:          ctl.Logging.Error,
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       2 * time.Minute,
+		WriteTimeout:      2 * time.Minute,
+		IdleTimeout:       15 * time.Second,
 	}
 	//http.ListenAndServe(config.PORT, nil)
-	server.ListenAndServeTLS(config.CertPath, config.KeyPath)
+	go func() {
+		if err := server.ListenAndServeTLS(config.CertPath, config.KeyPath); err != http.ErrServerClosed {
+			ctl.Logging.Error.Println("Serving, ", err)
+			stop()
+		}
+	}()
+	<-ctx.Done()
+	ctl.Logging.Info.Println("Shutting down")
+	shutdown, cancel := context.WithTimeout(context.Background(), config.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdown); err != nil {
+		ctl.Logging.Error.Println("Waiting for requests to finish, ", err)
+	}
+	// nothing writes to the store once these have stopped
+	notifier.Stop()
+	sweeper.Stop()
+	scheduler.Stop()
+	if err := ctl.Model.Store.Close(); err != nil {
+		ctl.Logging.Error.Println("Closing store, ", err)
+	}
 }
@@ -0,0 +1,289 @@
+package model
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// bucket names, one per kind of record, values are json
+var (
+	usersBucket    = []byte("users")
+	sessionsBucket = []byte("logins")
+	tokensBucket   = []byte("tokens")
+	venuesBucket   = []byte("venues")
+	bookingsBucket = []byte("bookings")
+	notesBucket    = []byte("notifications")
+	metaBucket     = []byte("meta") // id counters by name
+	// sessions before they expired, kept only a username per id
+	legacySessionsBucket = []byte("sessions")
+)
+
+// BoltStore : Store kept in a single bbolt file, survives restarts.
+// Only one process can have the file open at a time
+type BoltStore struct {
+	db *bolt.DB
+}
+
+//OpenBoltStore : open or create the store file at path
+func OpenBoltStore(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{usersBucket, sessionsBucket, tokensBucket, venuesBucket, bookingsBucket, notesBucket, metaBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		// old logins have no times to expire by, they log in again
+		if tx.Bucket(legacySessionsBucket) != nil {
+			return tx.DeleteBucket(legacySessionsBucket)
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &BoltStore{db: db}, nil
+}
+
+// itob : big endian id, so keys sort by id
+func itob(id int) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(id))
+	return b
+}
+
+// get : decode value of key in bucket into v, false if missing
+func (s *BoltStore) get(bucket []byte, key []byte, v interface{}) (bool, error) {
+	var found bool
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(bucket).Get(key)
+		if data == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(data, v)
+	})
+	return found, err
+}
+
+// put : store v as json under key in bucket
+func (s *BoltStore) put(bucket []byte, key []byte, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucket).Put(key, data)
+	})
+}
+
+func (s *BoltStore) delete(bucket []byte, key []byte) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucket).Delete(key)
+	})
+}
+
+//User : user with username
+func (s *BoltStore) User(username string) (User, error) {
+	var u User
+	found, err := s.get(usersBucket, []byte(username), &u)
+	if err == nil && !found {
+		err = ErrUserNotFound
+	}
+	return u, err
+}
+
+//Users : every user by username
+func (s *BoltStore) Users() (map[string]User, error) {
+	users := make(map[string]User)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(usersBucket).ForEach(func(k, data []byte) error {
+			var u User
+			if err := json.Unmarshal(data, &u); err != nil {
+				return err
+			}
+			users[u.Username] = u
+			return nil
+		})
+	})
+	return users, err
+}
+
+//PutUser : add or replace u
+func (s *BoltStore) PutUser(u User) error {
+	return s.put(usersBucket, []byte(u.Username), u)
+}
+
+//Session : login with session id
+func (s *BoltStore) Session(id string) (Session, error) {
+	var sess Session
+	found, err := s.get(sessionsBucket, []byte(id), &sess)
+	if err == nil && !found {
+		err = ErrSessionNotFound
+	}
+	return sess, err
+}
+
+//Sessions : every login by session id
+func (s *BoltStore) Sessions() (map[string]Session, error) {
+	sessions := make(map[string]Session)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(sessionsBucket).ForEach(func(k, data []byte) error {
+			var sess Session
+			if err := json.Unmarshal(data, &sess); err != nil {
+				return err
+			}
+			sessions[sess.ID] = sess
+			return nil
+		})
+	})
+	return sessions, err
+}
+
+//PutSession : add or replace login sess
+func (s *BoltStore) PutSession(sess Session) error {
+	return s.put(sessionsBucket, []byte(sess.ID), sess)
+}
+
+//DeleteSession : log session id out
+func (s *BoltStore) DeleteSession(id string) error {
+	return s.delete(sessionsBucket, []byte(id))
+}
+
+//Token : token stored under hash
+func (s *BoltStore) Token(hash string) (Token, error) {
+	var t Token
+	found, err := s.get(tokensBucket, []byte(hash), &t)
+	if err == nil && !found {
+		err = ErrTokenInvalid
+	}
+	return t, err
+}
+
+//Tokens : every token by hash
+func (s *BoltStore) Tokens() (map[string]Token, error) {
+	tokens := make(map[string]Token)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(tokensBucket).ForEach(func(k, data []byte) error {
+			var t Token
+			if err := json.Unmarshal(data, &t); err != nil {
+				return err
+			}
+			tokens[t.Hash] = t
+			return nil
+		})
+	})
+	return tokens, err
+}
+
+//PutToken : add or replace t
+func (s *BoltStore) PutToken(t Token) error {
+	return s.put(tokensBucket, []byte(t.Hash), t)
+}
+
+//DeleteToken : remove token stored under hash
+func (s *BoltStore) DeleteToken(hash string) error {
+	return s.delete(tokensBucket, []byte(hash))
+}
+
+//Venues : every venue by id
+func (s *BoltStore) Venues() (map[int]Venue, error) {
+	venues := make(map[int]Venue)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(venuesBucket).ForEach(func(k, data []byte) error {
+			var v Venue
+			if err := json.Unmarshal(data, &v); err != nil {
+				return err
+			}
+			venues[int(binary.BigEndian.Uint64(k))] = v
+			return nil
+		})
+	})
+	return venues, err
+}
+
+//PutVenue : add or replace venue id
+func (s *BoltStore) PutVenue(id int, v Venue) error {
+	return s.put(venuesBucket, itob(id), v)
+}
+
+//DeleteVenue : remove venue id
+func (s *BoltStore) DeleteVenue(id int) error {
+	return s.delete(venuesBucket, itob(id))
+}
+
+//Bookings : every booking by id
+func (s *BoltStore) Bookings() (map[int]Booking, error) {
+	bookings := make(map[int]Booking)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bookingsBucket).ForEach(func(k, data []byte) error {
+			var b Booking
+			if err := json.Unmarshal(data, &b); err != nil {
+				return err
+			}
+			bookings[b.IDBook] = b
+			return nil
+		})
+	})
+	return bookings, err
+}
+
+//PutBooking : add or replace b
+func (s *BoltStore) PutBooking(b Booking) error {
+	return s.put(bookingsBucket, itob(b.IDBook), b)
+}
+
+//DeleteBooking : remove booking id
+func (s *BoltStore) DeleteBooking(id int) error {
+	return s.delete(bookingsBucket, itob(id))
+}
+
+//Counter : next id counter name gives out
+func (s *BoltStore) Counter(name string) (int, error) {
+	var next int
+	_, err := s.get(metaBucket, []byte(name), &next)
+	return next, err
+}
+
+//PutCounter : set the next id counter name gives out
+func (s *BoltStore) PutCounter(name string, next int) error {
+	return s.put(metaBucket, []byte(name), next)
+}
+
+//Notifications : every queued notification by id
+func (s *BoltStore) Notifications() (map[int]Notification, error) {
+	notes := make(map[int]Notification)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(notesBucket).ForEach(func(k, data []byte) error {
+			var n Notification
+			if err := json.Unmarshal(data, &n); err != nil {
+				return err
+			}
+			notes[n.ID] = n
+			return nil
+		})
+	})
+	return notes, err
+}
+
+//PutNotification : add or replace n
+func (s *BoltStore) PutNotification(n Notification) error {
+	return s.put(notesBucket, itob(n.ID), n)
+}
+
+//DeleteNotification : remove notification id
+func (s *BoltStore) DeleteNotification(id int) error {
+	return s.delete(notesBucket, itob(id))
+}
+
+//Close : close the file
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
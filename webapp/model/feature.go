@@ -0,0 +1,219 @@
+package model
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strings"
+)
+
+var (
+	//ErrUnknownAmenity : amenity is not one of Amenities
+	ErrUnknownAmenity = errors.New("unknown amenity")
+	//ErrUnknownAttribute : attribute is not one of Attributes
+	ErrUnknownAttribute = errors.New("unknown attribute")
+	//ErrInvalidAttribute : attribute value is negative or not a number
+	ErrInvalidAttribute = errors.New("attribute must be a number of 0 or more")
+)
+
+//Amenity : something a venue can have, searched for by Key
+type Amenity struct {
+	Key   string
+	Label string
+}
+
+//Amenities : every amenity a venue can have, in the order they are shown
+var Amenities = []Amenity{
+	{Key: "projector", Label: "Projector"},
+	{Key: "wheelchair", Label: "Wheelchair access"},
+	{Key: "av", Label: "Audio visual system"},
+	{Key: "kitchen", Label: "Kitchen"},
+}
+
+//Attribute : number describing a venue, searched for by Key within a Range
+type Attribute struct {
+	Key   string
+	Label string
+	Unit  string
+}
+
+//Attributes : every numeric attribute a venue can have, in the order they are shown
+var Attributes = []Attribute{
+	{Key: "area", Label: "Area", Unit: "m²"},
+	{Key: "price", Label: "Hourly price", Unit: "$"},
+}
+
+//Range : bounds of an attribute, both included
+type Range struct {
+	Min float64
+	Max float64
+}
+
+// isAmenity : true if key is one of Amenities
+func isAmenity(key string) bool {
+	for _, a := range Amenities {
+		if a.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// isAttribute : true if key is one of Attributes
+func isAttribute(key string) bool {
+	for _, a := range Attributes {
+		if a.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// normalise : s lower case and trimmed, without blanks or repeats, sorted
+func normalise(s []string) []string {
+	seen := make(map[string]bool, len(s))
+	out := make([]string, 0, len(s))
+	for _, v := range s {
+		v = strings.ToLower(strings.TrimSpace(v))
+		if v == "" || seen[v] {
+			continue
+		}
+		seen[v] = true
+		out = append(out, v)
+	}
+	sort.Strings(out)
+	return out
+}
+
+//ParseTags : tags of a comma separated list
+func ParseTags(s string) []string {
+	return normalise(strings.Split(s, ","))
+}
+
+// features : v with its amenities and tags normalised, or an error if it
+// has an amenity or attribute that is not known
+func features(v Venue) (Venue, error) {
+	v.Amenities = normalise(v.Amenities)
+	v.Tags = normalise(v.Tags)
+	for _, a := range v.Amenities {
+		if !isAmenity(a) {
+			return v, ErrUnknownAmenity
+		}
+	}
+	for k, n := range v.Attrs {
+		if !isAttribute(k) {
+			return v, ErrUnknownAttribute
+		}
+		if math.IsNaN(n) || math.IsInf(n, 0) || n < 0 {
+			return v, ErrInvalidAttribute
+		}
+	}
+	return v, nil
+}
+
+// indexFeatures : add the amenities, tags and attributes of venue id to
+// their indexes, vDB.mu must be held
+func (vDB *venueDB) indexFeatures(id int, v Venue) {
+	for _, a := range v.Amenities {
+		vDB.addMap(vDB.amenityMap, a, id)
+	}
+	for _, t := range v.Tags {
+		vDB.addMap(vDB.tagMap, t, id)
+	}
+	for k, n := range v.Attrs {
+		tree, exists := vDB.attrTrees[k]
+		if !exists {
+			tree = &Tree[float64, map[int]bool]{}
+			vDB.attrTrees[k] = tree
+		}
+		ids, exists := tree.Get(n)
+		if !exists {
+			ids = make(map[int]bool)
+			tree.Put(n, ids)
+		}
+		ids[id] = true
+	}
+}
+
+// unindexFeatures : undo indexFeatures, vDB.mu must be held
+func (vDB *venueDB) unindexFeatures(id int, v Venue) {
+	for _, a := range v.Amenities {
+		vDB.removeMap(vDB.amenityMap, a, id)
+	}
+	for _, t := range v.Tags {
+		vDB.removeMap(vDB.tagMap, t, id)
+	}
+	for k, n := range v.Attrs {
+		tree, exists := vDB.attrTrees[k]
+		if !exists {
+			continue
+		}
+		if ids, exists := tree.Get(n); exists {
+			delete(ids, id)
+			if len(ids) == 0 {
+				tree.Delete(n)
+			}
+		}
+	}
+}
+
+// having : venues of m with all of keys, or any of them if anyOf is true
+func having(m map[string][]int, keys []string, anyOf bool) []int {
+	keys = normalise(keys)
+	count := make(map[int]int)
+	for _, k := range keys {
+		for _, id := range m[k] {
+			count[id]++
+		}
+	}
+	ids := make([]int, 0, len(count))
+	for id, n := range count {
+		if anyOf || n == len(keys) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// within : venues with attribute key in r, vDB.mu must be held
+func (vDB *venueDB) within(key string, r Range) []int {
+	ids := make([]int, 0)
+	tree, exists := vDB.attrTrees[key]
+	if !exists {
+		return ids
+	}
+	for it := tree.Seek(r.Min); it.Valid() && it.Key() <= r.Max; it.Next() {
+		ids = append(ids, setKeys(it.Value())...)
+	}
+	return ids
+}
+
+//TagList : tags given to venues that can be found
+func (vDB *venueDB) TagList() []string {
+	vDB.mu.RLock()
+	defer vDB.mu.RUnlock()
+	keys := make([]string, 0, len(vDB.tagMap))
+	for k := range vDB.tagMap {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+//AttrRange : smallest and largest value of attribute key among venues
+//that can be found, ok is false if none has it
+func (vDB *venueDB) AttrRange(key string) (Range, bool) {
+	vDB.mu.RLock()
+	defer vDB.mu.RUnlock()
+	tree, exists := vDB.attrTrees[key]
+	if !exists {
+		return Range{}, false
+	}
+	lo, err1 := tree.Min()
+	hi, err2 := tree.Max()
+	if err1 != nil || err2 != nil {
+		return Range{}, false
+	}
+	return Range{Min: lo, Max: hi}, true
+}
@@ -0,0 +1,143 @@
+package model
+
+import (
+	"math"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestFeatures(t *testing.T) {
+	tests := []struct {
+		name string
+		v    Venue
+		want error
+		tags []string // after normalising
+	}{
+		{"known features", Venue{Amenities: []string{"kitchen"}, Tags: []string{"Quiet"}, Attrs: map[string]float64{"area": 80}}, nil, []string{"quiet"}},
+		{"tags trimmed, sorted and without repeats", Venue{Tags: []string{" b ", "a", "B", ""}}, nil, []string{"a", "b"}},
+		{"unknown amenity", Venue{Amenities: []string{"pool"}}, ErrUnknownAmenity, nil},
+		{"amenity in capitals", Venue{Amenities: []string{"Kitchen"}}, nil, []string{}},
+		{"unknown attribute", Venue{Attrs: map[string]float64{"height": 3}}, ErrUnknownAttribute, nil},
+		{"negative attribute", Venue{Attrs: map[string]float64{"price": -1}}, ErrInvalidAttribute, nil},
+		{"attribute not a number", Venue{Attrs: map[string]float64{"price": math.NaN()}}, ErrInvalidAttribute, nil},
+		{"infinite attribute", Venue{Attrs: map[string]float64{"area": math.Inf(1)}}, ErrInvalidAttribute, nil},
+	}
+	for _, tt := range tests {
+		v, err := features(tt.v)
+		if err != tt.want {
+			t.Errorf("%s: features gave %v, want %v", tt.name, err, tt.want)
+		}
+		if tt.want == nil && !reflect.DeepEqual(v.Tags, tt.tags) {
+			t.Errorf("%s: tags %q, want %q", tt.name, v.Tags, tt.tags)
+		}
+	}
+}
+
+func TestFeatureFilter(t *testing.T) {
+	m, err := InitModel(NewMemStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []Venue{
+		{Name: "Hall", Amenities: []string{"projector", "kitchen"}, Tags: []string{"quiet", "garden"}, Attrs: map[string]float64{"area": 200, "price": 50}},
+		{Name: "Studio", Amenities: []string{"projector"}, Tags: []string{"quiet"}, Attrs: map[string]float64{"area": 40}},
+		{Name: "Barn", Amenities: []string{"wheelchair"}, Tags: []string{"rustic"}, Attrs: map[string]float64{"area": 120, "price": 20}},
+		{Name: "Shed"},
+	} {
+		v.Kind, v.Location, v.Capacity = "Room", "North", 10
+		if err := m.AddVenue(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	base := Query{Location: "Nil", Kind: "Nil", CapMin: 0, CapMax: 100}
+	tests := []struct {
+		name      string
+		amenities []string
+		tags      []string
+		anyOf     bool
+		attrs     map[string]Range
+		want      []int
+	}{
+		{"no features asked for", nil, nil, false, nil, []int{1, 2, 3, 4}},
+		{"one amenity", []string{"projector"}, nil, false, nil, []int{1, 2}},
+		{"all of two amenities", []string{"projector", "kitchen"}, nil, false, nil, []int{1}},
+		{"any of two amenities", []string{"kitchen", "wheelchair"}, nil, true, nil, []int{1, 3}},
+		{"amenity nobody has", []string{"av"}, nil, false, nil, []int{}},
+		{"tag in capitals", nil, []string{"QUIET"}, false, nil, []int{1, 2}},
+		{"amenity and tag", []string{"projector"}, []string{"garden"}, false, nil, []int{1}},
+		{"any of amenities and any of tags", []string{"wheelchair", "kitchen"}, []string{"rustic", "quiet"}, true, nil, []int{1, 3}},
+		{"attribute range, bounds included", nil, nil, false, map[string]Range{"area": {Min: 40, Max: 120}}, []int{2, 3}},
+		{"open ended range", nil, nil, false, map[string]Range{"area": {Min: 100, Max: math.Inf(1)}}, []int{1, 3}},
+		{"venues without the attribute are left out", nil, nil, false, map[string]Range{"price": {Min: 0, Max: math.Inf(1)}}, []int{1, 3}},
+		{"two attributes", nil, nil, false, map[string]Range{"area": {Min: 100, Max: 300}, "price": {Min: 0, Max: 30}}, []int{3}},
+		{"everything", []string{"projector"}, []string{"quiet"}, false, map[string]Range{"area": {Min: 100, Max: 300}}, []int{1}},
+	}
+	for _, tt := range tests {
+		q := base
+		q.Amenities, q.Tags, q.AnyOf, q.Attrs = tt.amenities, tt.tags, tt.anyOf, tt.attrs
+		_, got := m.VenueDB.Filter(q)
+		sort.Ints(got)
+		if len(got) != len(tt.want) || (len(got) > 0 && !reflect.DeepEqual(got, tt.want)) {
+			t.Errorf("%s: found %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFeatureIndexUpdates(t *testing.T) {
+	m, vid, _ := newTestModel(t)
+	find := func(tag string) []int {
+		_, ids := m.VenueDB.Filter(Query{Location: "Nil", Kind: "Nil", CapMin: 0, CapMax: 100, Tags: []string{tag}})
+		return ids
+	}
+	steps := []struct {
+		name   string
+		change func() error
+		tag    string // found under
+		gone   string // no longer found under
+		tags   []string
+		area   Range // of the venues that can be found, zero if none has one
+	}{
+		{"tagged", func() error {
+			_, err := m.VenueDB.Update(vid, func(v *Venue) {
+				v.Tags = []string{"quiet"}
+				v.Attrs = map[string]float64{"area": 80}
+			})
+			return err
+		}, "quiet", "", []string{"quiet"}, Range{80, 80}},
+		{"tag changed", func() error {
+			_, err := m.VenueDB.Update(vid, func(v *Venue) {
+				v.Tags = []string{"loud"}
+				v.Attrs = map[string]float64{"area": 90}
+			})
+			return err
+		}, "loud", "quiet", []string{"loud"}, Range{90, 90}},
+		{"archived", func() error { return m.ArchiveVenue(vid, true) }, "", "loud", []string{}, Range{}},
+		{"opened again", func() error { return m.ArchiveVenue(vid, false) }, "loud", "", []string{"loud"}, Range{90, 90}},
+	}
+	for _, tt := range steps {
+		if err := tt.change(); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if tt.tag != "" && len(find(tt.tag)) != 1 {
+			t.Errorf("%s: not found under %q", tt.name, tt.tag)
+		}
+		if tt.gone != "" && len(find(tt.gone)) != 0 {
+			t.Errorf("%s: still found under %q", tt.name, tt.gone)
+		}
+		if got := m.VenueDB.TagList(); !reflect.DeepEqual(got, tt.tags) {
+			t.Errorf("%s: tags %q, want %q", tt.name, got, tt.tags)
+		}
+		r, ok := m.VenueDB.AttrRange("area")
+		if ok != (tt.area != Range{}) || r != tt.area {
+			t.Errorf("%s: area range %v %t, want %v", tt.name, r, ok, tt.area)
+		}
+	}
+	// an update with a feature that is not known changes nothing
+	if _, err := m.VenueDB.Update(vid, func(v *Venue) { v.Amenities = []string{"pool"} }); err != ErrUnknownAmenity {
+		t.Fatalf("update with an unknown amenity gave %v", err)
+	}
+	if v, _ := m.VenueDB.Get(vid); len(v.Amenities) != 0 {
+		t.Fatalf("venue has amenities %q after a failed update", v.Amenities)
+	}
+}
@@ -0,0 +1,196 @@
+package model
+
+import "time"
+
+// Interval : half open time range [Start, End)
+type Interval struct {
+	Start time.Time
+	End   time.Time
+}
+
+// Overlaps : true if i and j share any instant
+func (i Interval) Overlaps(j Interval) bool {
+	return i.Start.Before(j.End) && j.Start.Before(i.End)
+}
+
+// interval of a slot
+func (s Slot) interval() Interval {
+	return Interval{Start: s.Start, End: s.End}
+}
+
+// intervalTree : AVL tree of bookings ordered by start time, each node also
+// holds the largest end time in its subtree so overlap queries can skip
+// subtrees that end before the query starts.
+// Intervals may overlap, ties on start are ordered by booking id
+type intervalTree struct {
+	root *ivNode
+	size int
+}
+
+type ivNode struct {
+	start   int64 // unix seconds
+	end     int64
+	booking *Booking
+	maxEnd  int64 // largest end in subtree rooted at node
+	height  int
+	left    *ivNode
+	right   *ivNode
+}
+
+// less : order of a before b, by start then booking id
+func (a *ivNode) less(b *ivNode) bool {
+	if a.start != b.start {
+		return a.start < b.start
+	}
+	return a.booking.IDBook < b.booking.IDBook
+}
+
+func (n *ivNode) getHeight() int {
+	if n == nil {
+		return 0
+	}
+	return n.height
+}
+
+// update : recompute height and maxEnd of n from its children
+func (n *ivNode) update() {
+	n.height = max(n.left.getHeight(), n.right.getHeight()) + 1
+	n.maxEnd = n.end
+	if n.left != nil && n.left.maxEnd > n.maxEnd {
+		n.maxEnd = n.left.maxEnd
+	}
+	if n.right != nil && n.right.maxEnd > n.maxEnd {
+		n.maxEnd = n.right.maxEnd
+	}
+}
+
+func (n *ivNode) rotateLeft() *ivNode {
+	y := n.right
+	n.right = y.left
+	y.left = n
+	n.update()
+	y.update()
+	return y
+}
+
+func (n *ivNode) rotateRight() *ivNode {
+	y := n.left
+	n.left = y.right
+	y.right = n
+	n.update()
+	y.update()
+	return y
+}
+
+// rebalance : restore AVL balance at n, returns new subtree root
+func (n *ivNode) rebalance() *ivNode {
+	n.update()
+	bf := n.left.getHeight() - n.right.getHeight()
+	if bf > 1 {
+		if n.left.left.getHeight() < n.left.right.getHeight() {
+			n.left = n.left.rotateLeft()
+		}
+		return n.rotateRight()
+	}
+	if bf < -1 {
+		if n.right.right.getHeight() < n.right.left.getHeight() {
+			n.right = n.right.rotateRight()
+		}
+		return n.rotateLeft()
+	}
+	return n
+}
+
+// Insert : add booking b over interval iv
+func (t *intervalTree) Insert(iv Interval, b *Booking) {
+	n := &ivNode{
+		start:   iv.Start.Unix(),
+		end:     iv.End.Unix(),
+		booking: b,
+		height:  1,
+	}
+	n.maxEnd = n.end
+	t.root = t.root.insert(n)
+	t.size++
+}
+
+func (n *ivNode) insert(new *ivNode) *ivNode {
+	if n == nil {
+		return new
+	}
+	if new.less(n) {
+		n.left = n.left.insert(new)
+	} else {
+		n.right = n.right.insert(new)
+	}
+	return n.rebalance()
+}
+
+// Delete : remove booking b over interval iv, true if deleted
+func (t *intervalTree) Delete(iv Interval, b *Booking) bool {
+	key := &ivNode{start: iv.Start.Unix(), booking: b}
+	var deleted bool
+	t.root, deleted = t.root.delete(key)
+	if deleted {
+		t.size--
+	}
+	return deleted
+}
+
+func (n *ivNode) delete(key *ivNode) (*ivNode, bool) {
+	if n == nil {
+		return nil, false
+	}
+	var deleted bool
+	if key.less(n) {
+		n.left, deleted = n.left.delete(key)
+	} else if n.less(key) {
+		n.right, deleted = n.right.delete(key)
+	} else {
+		if n.left == nil {
+			return n.right, true
+		}
+		if n.right == nil {
+			return n.left, true
+		}
+		// replace with in order successor
+		s := n.right
+		for s.left != nil {
+			s = s.left
+		}
+		n.right, _ = n.right.delete(s)
+		s.left = n.left
+		s.right = n.right
+		n = s
+		deleted = true
+	}
+	return n.rebalance(), deleted
+}
+
+// Overlapping : bookings whose interval overlaps iv, ordered by start
+func (t *intervalTree) Overlapping(iv Interval) []*Booking {
+	var found []*Booking
+	t.root.overlapping(iv.Start.Unix(), iv.End.Unix(), &found)
+	return found
+}
+
+func (n *ivNode) overlapping(start int64, end int64, found *[]*Booking) {
+	// nothing in this subtree ends after the query starts
+	if n == nil || n.maxEnd <= start {
+		return
+	}
+	n.left.overlapping(start, end, found)
+	// everything to the right starts at or after n.start
+	if n.start >= end {
+		return
+	}
+	if n.end > start {
+		*found = append(*found, n.booking)
+	}
+	n.right.overlapping(start, end, found)
+}
+
+// Size : number of intervals in tree
+func (t *intervalTree) Size() int {
+	return t.size
+}
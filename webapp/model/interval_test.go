@@ -0,0 +1,69 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIntervalOverlaps(t *testing.T) {
+	at := func(h int) time.Time {
+		return time.Date(2030, time.January, 1, h, 0, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		a, b Interval
+		want bool
+	}{
+		{Interval{at(9), at(10)}, Interval{at(9), at(10)}, true},
+		{Interval{at(9), at(12)}, Interval{at(10), at(11)}, true},
+		{Interval{at(9), at(11)}, Interval{at(10), at(12)}, true},
+		{Interval{at(9), at(10)}, Interval{at(10), at(11)}, false}, // half open
+		{Interval{at(9), at(10)}, Interval{at(11), at(12)}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.a.Overlaps(tt.b); got != tt.want {
+			t.Errorf("%v overlaps %v = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+		if got := tt.b.Overlaps(tt.a); got != tt.want {
+			t.Errorf("%v overlaps %v = %v, want %v", tt.b, tt.a, got, tt.want)
+		}
+	}
+}
+
+func TestReserveRanges(t *testing.T) {
+	rdt := &ReserveDT{}
+	rdt.init(2, DefaultDayParts)
+	tomorrow := dayStart(time.Now()).AddDate(0, 0, 1)
+	custom := func(from, to time.Duration) Slot {
+		return Slot{Start: tomorrow.Add(from), End: tomorrow.Add(to), Part: CustomPart, Name: "Custom"}
+	}
+	part := func(i int) Slot {
+		return DefaultDayParts[i].on(tomorrow, i)
+	}
+	// in order, each against what the ones before it reserved
+	tests := []struct {
+		name string
+		slot Slot
+		want error
+	}{
+		{"range inside the morning", custom(9*time.Hour, 10*time.Hour), nil},
+		{"morning it covers", part(0), ErrSlotTaken},
+		{"range into the afternoon", custom(11*time.Hour, 14*time.Hour), nil},
+		{"range touching the first", custom(10*time.Hour, 11*time.Hour), nil},
+		{"range over the first", custom(9*time.Hour+30*time.Minute, 9*time.Hour+45*time.Minute), ErrOverlap},
+		{"afternoon it covers", part(1), ErrSlotTaken},
+		{"evening", part(2), nil},
+		{"range into the evening", custom(21*time.Hour, 23*time.Hour), ErrOverlap},
+	}
+	for i, tt := range tests {
+		err := rdt.Reserve(&Booking{IDBook: i + 1, Slot: tt.slot})
+		if err != tt.want {
+			t.Errorf("%s: Reserve gave %v, want %v", tt.name, err, tt.want)
+		}
+	}
+	if n := rdt.unavailable.Size(); n != len(DefaultDayParts) {
+		t.Errorf("%d slots unavailable, want every part of tomorrow", n)
+	}
+	if n := rdt.ranges.Size(); n != 4 {
+		t.Errorf("%d bookings held, want 4", n)
+	}
+}
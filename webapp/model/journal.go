@@ -0,0 +1,460 @@
+package model
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// files kept in the journal directory
+const (
+	journalFile  = "journal.log"
+	snapshotFile = "snapshot.json"
+)
+
+//ErrJournalCorrupt : a journal line that was written in full cannot be read
+var ErrJournalCorrupt = errors.New("journal is corrupt")
+
+// journal operations, one per Store write
+const (
+	opPutUser       = "putUser"
+	opPutSession    = "putSession"
+	opDeleteSession = "deleteSession"
+	opPutToken      = "putToken"
+	opDeleteToken   = "deleteToken"
+	opPutVenue      = "putVenue"
+	opDeleteVenue   = "deleteVenue"
+	opPutBooking    = "putBooking"
+	opDeleteBooking = "deleteBooking"
+	opPutCounter    = "putCounter"
+	opPutNote       = "putNotification"
+	opDeleteNote    = "deleteNotification"
+)
+
+// journalEntry : one line of the journal, fields used depend on Op
+type journalEntry struct {
+	Op       string
+	ID       int           `json:",omitempty"` // venue, booking or notification id, or next id of Counter
+	Counter  string        `json:",omitempty"`
+	Session  string        `json:",omitempty"` // session id or token hash
+	Username string        `json:",omitempty"`
+	Login    *Session      `json:",omitempty"` // older journals only have Session and Username
+	User     *User         `json:",omitempty"`
+	Token    *Token        `json:",omitempty"`
+	Venue    *Venue        `json:",omitempty"`
+	Booking  *Booking      `json:",omitempty"`
+	Note     *Notification `json:",omitempty"`
+}
+
+// apply : make the change e records to m
+func (e journalEntry) apply(m *MemStore) {
+	switch e.Op {
+	case opPutUser:
+		m.PutUser(*e.User)
+	case opPutSession:
+		// logins from before sessions expired are dropped
+		if e.Login != nil {
+			m.PutSession(*e.Login)
+		}
+	case opDeleteSession:
+		m.DeleteSession(e.Session)
+	case opPutToken:
+		m.PutToken(*e.Token)
+	case opDeleteToken:
+		m.DeleteToken(e.Session)
+	case opPutVenue:
+		m.PutVenue(e.ID, *e.Venue)
+	case opDeleteVenue:
+		m.DeleteVenue(e.ID)
+	case opPutBooking:
+		m.PutBooking(*e.Booking)
+	case opDeleteBooking:
+		m.DeleteBooking(e.ID)
+	case opPutCounter:
+		m.PutCounter(e.Counter, e.ID)
+	case opPutNote:
+		m.PutNotification(*e.Note)
+	case opDeleteNote:
+		m.DeleteNotification(e.ID)
+	}
+}
+
+// snapshot : everything in a MemStore at one point in time
+type snapshot struct {
+	Users    map[string]User
+	Logins   map[string]Session // older snapshots have Sessions, which is ignored
+	Tokens   map[string]Token
+	Venues   map[int]Venue
+	Bookings map[int]Booking
+	Counters map[string]int
+	Notes    map[int]Notification
+}
+
+// snapshot : copy of everything in s
+func (s *MemStore) snapshot() snapshot {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	snap := snapshot{
+		Users:    make(map[string]User, len(s.users)),
+		Logins:   make(map[string]Session, len(s.sessions)),
+		Tokens:   make(map[string]Token, len(s.tokens)),
+		Venues:   make(map[int]Venue, len(s.venues)),
+		Bookings: make(map[int]Booking, len(s.bookings)),
+		Counters: make(map[string]int, len(s.counters)),
+		Notes:    make(map[int]Notification, len(s.notes)),
+	}
+	for k, v := range s.users {
+		snap.Users[k] = v
+	}
+	for k, v := range s.sessions {
+		snap.Logins[k] = v
+	}
+	for k, v := range s.tokens {
+		snap.Tokens[k] = v
+	}
+	for k, v := range s.venues {
+		snap.Venues[k] = v
+	}
+	for k, v := range s.bookings {
+		snap.Bookings[k] = v
+	}
+	for k, v := range s.counters {
+		snap.Counters[k] = v
+	}
+	for k, v := range s.notes {
+		snap.Notes[k] = v
+	}
+	return snap
+}
+
+// JournalStore : Store kept in memory for speed. Every write is appended
+// to a journal file and synced before it is applied, and the whole store
+// is snapshotted periodically, after which the journal starts again empty.
+// Opening the store loads the snapshot and replays the journal on top
+type JournalStore struct {
+	mu      sync.Mutex // orders journal appends and snapshots
+	dir     string
+	mem     *MemStore
+	journal *os.File
+	entries int // appended since the last snapshot
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+//OpenJournalStore : open or create the journal in directory dir,
+//snapshotting every interval while open
+func OpenJournalStore(dir string, every time.Duration) (*JournalStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	s := &JournalStore{
+		dir:  dir,
+		mem:  NewMemStore(),
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	if err := s.loadSnapshot(); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(filepath.Join(dir, journalFile), os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	s.journal = f
+	if err := s.replay(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	go s.run(every)
+	return s, nil
+}
+
+// loadSnapshot : fill mem from the snapshot file, if there is one
+func (s *JournalStore) loadSnapshot() error {
+	data, err := os.ReadFile(filepath.Join(s.dir, snapshotFile))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var snap snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return err
+	}
+	for _, u := range snap.Users {
+		s.mem.PutUser(u)
+	}
+	for _, sess := range snap.Logins {
+		s.mem.PutSession(sess)
+	}
+	for _, t := range snap.Tokens {
+		s.mem.PutToken(t)
+	}
+	for id, v := range snap.Venues {
+		s.mem.PutVenue(id, v)
+	}
+	for _, b := range snap.Bookings {
+		s.mem.PutBooking(b)
+	}
+	for name, next := range snap.Counters {
+		s.mem.PutCounter(name, next)
+	}
+	for _, n := range snap.Notes {
+		s.mem.PutNotification(n)
+	}
+	return nil
+}
+
+// replay : apply every entry of the journal to mem in order.
+// A last line cut short by a crash has no newline and is dropped from
+// the file. Any other line that cannot be read is ErrJournalCorrupt, the
+// entries after it are kept for someone to look at
+func (s *JournalStore) replay() error {
+	r := bufio.NewReader(s.journal)
+	var good int64
+	for n := 1; ; n++ {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			// no newline, the write never finished
+			break
+		}
+		if err != nil {
+			return err
+		}
+		var e journalEntry
+		if err := json.Unmarshal(bytes.TrimSpace(line), &e); err != nil {
+			return fmt.Errorf("%w, line %d: %v", ErrJournalCorrupt, n, err)
+		}
+		e.apply(s.mem)
+		good += int64(len(line))
+		s.entries++
+	}
+	if err := s.journal.Truncate(good); err != nil {
+		return err
+	}
+	_, err := s.journal.Seek(good, 0)
+	return err
+}
+
+// write : append e to the journal, then apply it
+func (s *JournalStore) write(e journalEntry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.journal.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	if err := s.journal.Sync(); err != nil {
+		return err
+	}
+	e.apply(s.mem)
+	s.entries++
+	return nil
+}
+
+func (s *JournalStore) run(every time.Duration) {
+	defer close(s.done)
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.Snapshot()
+		}
+	}
+}
+
+//Snapshot : write everything to the snapshot file and empty the journal.
+//The new snapshot replaces the old one in a single rename, a crash before
+//the journal is emptied only means its entries are applied twice, which
+//leaves the same state
+func (s *JournalStore) Snapshot() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.entries == 0 {
+		return nil
+	}
+	data, err := json.Marshal(s.mem.snapshot())
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(s.dir, snapshotFile+".tmp")
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(s.dir, snapshotFile)); err != nil {
+		return err
+	}
+	// the rename must be on disk before the journal it replaces is emptied
+	if err := syncDir(s.dir); err != nil {
+		return err
+	}
+	if err := s.journal.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := s.journal.Seek(0, 0); err != nil {
+		return err
+	}
+	s.entries = 0
+	return nil
+}
+
+// syncDir : flush the entries of directory dir, so files renamed into it
+// survive a crash
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	err = d.Sync()
+	if cerr := d.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+//User : user with username
+func (s *JournalStore) User(username string) (User, error) {
+	return s.mem.User(username)
+}
+
+//Users : every user by username
+func (s *JournalStore) Users() (map[string]User, error) {
+	return s.mem.Users()
+}
+
+//PutUser : add or replace u
+func (s *JournalStore) PutUser(u User) error {
+	return s.write(journalEntry{Op: opPutUser, User: &u})
+}
+
+//Session : login with session id
+func (s *JournalStore) Session(id string) (Session, error) {
+	return s.mem.Session(id)
+}
+
+//Sessions : every login by session id
+func (s *JournalStore) Sessions() (map[string]Session, error) {
+	return s.mem.Sessions()
+}
+
+//PutSession : add or replace login sess
+func (s *JournalStore) PutSession(sess Session) error {
+	return s.write(journalEntry{Op: opPutSession, Login: &sess})
+}
+
+//DeleteSession : log session id out
+func (s *JournalStore) DeleteSession(id string) error {
+	return s.write(journalEntry{Op: opDeleteSession, Session: id})
+}
+
+//Token : token stored under hash
+func (s *JournalStore) Token(hash string) (Token, error) {
+	return s.mem.Token(hash)
+}
+
+//Tokens : every token by hash
+func (s *JournalStore) Tokens() (map[string]Token, error) {
+	return s.mem.Tokens()
+}
+
+//PutToken : add or replace t
+func (s *JournalStore) PutToken(t Token) error {
+	return s.write(journalEntry{Op: opPutToken, Token: &t})
+}
+
+//DeleteToken : remove token stored under hash
+func (s *JournalStore) DeleteToken(hash string) error {
+	return s.write(journalEntry{Op: opDeleteToken, Session: hash})
+}
+
+//Venues : every venue by id
+func (s *JournalStore) Venues() (map[int]Venue, error) {
+	return s.mem.Venues()
+}
+
+//PutVenue : add or replace venue id
+func (s *JournalStore) PutVenue(id int, v Venue) error {
+	return s.write(journalEntry{Op: opPutVenue, ID: id, Venue: &v})
+}
+
+//DeleteVenue : remove venue id
+func (s *JournalStore) DeleteVenue(id int) error {
+	return s.write(journalEntry{Op: opDeleteVenue, ID: id})
+}
+
+//Bookings : every booking by id
+func (s *JournalStore) Bookings() (map[int]Booking, error) {
+	return s.mem.Bookings()
+}
+
+//PutBooking : add or replace b
+func (s *JournalStore) PutBooking(b Booking) error {
+	return s.write(journalEntry{Op: opPutBooking, Booking: &b})
+}
+
+//DeleteBooking : remove booking id
+func (s *JournalStore) DeleteBooking(id int) error {
+	return s.write(journalEntry{Op: opDeleteBooking, ID: id})
+}
+
+//Counter : next id counter name gives out
+func (s *JournalStore) Counter(name string) (int, error) {
+	return s.mem.Counter(name)
+}
+
+//PutCounter : set the next id counter name gives out
+func (s *JournalStore) PutCounter(name string, next int) error {
+	return s.write(journalEntry{Op: opPutCounter, Counter: name, ID: next})
+}
+
+//Notifications : every queued notification by id
+func (s *JournalStore) Notifications() (map[int]Notification, error) {
+	return s.mem.Notifications()
+}
+
+//PutNotification : add or replace n
+func (s *JournalStore) PutNotification(n Notification) error {
+	return s.write(journalEntry{Op: opPutNote, Note: &n})
+}
+
+//DeleteNotification : remove notification id
+func (s *JournalStore) DeleteNotification(id int) error {
+	return s.write(journalEntry{Op: opDeleteNote, ID: id})
+}
+
+//Close : stop snapshotting, take a last snapshot and close the journal
+func (s *JournalStore) Close() error {
+	close(s.stop)
+	<-s.done
+	err := s.Snapshot()
+	if cerr := s.journal.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,72 @@
+package model
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// journalOf : journal file of three users written to a store in dir
+func journalOf(t *testing.T, dir string) []byte {
+	t.Helper()
+	s, err := OpenJournalStore(dir, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a", "b", "c"} {
+		if err := s.PutUser(User{Username: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := os.ReadFile(filepath.Join(dir, journalFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// closed without the last snapshot, as after a crash
+	close(s.stop)
+	<-s.done
+	s.journal.Close()
+	return data
+}
+
+func TestJournalTornLastLine(t *testing.T) {
+	dir := t.TempDir()
+	data := journalOf(t, dir)
+	torn := append(data, []byte(`{"Op":"putUser","User":{"Usern`)...)
+	if err := os.WriteFile(filepath.Join(dir, journalFile), torn, 0600); err != nil {
+		t.Fatal(err)
+	}
+	s, err := OpenJournalStore(dir, time.Hour)
+	if err != nil {
+		t.Fatalf("journal with a torn last line did not open, %v", err)
+	}
+	defer s.Close()
+	for _, name := range []string{"a", "b", "c"} {
+		if _, err := s.User(name); err != nil {
+			t.Fatalf("user %s not replayed, %v", name, err)
+		}
+	}
+	if kept, _ := os.ReadFile(filepath.Join(dir, journalFile)); !bytes.Equal(kept, data) {
+		t.Fatalf("torn line not cut from the journal, it is now %q", kept)
+	}
+}
+
+func TestJournalCorruptLine(t *testing.T) {
+	dir := t.TempDir()
+	data := journalOf(t, dir)
+	lines := bytes.SplitAfter(data, []byte("\n"))
+	lines[1] = []byte("{not json\n")
+	corrupt := bytes.Join(lines, nil)
+	if err := os.WriteFile(filepath.Join(dir, journalFile), corrupt, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenJournalStore(dir, time.Hour); !errors.Is(err, ErrJournalCorrupt) {
+		t.Fatalf("journal with a corrupt line opened with %v, want ErrJournalCorrupt", err)
+	}
+	if kept, _ := os.ReadFile(filepath.Join(dir, journalFile)); !bytes.Equal(kept, corrupt) {
+		t.Fatal("entries after the corrupt line were cut from the journal")
+	}
+}
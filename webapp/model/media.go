@@ -0,0 +1,161 @@
+package model
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var (
+	//ErrBlobKey : blob key has characters other than a-z, 0-9, "-" and "."
+	ErrBlobKey = errors.New("invalid blob key")
+	//ErrMediaNotFound : venue has no photo or floor plan with the key
+	ErrMediaNotFound = errors.New("media not found")
+	//ErrTooManyMedia : venue already has as many photos and floor plans as allowed
+	ErrTooManyMedia = errors.New("too many photos and floor plans")
+)
+
+//BlobStore : where uploaded files are kept, by key. It is a
+//http.FileSystem so a http.FileServer can serve what it holds
+type BlobStore interface {
+	http.FileSystem
+	Put(key string, r io.Reader) error
+	Delete(key string) error
+}
+
+//Media : photo or floor plan of a venue. Key and Thumb are blob keys
+type Media struct {
+	Key    string
+	Thumb  string // "" for floor plans, they have no thumbnail
+	Type   string // content type
+	Name   string // file name it was uploaded as
+	Size   int64
+	Width  int // of images, in pixels
+	Height int
+	Added  time.Time
+}
+
+//IsImage : true for photos, false for pdf floor plans
+func (m Media) IsImage() bool {
+	return strings.HasPrefix(m.Type, "image/")
+}
+
+// validKey : true if key is a plain file name, so it cannot reach outside
+// the store
+func validKey(key string) bool {
+	if key == "" || key[0] == '.' {
+		return false
+	}
+	for _, r := range key {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+//DirStore : BlobStore of files in a local directory
+type DirStore struct {
+	dir string
+}
+
+//OpenDirStore : open or create the directory at path
+func OpenDirStore(path string) (*DirStore, error) {
+	if err := os.MkdirAll(path, 0700); err != nil {
+		return nil, err
+	}
+	return &DirStore{dir: path}, nil
+}
+
+//Put : write r as key. It is written aside and renamed into place so
+//key is never seen half written
+func (s *DirStore) Put(key string, r io.Reader) error {
+	if !validKey(key) {
+		return ErrBlobKey
+	}
+	f, err := os.CreateTemp(s.dir, ".put-*")
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), filepath.Join(s.dir, key))
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+//Delete : remove key, it is not an error if there was no such key
+func (s *DirStore) Delete(key string) error {
+	if !validKey(key) {
+		return ErrBlobKey
+	}
+	err := os.Remove(filepath.Join(s.dir, key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+//Open : blob with the key name, as a http.File. Directories are not
+//opened so the blobs cannot be listed
+func (s *DirStore) Open(name string) (http.File, error) {
+	key := strings.TrimPrefix(name, "/")
+	if !validKey(key) {
+		return nil, os.ErrNotExist
+	}
+	return http.Dir(s.dir).Open(key)
+}
+
+//AddMedia : add m to venue id, failing with ErrTooManyMedia if it
+//already has max. The count is checked in the update so that uploads
+//at the same time cannot go over it
+func (m *Model) AddMedia(id int, media Media, max int) error {
+	full := false
+	_, err := m.VenueDB.Update(id, func(v *Venue) {
+		if len(v.Media) >= max {
+			full = true
+			return
+		}
+		v.Media = append(v.Media, media)
+	})
+	if err != nil {
+		return err
+	}
+	if full {
+		return ErrTooManyMedia
+	}
+	return nil
+}
+
+//RemoveMedia : take the media with key off venue id, returning it so its
+//blobs can be deleted
+func (m *Model) RemoveMedia(id int, key string) (Media, error) {
+	var removed Media
+	found := false
+	_, err := m.VenueDB.Update(id, func(v *Venue) {
+		for i, media := range v.Media {
+			if media.Key == key {
+				removed, found = media, true
+				v.Media = append(v.Media[:i:i], v.Media[i+1:]...)
+				return
+			}
+		}
+	})
+	if err != nil {
+		return Media{}, err
+	}
+	if !found {
+		return Media{}, ErrMediaNotFound
+	}
+	return removed, nil
+}
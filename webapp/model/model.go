@@ -5,153 +5,490 @@ import (
 	"errors"
 	"fmt"
 	"sort"
-	"strconv"
+	"sync"
 	"time"
 )
 
-const daysLimit = 14
+//DaysLimit : default number of days a venue can be booked ahead
+const DaysLimit = 14
 const maxUint = ^uint(0)
 const minUint = 0
 
-//MinDate :
-const MinDate = 200901
+//errors returned when a booking cannot be made
+var (
+	//ErrVenueNotFound : no venue with the given id
+	ErrVenueNotFound = errors.New("venue not found")
+	//ErrSlotUnavailable : venue has no such slot to book
+	ErrSlotUnavailable = errors.New("slot is not available for booking")
+	//ErrSlotTaken : slot was reserved by someone else first
+	ErrSlotTaken = errors.New("slot already taken")
+	//ErrSlotInPast : slot has already started
+	ErrSlotInPast = errors.New("slot is in the past")
+	//ErrOutsideWindow : slot ends after the venue's booking window
+	ErrOutsideWindow = errors.New("slot is outside the booking window")
+	//ErrInvalidRange : custom range does not end after it starts
+	ErrInvalidRange = errors.New("booking must end after it starts")
+	//ErrOverlap : custom range overlaps an existing booking of the venue
+	ErrOverlap = errors.New("time range overlaps an existing booking")
+	//ErrSlotFree : waitlist joined for a slot that can be booked now
+	ErrSlotFree = errors.New("slot is free, book it instead")
+	//ErrAlreadyWaiting : user already holds or is waiting for the slot
+	ErrAlreadyWaiting = errors.New("already booked or waiting for this slot")
+	//ErrVenueArchived : venue is archived, its slots cannot be booked
+	ErrVenueArchived = errors.New("venue is archived and takes no new bookings")
+)
 
-//MaxDate :
-const MaxDate = 201230
+//waitlist priorities, lower is promoted first
+const (
+	priorityVIP    = 1
+	priorityNormal = 2
+)
 
 /*
 some assumption:
-1 day has 3 slots, morning, afternoon and evening
-book only 2 months in advance to reduce initialization
+1 day is split into the venue's day parts, by default morning, afternoon and evening
+book only 2 weeks in advance by default, the window rolls forward every midnight
 */
 
 // ReserveDT : reservation date time obj
-// Use 2 bst to store available and unavailable datetime
-// bst key : date with format YYMMDDT
-// where T 1 = morning, 2 = Afternoon, 3 = Evening
-// bst satellite value is booking ID
+// Use 2 bst to store available and unavailable slots
+// bst key : slot start in unix seconds, see Slot.Key
+// unavailable bst value is the slot and the booking holding it
+// ranges holds every booking, day part or custom range, by time interval
+// waitlists holds the users queued for each unavailable slot, by slot key
+// closed is set while the venue is archived or being deleted
+// mu guards the trees, the scheduler advances them while handlers read
 type ReserveDT struct {
-	available   Tree
-	unavailable Tree
-	date        Tree
+	mu          sync.RWMutex
+	closed      bool
+	parts       []DayPart
+	days        int // length of booking window
+	available   Tree[int64, Slot]
+	unavailable Tree[int64, reserved]
+	archive     Tree[int64, *Booking] // reserved slots that have passed
+	date        Tree[int64, struct{}] // midnight of each day with slots
+	ranges      intervalTree
+	waitlists   map[int64]*Queue
 }
 
-//Reserve : Reserve venue
-//Mutex
-func (rdt *ReserveDT) Reserve(datetime int, bookID int) {
-	rdt.available.Delete(datetime)
-	rdt.unavailable.AddA(datetime, bookID)
+// reserved : a slot taken by a booking, the booking may cover more than the slot
+type reserved struct {
+	slot    Slot
+	booking *Booking
 }
 
-func (rdt *ReserveDT) delReserve(datetime int) {
-	rdt.unavailable.Delete(datetime)
-	rdt.available.Add(datetime)
+// check : error if slot cannot be booked at now, rdt.mu must be held
+func (rdt *ReserveDT) check(slot Slot, now time.Time) error {
+	if rdt.closed {
+		return ErrVenueArchived
+	}
+	if slot.Part == CustomPart && !slot.End.After(slot.Start) {
+		return ErrInvalidRange
+	}
+	if slot.Start.Before(now) {
+		return ErrSlotInPast
+	}
+	if slot.End.After(rdt.windowEnd()) {
+		return ErrOutsideWindow
+	}
+	if slot.Part == CustomPart {
+		if len(rdt.ranges.Overlapping(slot.interval())) > 0 {
+			return ErrOverlap
+		}
+		return nil
+	}
+	stored, ok := rdt.available.Get(slot.Key())
+	if !ok {
+		if rdt.unavailable.Has(slot.Key()) {
+			return ErrSlotTaken
+		}
+		return ErrSlotUnavailable
+	}
+	if stored.Part != slot.Part || !stored.End.Equal(slot.End) {
+		return ErrSlotUnavailable
+	}
+	return nil
 }
 
-//ReadAvailable : Get all available date
-func (rdt *ReserveDT) ReadAvailable() []int {
-	return rdt.available.Flatten()
+//Check : error if slot, a day part slot or custom range, cannot be booked now
+func (rdt *ReserveDT) Check(slot Slot) error {
+	rdt.mu.RLock()
+	defer rdt.mu.RUnlock()
+	return rdt.check(slot, time.Now())
 }
 
-func (rdt *ReserveDT) init(days int) {
-	t := time.Now()
-	until := t.AddDate(0, 0, days)
-	for t.Before(until) {
-		year, month, day := t.Date()
-		//Date format: YYMMDDT
-		//1 is morning, 2 is afternoon, 3 is evening
-		for i := 1; i <= 3; i++ {
-			formatDate := fmt.Sprintf("%d%02d%02d%d", year%100, int(month), day, i)
-			iformatDate, _ := strconv.Atoi(formatDate)
-			rdt.available.AddA(iformatDate, 0)
+//Reserve : Reserve venue for the slot of booking, an atomic check and set.
+//For a custom range every day part slot it touches becomes unavailable
+func (rdt *ReserveDT) Reserve(booking *Booking) error {
+	rdt.mu.Lock()
+	defer rdt.mu.Unlock()
+	if err := rdt.check(booking.Slot, time.Now()); err != nil {
+		return err
+	}
+	return rdt.hold(booking)
+}
+
+// hold : mark everything booking covers as taken without checking the
+// window, rdt.mu must be held. Fails with ErrSlotTaken or ErrOverlap rather
+// than replace a booking already holding the time
+func (rdt *ReserveDT) hold(booking *Booking) error {
+	iv := booking.Slot.interval()
+	if booking.Slot.Part != CustomPart {
+		if err := rdt.unavailable.Add(booking.Slot.Key(), reserved{slot: booking.Slot, booking: booking}); err != nil {
+			return ErrSlotTaken
 		}
-		formatDateOnly := fmt.Sprintf("%d%02d%02d", year%100, int(month), day)
-		iformatDateOnly, _ := strconv.Atoi(formatDateOnly)
-		rdt.date.Add(iformatDateOnly)
-		t = t.AddDate(0, 0, 1)
+		rdt.available.Delete(booking.Slot.Key())
+		rdt.ranges.Insert(iv, booking)
+		return nil
+	}
+	if len(rdt.ranges.Overlapping(iv)) > 0 {
+		return ErrOverlap
+	}
+	rdt.ranges.Insert(iv, booking)
+	cover := func(k int64) {
+		slot, ok := rdt.available.Get(k)
+		// a key is either available or unavailable, never both
+		if ok && slot.interval().Overlaps(iv) && rdt.unavailable.Add(k, reserved{slot: slot, booking: booking}) == nil {
+			rdt.available.Delete(k)
+		}
+	}
+	// a slot starting before the range may still run into it
+	if k, ok := rdt.available.Floor(iv.Start.Unix()); ok {
+		cover(k)
 	}
+	for _, k := range rdt.available.Range(iv.Start.Unix(), iv.End.Unix()-1) {
+		cover(k)
+	}
+	return nil
+}
 
+// restore : hold a booking loaded from the store, past ones are archived
+// by the next advance
+func (rdt *ReserveDT) restore(booking *Booking) error {
+	rdt.mu.Lock()
+	defer rdt.mu.Unlock()
+	return rdt.hold(booking)
 }
 
-//GetBookingList return booking list
-func (rdt *ReserveDT) GetBookingList() Queue {
-	//rdt.unavailable.FlattenA
-	datetime, bookid := rdt.unavailable.FlattenA()
-	bookingQ := Queue{}
-	for i := range datetime {
-		bookingQ.enqueue(datetime[i], bookid[i], 3)
+// delReserve : release every slot held by booking.
+// A freed slot with a waitlist goes straight to its first waiter,
+// newBooking records the booking made for them. A nil newBooking undoes a
+// booking that was never made, its slots become available again and
+// anyone who queued for them meanwhile can book them instead of waiting
+func (rdt *ReserveDT) delReserve(booking *Booking, newBooking func(user string, slot Slot) *Booking) []*Booking {
+	rdt.mu.Lock()
+	defer rdt.mu.Unlock()
+	iv := booking.Slot.interval()
+	rdt.ranges.Delete(iv, booking)
+	var freed []Slot
+	it := rdt.unavailable.Seek(iv.Start.Unix())
+	if k, ok := rdt.unavailable.Floor(iv.Start.Unix()); ok {
+		it = rdt.unavailable.Seek(k)
 	}
-	bookingQ.printAllNodes()
-	return bookingQ
+	for ; it.Valid() && it.Key() < iv.End.Unix(); it.Next() {
+		if it.Value().booking == booking {
+			freed = append(freed, it.Value().slot)
+		}
+	}
+	var promoted []*Booking
+	now := time.Now()
+	for _, slot := range freed {
+		rdt.unavailable.Delete(slot.Key())
+		q, waiting := rdt.waitlists[slot.Key()]
+		if newBooking == nil {
+			delete(rdt.waitlists, slot.Key())
+		}
+		if !waiting || newBooking == nil || slot.Start.Before(now) {
+			rdt.available.Put(slot.Key(), slot)
+			continue
+		}
+		waiter, _ := q.dequeue()
+		if q.isEmpty() {
+			delete(rdt.waitlists, slot.Key())
+		}
+		order := newBooking(waiter.user, slot)
+		rdt.unavailable.Put(slot.Key(), reserved{slot: slot, booking: order})
+		rdt.ranges.Insert(slot.interval(), order)
+		promoted = append(promoted, order)
+	}
+	return promoted
 }
 
-//GetDate :return  map[date][time][availability]
-func (rdt *ReserveDT) GetDate(min int, max int) (map[int]map[int]string, []int) {
-	rdates := rdt.date.Flatten()
-	dates := make([]int, 0, len(rdates))
-	for _, i := range rdates {
-		if i >= min && i <= max {
-			dates = append(dates, i)
+// join : queue user for slot, returns their place in the queue
+func (rdt *ReserveDT) join(slot Slot, user string, vip bool) (int, error) {
+	rdt.mu.Lock()
+	defer rdt.mu.Unlock()
+	if slot.Part == CustomPart {
+		return 0, ErrSlotUnavailable
+	}
+	err := rdt.check(slot, time.Now())
+	if err == nil {
+		return 0, ErrSlotFree
+	}
+	if err != ErrSlotTaken {
+		return 0, err
+	}
+	r, _ := rdt.unavailable.Get(slot.Key())
+	if r.slot.Part != slot.Part || !r.slot.End.Equal(slot.End) {
+		return 0, ErrSlotUnavailable
+	}
+	if r.booking.User == user {
+		return 0, ErrAlreadyWaiting
+	}
+	q, exists := rdt.waitlists[slot.Key()]
+	if !exists {
+		q = &Queue{}
+		rdt.waitlists[slot.Key()] = q
+	}
+	if q.position(user) > 0 {
+		return 0, ErrAlreadyWaiting
+	}
+	priority := priorityNormal
+	if vip {
+		priority = priorityVIP
+	}
+	q.enqueue(slot.Key(), 0, user, priority)
+	return q.position(user), nil
+}
+
+// waiting : slots user is queued for with their place, in slot order
+func (rdt *ReserveDT) waiting(user string) []Waiting {
+	rdt.mu.RLock()
+	defer rdt.mu.RUnlock()
+	var places []Waiting
+	for k, q := range rdt.waitlists {
+		if pos := q.position(user); pos > 0 {
+			r, _ := rdt.unavailable.Get(k)
+			places = append(places, Waiting{Slot: r.slot, Position: pos})
 		}
 	}
-	ravailable := rdt.available.Flatten()
-	available := make([]int, 0, len(ravailable))
-	for _, i := range ravailable {
-		if i >= min*10 && i <= max*10+3 {
-			available = append(available, i)
+	sort.Slice(places, func(i, j int) bool {
+		return places[i].Slot.Start.Before(places[j].Slot.Start)
+	})
+	return places
+}
+
+// waiters : every place in every waitlist, by slot then place
+func (rdt *ReserveDT) waiters() []Waiting {
+	rdt.mu.RLock()
+	defer rdt.mu.RUnlock()
+	var places []Waiting
+	for k, q := range rdt.waitlists {
+		r, _ := rdt.unavailable.Get(k)
+		pos := 0
+		for n := q.front; n != nil; n = n.next {
+			pos++
+			places = append(places, Waiting{User: n.user, Slot: r.slot, Position: pos})
 		}
 	}
-	runavailable := rdt.unavailable.Flatten()
-	unavailable := make([]int, 0, len(runavailable))
-	for _, i := range runavailable {
-		if i >= min*10 && i <= max*10+3 {
-			unavailable = append(unavailable, i)
+	sort.Slice(places, func(i, j int) bool {
+		if !places[i].Slot.Start.Equal(places[j].Slot.Start) {
+			return places[i].Slot.Start.Before(places[j].Slot.Start)
 		}
+		return places[i].Position < places[j].Position
+	})
+	return places
+}
+
+//WindowEnd : end of the last day with slots
+func (rdt *ReserveDT) WindowEnd() time.Time {
+	rdt.mu.RLock()
+	defer rdt.mu.RUnlock()
+	return rdt.windowEnd()
+}
+
+func (rdt *ReserveDT) windowEnd() time.Time {
+	last, err := rdt.date.Max()
+	if err != nil {
+		return time.Time{}
 	}
+	return time.Unix(last, 0).In(Location).AddDate(0, 0, 1)
+}
 
-	bookingData := make(map[int]map[int]string)
+//FreeIntervals : gaps between from and to not covered by any booking
+func (rdt *ReserveDT) FreeIntervals(from time.Time, to time.Time) []Interval {
+	rdt.mu.RLock()
+	defer rdt.mu.RUnlock()
+	free := make([]Interval, 0)
+	cur := from
+	for _, b := range rdt.ranges.Overlapping(Interval{Start: from, End: to}) {
+		if b.Slot.Start.After(cur) {
+			free = append(free, Interval{Start: cur, End: b.Slot.Start})
+		}
+		if b.Slot.End.After(cur) {
+			cur = b.Slot.End
+		}
+	}
+	if cur.Before(to) {
+		free = append(free, Interval{Start: cur, End: to})
+	}
+	return free
+}
+
+//ReadAvailable : Get all available slots
+func (rdt *ReserveDT) ReadAvailable() []Slot {
+	rdt.mu.RLock()
+	defer rdt.mu.RUnlock()
+	return rdt.available.Values()
+}
+
+//Parts : day parts each day is split into
+func (rdt *ReserveDT) Parts() []DayPart {
+	return rdt.parts
+}
+
+//Window : number of days ahead the venue can be booked
+func (rdt *ReserveDT) Window() int {
+	return rdt.days
+}
+
+//GetSlot : slot starting at key, whether available or not
+func (rdt *ReserveDT) GetSlot(key int64) (Slot, bool) {
+	rdt.mu.RLock()
+	defer rdt.mu.RUnlock()
+	if slot, ok := rdt.available.Get(key); ok {
+		return slot, true
+	}
+	if r, ok := rdt.unavailable.Get(key); ok {
+		return r.slot, true
+	}
+	return Slot{}, false
+}
 
-	for _, v := range available {
-		dateOnly := v / 10
-		times := v % 10
-		_, exists := bookingData[dateOnly]
-		if exists {
-			bookingData[dateOnly][times] = "AVAILABLE"
-		} else {
-			timeData := make(map[int]string)
-			timeData[times] = "AVAILABLE"
-			bookingData[dateOnly] = timeData
+func (rdt *ReserveDT) init(days int, parts []DayPart) {
+	rdt.parts = parts
+	rdt.days = days
+	rdt.waitlists = make(map[int64]*Queue)
+	rdt.fill(dayStart(time.Now()))
+}
+
+// fill : add slots for every day of the window starting at today
+// that does not have them yet
+func (rdt *ReserveDT) fill(today time.Time) {
+	for i := 0; i < rdt.days; i++ {
+		day := today.AddDate(0, 0, i)
+		if rdt.date.Has(day.Unix()) {
+			continue
 		}
+		for j, p := range rdt.parts {
+			slot := p.on(day, j)
+			rdt.available.Put(slot.Key(), slot)
+		}
+		rdt.date.Put(day.Unix(), struct{}{})
+	}
+}
 
+// advance : roll the window forward to start at the day of now.
+// Past available slots are dropped, past reserved slots move to archive
+func (rdt *ReserveDT) advance(now time.Time) {
+	rdt.mu.Lock()
+	defer rdt.mu.Unlock()
+	today := dayStart(now)
+	cutoff := today.Unix()
+	for k, err := rdt.available.Min(); err == nil && k < cutoff; k, err = rdt.available.Min() {
+		rdt.available.Delete(k)
+	}
+	for k, err := rdt.unavailable.Min(); err == nil && k < cutoff; k, err = rdt.unavailable.Min() {
+		r, _ := rdt.unavailable.Get(k)
+		rdt.archive.Put(k, r.booking)
+		rdt.unavailable.Delete(k)
 	}
-	for _, v := range unavailable {
-		dateOnly := v / 10
-		times := v % 10
-		_, exists := bookingData[dateOnly]
-		if exists {
-			bookingData[dateOnly][times] = "UNAVAILABLE"
-		} else {
-			timeData := make(map[int]string)
-			timeData[times] = "UNAVAILABLE"
-			bookingData[dateOnly] = timeData
+	for k := range rdt.waitlists {
+		if k < cutoff {
+			delete(rdt.waitlists, k)
 		}
 	}
-	return bookingData, dates
+	for _, b := range rdt.ranges.Overlapping(Interval{Start: time.Unix(0, 0), End: today}) {
+		if !b.Slot.End.After(today) {
+			rdt.ranges.Delete(b.Slot.interval(), b)
+		}
+	}
+	for k, err := rdt.date.Min(); err == nil && k < cutoff; k, err = rdt.date.Min() {
+		rdt.date.Delete(k)
+	}
+	rdt.fill(today)
 }
 
-type date struct {
-	year  int
-	month int
-	day   int
+//GetBookingList return booking list
+func (rdt *ReserveDT) GetBookingList() Queue {
+	rdt.mu.RLock()
+	defer rdt.mu.RUnlock()
+	bookingQ := Queue{}
+	for it := rdt.unavailable.Iter(); it.Valid(); it.Next() {
+		b := it.Value().booking
+		bookingQ.enqueue(it.Key(), b.IDBook, b.User, 3)
+	}
+	bookingQ.printAllNodes()
+	return bookingQ
+}
+
+//SlotState : slot with its availability
+//Status is AVAILABLE, UNAVAILABLE or empty when the day has no such slot
+type SlotState struct {
+	Slot
+	Status string
+}
+
+//DayState : one day of slots, indexed by day part
+type DayState struct {
+	Date  time.Time
+	Slots []SlotState
+}
+
+//GetDate :return availability of each day between from and to
+// only keys between from and to are walked
+func (rdt *ReserveDT) GetDate(from time.Time, to time.Time) []DayState {
+	rdt.mu.RLock()
+	defer rdt.mu.RUnlock()
+	days := make([]DayState, 0)
+	index := make(map[int64]int)
+	for it := rdt.date.Seek(dayStart(from).Unix()); it.Valid() && it.Key() <= to.Unix(); it.Next() {
+		index[it.Key()] = len(days)
+		days = append(days, DayState{
+			Date:  time.Unix(it.Key(), 0).In(Location),
+			Slots: make([]SlotState, len(rdt.parts)),
+		})
+	}
+	mark := func(slot Slot, status string) {
+		i, exists := index[dayStart(slot.Start).Unix()]
+		if exists && slot.Part < len(rdt.parts) {
+			days[i].Slots[slot.Part] = SlotState{Slot: slot, Status: status}
+		}
+	}
+	for it := rdt.available.Seek(from.Unix()); it.Valid() && it.Key() <= to.Unix(); it.Next() {
+		mark(it.Value(), "AVAILABLE")
+	}
+	for it := rdt.unavailable.Seek(from.Unix()); it.Valid() && it.Key() <= to.Unix(); it.Next() {
+		mark(it.Value().slot, "UNAVAILABLE")
+	}
+	return days
 }
 
 //Venue :
 type Venue struct {
-	Capacity int
-	Kind     string
-	Location string
-	Name     string
-	Desc     string
+	Capacity  int
+	Kind      string
+	Location  string
+	Name      string
+	Desc      string
+	DayParts  []DayPart          // nil for DefaultDayParts
+	Window    int                // days ahead bookable, 0 for DaysLimit
+	Owner     string             // username of the venue manager who added it
+	Archived  bool               // not found by searches and closed to new bookings
+	Amenities []string           // keys of Amenities it has
+	Tags      []string           // lower case, free form
+	Attrs     map[string]float64 // value of each of Attributes it has
+	Media     []Media            // photos and floor plans, in the order added
+}
+
+// setKeys : sorted members of an int set
+func setKeys(m map[int]bool) []int {
+	keys := make([]int, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	return keys
 }
 
 //Intersect : intersection of 2 int array
@@ -170,14 +507,21 @@ func Intersect(a []int, b []int) []int {
 }
 
 //categorical data stored as map, numerical data stored as tree. this is to facilitate search
+// mu guards every field, handlers read while admins add venues
 type venueDB struct {
+	mu sync.RWMutex
 	//Venues :
 	Venues       map[int]Venue
 	kindMap      map[string][]int
 	locationMap  map[string][]int
-	capacityTree *Tree
+	amenityMap   map[string][]int
+	tagMap       map[string][]int
+	attrTrees    map[string]*Tree[float64, map[int]bool] // attribute to value to set of venue id
+	capacityTree *Tree[int, map[int]bool]                // capacity to set of venue id
+	text         *textIndex                              // words of names and descriptions
 	counter      int
 	VenueMap     map[int]string
+	store        Store
 }
 
 // Query :
@@ -186,18 +530,20 @@ type Query struct {
 	CapMin   int
 	CapMax   int
 	Kind     string
-	DateMin  int
-	DateMax  int
+	DateMin  time.Time // free between DateMin and DateMax, zero for any
+	DateMax  time.Time
+	Text     string // words to look for in names and descriptions, "" for any
+	// venues with all of Amenities and all of Tags, or with any of
+	// Amenities and any of Tags if AnyOf is true
+	Amenities []string
+	Tags      []string
+	AnyOf     bool
+	Attrs     map[string]Range // attributes venues must have within a range
 }
 
-func getMapKey(m map[int]Venue) []int {
-	result := make([]int, 0, len(m))
-	for k := range m {
-		result = append(result, k)
-	}
-	return result
-}
 func (vDB *venueDB) KindList() []string {
+	vDB.mu.RLock()
+	defer vDB.mu.RUnlock()
 	keys := make([]string, 0, len(vDB.kindMap))
 	for k := range vDB.kindMap {
 		keys = append(keys, k)
@@ -207,6 +553,8 @@ func (vDB *venueDB) KindList() []string {
 }
 
 func (vDB *venueDB) LocationList() []string {
+	vDB.mu.RLock()
+	defer vDB.mu.RUnlock()
 	keys := make([]string, 0, len(vDB.locationMap))
 	for k := range vDB.locationMap {
 		keys = append(keys, k)
@@ -216,14 +564,27 @@ func (vDB *venueDB) LocationList() []string {
 }
 
 func (vDB *venueDB) Caps() (int, int) {
-	caps := vDB.capacityTree.Flatten()
-	minCap := caps[0]
-	maxCap := caps[len(caps)-1]
+	vDB.mu.RLock()
+	defer vDB.mu.RUnlock()
+	minCap, err := vDB.capacityTree.Min()
+	if err != nil {
+		return 0, 0
+	}
+	maxCap, _ := vDB.capacityTree.Max()
 	return minCap, maxCap
 }
 
+//Filter : venues matching q and their ids, in order of relevance to
+//q.Text if it is given. DateMin and DateMax need the reservations, see
+//Model.Search
 func (vDB *venueDB) Filter(q Query) (map[int]Venue, []int) {
-	result := getMapKey(vDB.Venues)
+	vDB.mu.RLock()
+	defer vDB.mu.RUnlock()
+	// only capacities within range are walked
+	result := make([]int, 0)
+	for it := vDB.capacityTree.Seek(q.CapMin); it.Valid() && it.Key() <= q.CapMax; it.Next() {
+		result = append(result, setKeys(it.Value())...)
+	}
 	r1, _ := vDB.locationMap[q.Location]
 	if q.Location != "Nil" {
 		result = Intersect(result, r1)
@@ -232,45 +593,92 @@ func (vDB *venueDB) Filter(q Query) (map[int]Venue, []int) {
 	if q.Kind != "Nil" {
 		result = Intersect(result, r2)
 	}
+	if len(q.Amenities) > 0 {
+		result = Intersect(having(vDB.amenityMap, q.Amenities, q.AnyOf), result)
+	}
+	if len(q.Tags) > 0 {
+		result = Intersect(having(vDB.tagMap, q.Tags, q.AnyOf), result)
+	}
+	for key, r := range q.Attrs {
+		result = Intersect(vDB.within(key, r), result)
+	}
+	if ranked, ok := vDB.text.search(q.Text); ok {
+		// keeps the order of ranked, most relevant first
+		result = Intersect(result, ranked)
+	}
 	finalResult := make(map[int]Venue)
 	finalOrder := make([]int, 0, len(result))
 	for _, mapIndex := range result {
-		v := vDB.Venues[mapIndex]
-		if v.Capacity >= q.CapMin && v.Capacity <= q.CapMax {
-			finalOrder = append(finalOrder, mapIndex)
-			finalResult[mapIndex] = v
-		}
+		finalOrder = append(finalOrder, mapIndex)
+		finalResult[mapIndex] = vDB.Venues[mapIndex]
 	}
 	return finalResult, finalOrder
 }
 
-func (vDB *venueDB) addMap(m map[string][]int, s string) {
+func (vDB *venueDB) addMap(m map[string][]int, s string, id int) {
 	_, exists := m[s]
 	if exists {
-		m[s] = append(m[s], vDB.counter)
+		m[s] = append(m[s], id)
 	} else {
 		m[s] = make([]int, 0)
-		m[s] = append(m[s], vDB.counter)
+		m[s] = append(m[s], id)
 	}
 }
 
-func (vDB *venueDB) AddVenue(v Venue) error {
-	_, exists := vDB.GetID(v.Name)
-	if !exists {
-		vDB.Venues[vDB.counter] = v
-		vDB.addMap(vDB.kindMap, v.Kind)
-		vDB.addMap(vDB.locationMap, v.Location)
-		vDB.capacityTree.Add(v.Capacity)
-		vDB.counter++
-	} else {
-		msg := fmt.Sprintf("Error, %s already exists!", v.Name)
-		return errors.New(msg)
+//AddVenue : add v, returning its id
+func (vDB *venueDB) AddVenue(v Venue) (int, error) {
+	vDB.mu.Lock()
+	defer vDB.mu.Unlock()
+	id := vDB.counter
+	_, exists := vDB.getID(v.Name)
+	if exists {
+		return 0, fmt.Errorf("%w, %s", ErrVenueExists, v.Name)
+	}
+	v, err := features(v)
+	if err != nil {
+		return 0, err
+	}
+	// the counter is saved first, a crash in between only skips an id
+	if err := vDB.store.PutCounter(venueCounter, id+1); err != nil {
+		return 0, err
+	}
+	if err := vDB.store.PutVenue(id, v); err != nil {
+		return 0, err
 	}
+	vDB.put(id, v)
+	return id, nil
+}
 
-	return nil
+// put : index v under id, archived venues are left out of the search
+// indexes. vDB.mu must be held
+func (vDB *venueDB) put(id int, v Venue) {
+	vDB.Venues[id] = v
+	vDB.VenueMap[id] = v.Name
+	if id >= vDB.counter {
+		vDB.counter = id + 1
+	}
+	if v.Archived {
+		return
+	}
+	vDB.addMap(vDB.kindMap, v.Kind, id)
+	vDB.addMap(vDB.locationMap, v.Location, id)
+	ids, exists := vDB.capacityTree.Get(v.Capacity)
+	if !exists {
+		ids = make(map[int]bool)
+		vDB.capacityTree.Put(v.Capacity, ids)
+	}
+	ids[id] = true
+	vDB.indexFeatures(id, v)
+	vDB.text.add(id, v)
 }
 
 func (vDB *venueDB) GetID(name string) (int, bool) {
+	vDB.mu.RLock()
+	defer vDB.mu.RUnlock()
+	return vDB.getID(name)
+}
+
+func (vDB *venueDB) getID(name string) (int, bool) {
 	for k, v := range vDB.Venues {
 		if v.Name == name {
 			return k, true
@@ -279,94 +687,398 @@ func (vDB *venueDB) GetID(name string) (int, bool) {
 	return 0, false
 }
 
+//Get : venue with id
+func (vDB *venueDB) Get(id int) (Venue, bool) {
+	vDB.mu.RLock()
+	defer vDB.mu.RUnlock()
+	v, exists := vDB.Venues[id]
+	return v, exists
+}
+
+//All : copy of every venue by id
+func (vDB *venueDB) All() map[int]Venue {
+	vDB.mu.RLock()
+	defer vDB.mu.RUnlock()
+	venues := make(map[int]Venue, len(vDB.Venues))
+	for k, v := range vDB.Venues {
+		venues[k] = v
+	}
+	return venues
+}
+
+//Names : copy of VenueMap, venue name by id
+func (vDB *venueDB) Names() map[int]string {
+	vDB.mu.RLock()
+	defer vDB.mu.RUnlock()
+	names := make(map[int]string, len(vDB.VenueMap))
+	for k, v := range vDB.VenueMap {
+		names[k] = v
+	}
+	return names
+}
+
 //Booking :
 type Booking struct {
-	IDBook   int
-	User     string
-	VenueID  int
-	Datetime int
+	IDBook  int
+	User    string
+	VenueID int
+	Slot    Slot
 }
 
-// Bookings id start from 1
+// Bookings id start from 1, counter is the next id to give out
 // venueReserve , k: venue id, v: DateTime
+// mu guards Bookings, VenueReserve and counter
 type bookingDB struct {
+	mu           sync.RWMutex
 	Bookings     map[int]*Booking
 	VenueReserve map[int]*ReserveDT
+	counter      int
+	store        Store
 }
 
-func (b *bookingDB) getBookingID(vid int, date int) int {
-	return b.VenueReserve[vid].unavailable.root.find(date).bookID
+// add : record order made by rdt in the store, releasing it again
+// if that fails. b.mu must be held
+func (b *bookingDB) add(rdt *ReserveDT, order *Booking) error {
+	if err := b.save(*order); err != nil {
+		// undo the hold without promoting anyone, the booking was never made
+		rdt.delReserve(order, nil)
+		return err
+	}
+	b.Bookings[order.IDBook] = order
+	b.counter++
+	return nil
 }
-func (b *bookingDB) getBookingDetails(vid int, date int) *Booking {
-	bid := b.getBookingID(vid, date)
-	return b.Bookings[bid]
+
+// save : store new booking order, and the counter past its id first so a
+// crash in between only skips an id. b.mu must be held
+func (b *bookingDB) save(order Booking) error {
+	if err := b.store.PutCounter(bookingCounter, order.IDBook+1); err != nil {
+		return err
+	}
+	return b.store.PutBooking(order)
 }
 
-// Reserve :
-func (b *bookingDB) Reserve(venueID int, datetime int, user string) int {
+func (b *bookingDB) getBookingID(vid int, slot Slot) int {
+	booking := b.getBookingDetails(vid, slot)
+	if booking == nil {
+		return 0
+	}
+	return booking.IDBook
+}
+func (b *bookingDB) getBookingDetails(vid int, slot Slot) *Booking {
+	rdt, exists := b.Venue(vid)
+	if !exists {
+		return nil
+	}
+	rdt.mu.RLock()
+	defer rdt.mu.RUnlock()
+	r, _ := rdt.unavailable.Get(slot.Key())
+	return r.booking
+}
+
+//Venue : reservations of venue vid
+func (b *bookingDB) Venue(vid int) (*ReserveDT, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	rdt, exists := b.VenueReserve[vid]
+	return rdt, exists
+}
+
+// reserves : snapshot of every venue's reservations
+func (b *bookingDB) reserves() []*ReserveDT {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	rdts := make([]*ReserveDT, 0, len(b.VenueReserve))
+	for _, rdt := range b.VenueReserve {
+		rdts = append(rdts, rdt)
+	}
+	return rdts
+}
+
+//Get : booking with id
+func (b *bookingDB) Get(bookID int) (*Booking, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	booking, exists := b.Bookings[bookID]
+	return booking, exists
+}
+
+//VenueBookings : bookings of venue vid, by start time
+func (b *bookingDB) VenueBookings(vid int) []Booking {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	bookings := make([]Booking, 0)
+	for _, booking := range b.Bookings {
+		if booking.VenueID == vid {
+			bookings = append(bookings, *booking)
+		}
+	}
+	sort.Slice(bookings, func(i, j int) bool {
+		return bookings[i].Slot.Start.Before(bookings[j].Slot.Start)
+	})
+	return bookings
+}
+
+// Check : error if slot of venue cannot be booked now, see Reserve
+func (b *bookingDB) Check(venueID int, slot Slot) error {
+	rdt, exists := b.Venue(venueID)
+	if !exists {
+		return ErrVenueNotFound
+	}
+	return rdt.Check(slot)
+}
+
+// Reserve : book slot of venue for user, returns booking id.
+// Fails with ErrVenueNotFound, ErrSlotUnavailable, ErrSlotTaken,
+// ErrSlotInPast or ErrOutsideWindow, and for a custom range slot
+// ErrInvalidRange or ErrOverlap
+func (b *bookingDB) Reserve(venueID int, slot Slot, user string) (int, error) {
+	rdt, exists := b.Venue(venueID)
+	if !exists {
+		return 0, ErrVenueNotFound
+	}
+	// hold mu so the id is only used once the slot is ours
+	b.mu.Lock()
+	defer b.mu.Unlock()
 	order := Booking{
-		IDBook:   len(b.Bookings) + 1,
-		User:     user,
-		Datetime: datetime,
-		VenueID:  venueID,
+		IDBook:  b.counter,
+		User:    user,
+		Slot:    slot,
+		VenueID: venueID,
+	}
+	if err := rdt.Reserve(&order); err != nil {
+		return 0, err
+	}
+	if err := b.add(rdt, &order); err != nil {
+		return 0, err
 	}
-	b.Bookings[order.IDBook] = &order
-	b.VenueReserve[order.VenueID].Reserve(order.Datetime, order.IDBook)
-	return order.IDBook
+	return order.IDBook, nil
 }
 
-func (b *bookingDB) DelReserve(venueID int, datetime int) {
-	b.VenueReserve[venueID].delReserve(datetime)
+// DelReserve : cancel booking, freeing what it reserved.
+// Returns the bookings made for waiters promoted into the freed slots
+func (b *bookingDB) DelReserve(bookID int) ([]*Booking, error) {
+	// hold mu for the whole release so promoted ids are not reused
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	booking, exists := b.Bookings[bookID]
+	if !exists {
+		return nil, nil
+	}
+	if err := b.store.DeleteBooking(bookID); err != nil {
+		return nil, err
+	}
+	delete(b.Bookings, bookID)
+	rdt, exists := b.VenueReserve[booking.VenueID]
+	if !exists {
+		return nil, nil
+	}
+	var err error
+	newBooking := func(user string, slot Slot) *Booking {
+		order := Booking{
+			IDBook:  b.counter,
+			User:    user,
+			Slot:    slot,
+			VenueID: booking.VenueID,
+		}
+		b.counter++
+		b.Bookings[order.IDBook] = &order
+		if e := b.save(order); e != nil && err == nil {
+			err = e
+		}
+		return &order
+	}
+	return rdt.delReserve(booking, newBooking), err
+}
+
+//Waiting : a user's place in the waitlist of a slot
+type Waiting struct {
+	User     string
+	VenueID  int
+	Slot     Slot
+	Position int // 1 is next in line
+}
+
+// Waitlist : queue user for a taken slot of venue, vip users are promoted
+// before everyone else. Returns the user's place in the queue.
+// Fails with ErrVenueNotFound, ErrSlotFree, ErrAlreadyWaiting, ErrSlotUnavailable,
+// ErrSlotInPast or ErrOutsideWindow
+func (b *bookingDB) Waitlist(venueID int, slot Slot, user string, vip bool) (int, error) {
+	rdt, exists := b.Venue(venueID)
+	if !exists {
+		return 0, ErrVenueNotFound
+	}
+	return rdt.join(slot, user, vip)
+}
+
+// Waiting : every waitlist user is in, by venue id then slot
+func (b *bookingDB) Waiting(user string) []Waiting {
+	b.mu.RLock()
+	ids := make([]int, 0, len(b.VenueReserve))
+	for vid := range b.VenueReserve {
+		ids = append(ids, vid)
+	}
+	b.mu.RUnlock()
+	sort.Ints(ids)
+	places := make([]Waiting, 0)
+	for _, vid := range ids {
+		rdt, _ := b.Venue(vid)
+		for _, w := range rdt.waiting(user) {
+			w.VenueID = vid
+			places = append(places, w)
+		}
+	}
+	return places
+}
+
+// FreeIntervals : gaps between from and to when venue has no booking
+func (b *bookingDB) FreeIntervals(venueID int, from time.Time, to time.Time) []Interval {
+	rdt, exists := b.Venue(venueID)
+	if !exists {
+		return nil
+	}
+	return rdt.FreeIntervals(from, to)
 }
 
 // Model : consolidate all neede obj
 type Model struct {
 	VenueDB   *venueDB
 	BookingDB *bookingDB
+	UserDB    *userDB
+	NotifyDB  *notifyDB
+	Store     Store
 }
 
-//InitModel : creates all needed obj for the app
-func InitModel() Model {
+//InitModel : creates all needed obj for the app, loading
+//venues and bookings already in store
+func InitModel(store Store) (Model, error) {
 	venues := make(map[int]Venue)
 	kindMap := make(map[string][]int)
 	locationMap := make(map[string][]int)
 	VenueMap := make(map[int]string)
-	capacityTree := Tree{}
+	capacityTree := Tree[int, map[int]bool]{}
 	venueDB := venueDB{
 		Venues:       venues,
 		kindMap:      kindMap,
 		locationMap:  locationMap,
+		amenityMap:   make(map[string][]int),
+		tagMap:       make(map[string][]int),
+		attrTrees:    make(map[string]*Tree[float64, map[int]bool]),
 		capacityTree: &capacityTree,
+		text:         newTextIndex(),
 		counter:      1,
 		VenueMap:     VenueMap,
+		store:        store,
 	}
 	bookings := make(map[int]*Booking)
 	reDT := make(map[int]*ReserveDT)
 	bookingDB := bookingDB{
 		Bookings:     bookings,
 		VenueReserve: reDT,
+		counter:      1,
+		store:        store,
 	}
 	model := Model{
 		VenueDB:   &venueDB,
 		BookingDB: &bookingDB,
+		UserDB:    &userDB{store: store},
+		NotifyDB: &notifyDB{
+			counter: 1,
+			store:   store,
+			wake:    make(chan struct{}, 1),
+		},
+		Store: store,
+	}
+	return model, model.load()
+}
+
+// load : rebuild venues and bookings from the store, in id order,
+// and carry on numbering queued notifications
+func (m *Model) load() error {
+	venues, err := m.Store.Venues()
+	if err != nil {
+		return err
+	}
+	ids := make([]int, 0, len(venues))
+	for id := range venues {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		m.VenueDB.put(id, venues[id])
+		m.addReserve(id, venues[id])
+	}
+	bookings, err := m.Store.Bookings()
+	if err != nil {
+		return err
 	}
-	return model
+	ids = ids[:0]
+	for id := range bookings {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		booking := bookings[id]
+		if rdt, exists := m.BookingDB.VenueReserve[booking.VenueID]; exists {
+			if err := rdt.restore(&booking); err != nil {
+				return fmt.Errorf("booking %d of venue %d: %w", id, booking.VenueID, err)
+			}
+		}
+		m.BookingDB.Bookings[id] = &booking
+		m.BookingDB.counter = id + 1
+	}
+	// ids of the last venues and bookings may have been deleted since
+	if next, err := m.Store.Counter(venueCounter); err != nil {
+		return err
+	} else if next > m.VenueDB.counter {
+		m.VenueDB.counter = next
+	}
+	if next, err := m.Store.Counter(bookingCounter); err != nil {
+		return err
+	} else if next > m.BookingDB.counter {
+		m.BookingDB.counter = next
+	}
+	notes, err := m.Store.Notifications()
+	if err != nil {
+		return err
+	}
+	for id := range notes {
+		if id >= m.NotifyDB.counter {
+			m.NotifyDB.counter = id + 1
+		}
+	}
+	m.Advance(time.Now())
+	return nil
 }
 
 //AddVenue :
 func (m *Model) AddVenue(v Venue) error {
-	venueID := m.VenueDB.counter
-	e := m.VenueDB.AddVenue(v)
+	venueID, e := m.VenueDB.AddVenue(v)
 	if e == nil {
-		rdt := ReserveDT{}
-		rdt.init(daysLimit)
-		m.BookingDB.VenueReserve[venueID] = &rdt
-		m.VenueDB.VenueMap[venueID] = v.Name
+		m.addReserve(venueID, v)
 		return nil
 	}
 	return e
 }
 
+// addReserve : set up the reservations of venue id
+func (m *Model) addReserve(venueID int, v Venue) {
+	parts := v.DayParts
+	if len(parts) == 0 {
+		parts = DefaultDayParts
+	}
+	window := v.Window
+	if window <= 0 {
+		window = DaysLimit
+	}
+	rdt := ReserveDT{}
+	rdt.init(window, parts)
+	rdt.closed = v.Archived
+	m.BookingDB.mu.Lock()
+	m.BookingDB.VenueReserve[venueID] = &rdt
+	m.BookingDB.mu.Unlock()
+}
+
 //data structure 1
 //book a venue lead to a booking queue, vip and normal , add delay before booking is completed
 
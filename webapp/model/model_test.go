@@ -0,0 +1,240 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestModel : model with one venue, its id and reservations
+func newTestModel(t *testing.T) (Model, int, *ReserveDT) {
+	t.Helper()
+	m, err := InitModel(NewMemStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AddVenue(Venue{Name: "Hall", Kind: "Hall", Location: "North", Capacity: 10}); err != nil {
+		t.Fatal(err)
+	}
+	rdt, exists := m.BookingDB.Venue(1)
+	if !exists {
+		t.Fatal("venue 1 has no reservations")
+	}
+	return m, 1, rdt
+}
+
+// race : run book for n users at once, returning the ids booked and the
+// errors of those that failed
+func race(n int, book func(user string) (int, error)) ([]int, []error) {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var ids []int
+	var errs []error
+	start := make(chan struct{})
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(user string) {
+			defer wg.Done()
+			<-start
+			id, err := book(user)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, err)
+			} else {
+				ids = append(ids, id)
+			}
+		}(fmt.Sprint("user", i))
+	}
+	close(start)
+	wg.Wait()
+	return ids, errs
+}
+
+func TestReserveRace(t *testing.T) {
+	m, vid, rdt := newTestModel(t)
+	slot := rdt.ReadAvailable()[len(rdt.Parts())]
+	const n = 64
+	ids, errs := race(n, func(user string) (int, error) {
+		return m.BookingDB.Reserve(vid, slot, user)
+	})
+	if len(ids) != 1 {
+		t.Fatalf("%d bookings of one slot, want 1", len(ids))
+	}
+	for _, err := range errs {
+		if err != ErrSlotTaken {
+			t.Fatalf("losing booking failed with %v, want ErrSlotTaken", err)
+		}
+	}
+	if len(m.BookingDB.Bookings) != 1 {
+		t.Fatalf("%d bookings stored, want only %d", len(m.BookingDB.Bookings), ids[0])
+	}
+	if booking := m.BookingDB.getBookingDetails(vid, slot); booking == nil || booking.IDBook != ids[0] {
+		t.Fatalf("slot held by %v after the race, want booking %d", booking, ids[0])
+	}
+}
+
+func TestReserveRangeRace(t *testing.T) {
+	m, vid, rdt := newTestModel(t)
+	slot := rdt.ReadAvailable()[len(rdt.Parts())]
+	// the ranges start a second apart and all overlap, so only one can be booked
+	const n = 64
+	var mu sync.Mutex
+	next := 0
+	ids, errs := race(n, func(user string) (int, error) {
+		mu.Lock()
+		start := slot.Start.Add(time.Duration(next) * time.Second)
+		next++
+		mu.Unlock()
+		custom := Slot{Start: start, End: start.Add(time.Hour), Part: CustomPart, Name: "Custom"}
+		return m.BookingDB.Reserve(vid, custom, user)
+	})
+	if len(ids) != 1 {
+		t.Fatalf("%d bookings of overlapping ranges, want 1", len(ids))
+	}
+	for _, err := range errs {
+		if err != ErrOverlap {
+			t.Fatalf("losing range failed with %v, want ErrOverlap", err)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	m, vid, rdt := newTestModel(t)
+	slots := rdt.ReadAvailable()
+	morning := slots[len(rdt.Parts())]
+	if _, err := m.BookingDB.Reserve(vid, morning, "owner"); err != nil {
+		t.Fatal(err)
+	}
+	afternoon := slots[len(rdt.Parts())+1]
+	wrongPart := afternoon
+	wrongPart.Part = 0
+	day := morning.Start.Add(-8 * time.Hour)
+	custom := func(from, to time.Duration) Slot {
+		return CustomSlot(Interval{Start: day.Add(from), End: day.Add(to)})
+	}
+	tests := []struct {
+		name  string
+		venue int
+		slot  Slot
+		want  error
+	}{
+		{"free day part", vid, afternoon, nil},
+		{"no such venue", vid + 1, afternoon, ErrVenueNotFound},
+		{"booked day part", vid, morning, ErrSlotTaken},
+		{"not a slot start", vid, Slot{Start: afternoon.Start.Add(time.Hour), End: afternoon.End, Part: 1}, ErrSlotUnavailable},
+		{"wrong part", vid, wrongPart, ErrSlotUnavailable},
+		{"day part in the past", vid, Slot{Start: day.AddDate(0, 0, -2), End: day.AddDate(0, 0, -2).Add(time.Hour)}, ErrSlotInPast},
+		{"past the window", vid, Slot{Start: rdt.WindowEnd(), End: rdt.WindowEnd().Add(time.Hour)}, ErrOutsideWindow},
+		{"free range", vid, custom(13*time.Hour, 14*time.Hour), nil},
+		{"range ending before it starts", vid, custom(14*time.Hour, 13*time.Hour), ErrInvalidRange},
+		{"empty range", vid, custom(14*time.Hour, 14*time.Hour), ErrInvalidRange},
+		{"range over the booking", vid, custom(7*time.Hour, 9*time.Hour), ErrOverlap},
+		{"range out of the window", vid, CustomSlot(Interval{Start: day, End: rdt.WindowEnd().Add(time.Minute)}), ErrOutsideWindow},
+	}
+	for _, tt := range tests {
+		if err := m.BookingDB.Check(tt.venue, tt.slot); err != tt.want {
+			t.Errorf("%s: Check gave %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestWaitlistPromotion(t *testing.T) {
+	m, vid, rdt := newTestModel(t)
+	slots := rdt.ReadAvailable()
+	slot := slots[len(rdt.Parts())]
+	first, err := m.BookingDB.Reserve(vid, slot, "owner")
+	if err != nil {
+		t.Fatal(err)
+	}
+	joins := []struct {
+		user     string
+		vip      bool
+		slot     Slot
+		position int
+		err      error
+	}{
+		{"owner", false, slot, 0, ErrAlreadyWaiting},
+		{"alice", false, slot, 1, nil},
+		{"alice", false, slot, 0, ErrAlreadyWaiting},
+		{"bob", false, slot, 2, nil},
+		{"vera", true, slot, 1, nil}, // ahead of everyone not a VIP
+		{"carol", false, slots[len(rdt.Parts())+1], 0, ErrSlotFree},
+	}
+	for _, tt := range joins {
+		position, err := m.BookingDB.Waitlist(vid, tt.slot, tt.user, tt.vip)
+		if position != tt.position || err != tt.err {
+			t.Errorf("%s joined at %d, %v, want %d, %v", tt.user, position, err, tt.position, tt.err)
+		}
+	}
+	// each cancellation hands the slot to the next in line
+	id := first
+	for _, want := range []string{"vera", "alice", "bob"} {
+		promoted, err := m.BookingDB.DelReserve(id)
+		if err != nil || len(promoted) != 1 || promoted[0].User != want {
+			t.Fatalf("cancelling booking %d promoted %v, %v, want %s", id, promoted, err, want)
+		}
+		id = promoted[0].IDBook
+	}
+	if promoted, err := m.BookingDB.DelReserve(id); err != nil || len(promoted) != 0 {
+		t.Fatalf("empty waitlist promoted %v, %v", promoted, err)
+	}
+	if err := m.BookingDB.Check(vid, slot); err != nil {
+		t.Fatalf("slot not free once the waitlist is empty: %v", err)
+	}
+}
+
+// brokenStore : MemStore that fails to save bookings
+type brokenStore struct {
+	*MemStore
+}
+
+var errBroken = errors.New("store is broken")
+
+func (s brokenStore) PutBooking(b Booking) error {
+	return errBroken
+}
+
+func TestReserveUndoneWithWaitlist(t *testing.T) {
+	m, vid, rdt := newTestModel(t)
+	slot := rdt.ReadAvailable()[len(rdt.Parts())]
+	order := Booking{IDBook: 1, User: "first", Slot: slot, VenueID: vid}
+	if err := rdt.Reserve(&order); err != nil {
+		t.Fatal(err)
+	}
+	// someone queues after the slot is held but before it is saved
+	if _, err := rdt.join(slot, "waiter", false); err != nil {
+		t.Fatal(err)
+	}
+	m.BookingDB.store = brokenStore{NewMemStore()}
+	m.BookingDB.mu.Lock()
+	err := m.BookingDB.add(rdt, &order)
+	m.BookingDB.mu.Unlock()
+	if err != errBroken {
+		t.Fatalf("add gave %v, want the store's error", err)
+	}
+	if err := rdt.Check(slot); err != nil {
+		t.Fatalf("slot of the undone booking checks as %v, want it free", err)
+	}
+	if w := rdt.waiting("waiter"); len(w) != 0 {
+		t.Fatalf("waiter still queued for a free slot, %v", w)
+	}
+}
+
+func TestAddMediaRace(t *testing.T) {
+	m, id, _ := newTestModel(t)
+	const max = 3
+	_, errs := race(16, func(user string) (int, error) {
+		return 0, m.AddMedia(id, Media{Key: user + ".png", Type: "image/png"}, max)
+	})
+	for _, err := range errs {
+		if err != ErrTooManyMedia {
+			t.Fatalf("media refused with %v, want ErrTooManyMedia", err)
+		}
+	}
+	if v, _ := m.VenueDB.Get(id); len(v.Media) != max {
+		t.Fatalf("venue has %d media, want %d", len(v.Media), max)
+	}
+}
@@ -0,0 +1,267 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+//ErrUndeliverable : notification will never reach its user, it is dropped
+//rather than retried
+var ErrUndeliverable = errors.New("notification cannot be delivered")
+
+// kinds of notification
+const (
+	NotifyConfirmed = "confirmed"
+	NotifyCancelled = "cancelled"
+	NotifyReminder  = "reminder"
+)
+
+// Notification : message to a user about a booking, to deliver through
+// one channel. It stays in the store until it is delivered, so neither a
+// restart nor a channel that is down loses it
+type Notification struct {
+	ID        int
+	User      string
+	Channel   string
+	Kind      string
+	BookingID int
+	Subject   string
+	Body      string
+	Created   time.Time
+	Due       time.Time // not delivered before, later for reminders and retries
+	Attempts  int       // failed so far
+	Error     string    // of the last failed attempt
+}
+
+// Channel : a way of delivering notifications, such as email.
+// Errors wrapping ErrUndeliverable are not retried
+type Channel interface {
+	Deliver(u User, n Notification) error
+}
+
+// RetryPolicy : when failed deliveries are tried again. The wait starts at
+// Base and doubles up to Max, after Attempts failures the notification is dropped
+type RetryPolicy struct {
+	Base     time.Duration
+	Max      time.Duration
+	Attempts int
+}
+
+//Backoff : wait after the attempt-th failure
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	d := p.Base
+	for i := 1; i < attempt && d < p.Max; i++ {
+		d *= 2
+	}
+	if d > p.Max {
+		return p.Max
+	}
+	return d
+}
+
+// notifyDB : notifications waiting to be delivered, kept in the store.
+// mu guards counter and makes check then write of a notification one step
+type notifyDB struct {
+	mu      sync.Mutex
+	counter int // next id to give out
+	store   Store
+	wake    chan struct{} // a notification was queued
+}
+
+//Queue : add n for delivery through channel, at once unless n.Due is later
+func (nDB *notifyDB) Queue(n Notification, channel string) (Notification, error) {
+	nDB.mu.Lock()
+	n.ID = nDB.counter
+	n.Channel = channel
+	n.Created = time.Now()
+	if n.Due.IsZero() {
+		n.Due = n.Created
+	}
+	err := nDB.store.PutNotification(n)
+	if err == nil {
+		nDB.counter++
+	}
+	nDB.mu.Unlock()
+	if err != nil {
+		return n, err
+	}
+	select {
+	case nDB.wake <- struct{}{}:
+	default:
+		// the notifier is already woken
+	}
+	return n, nil
+}
+
+//Due : notifications to deliver at now, oldest due first
+func (nDB *notifyDB) Due(now time.Time) ([]Notification, error) {
+	all, err := nDB.store.Notifications()
+	if err != nil {
+		return nil, err
+	}
+	due := make([]Notification, 0)
+	for _, n := range all {
+		if !n.Due.After(now) {
+			due = append(due, n)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		if due[i].Due.Equal(due[j].Due) {
+			return due[i].ID < due[j].ID
+		}
+		return due[i].Due.Before(due[j].Due)
+	})
+	return due, nil
+}
+
+//CancelReminders : drop the reminders of booking id not sent yet,
+//returning how many there were
+func (nDB *notifyDB) CancelReminders(bookingID int) (int, error) {
+	nDB.mu.Lock()
+	defer nDB.mu.Unlock()
+	all, err := nDB.store.Notifications()
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for id, n := range all {
+		if n.Kind != NotifyReminder || n.BookingID != bookingID {
+			continue
+		}
+		if err := nDB.store.DeleteNotification(id); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// retry : put n back to try again after its attempt at now failed with
+// cause. false if it has run out of attempts, or was cancelled meanwhile
+func (nDB *notifyDB) retry(n Notification, cause error, p RetryPolicy, now time.Time) (Notification, bool, error) {
+	nDB.mu.Lock()
+	defer nDB.mu.Unlock()
+	n.Attempts++
+	n.Error = cause.Error()
+	all, err := nDB.store.Notifications()
+	if err != nil {
+		return n, false, err
+	}
+	if _, queued := all[n.ID]; !queued {
+		return n, false, nil
+	}
+	if n.Attempts >= p.Attempts {
+		return n, false, nDB.store.DeleteNotification(n.ID)
+	}
+	n.Due = now.Add(p.Backoff(n.Attempts))
+	return n, true, nDB.store.PutNotification(n)
+}
+
+// Notifier : delivers queued notifications in the background, as soon as
+// they are due, retrying those that fail
+type Notifier struct {
+	m        *Model
+	channels map[string]Channel
+	policy   RetryPolicy
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+//StartNotifier : start delivering through channels, by name, until Stop.
+//Due notifications are looked for every interval and whenever one is
+//queued. report is called after each attempt, with n as it is left
+func (m *Model) StartNotifier(channels map[string]Channel, p RetryPolicy, every time.Duration, report func(n Notification, err error)) *Notifier {
+	s := &Notifier{
+		m:        m,
+		channels: channels,
+		policy:   p,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go s.run(every, report)
+	return s
+}
+
+func (s *Notifier) run(every time.Duration, report func(n Notification, err error)) {
+	defer close(s.done)
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	s.deliverDue(time.Now(), report)
+	for {
+		select {
+		case <-s.stop:
+			return
+		case now := <-ticker.C:
+			s.deliverDue(now, report)
+		case <-s.m.NotifyDB.wake:
+			s.deliverDue(time.Now(), report)
+		}
+	}
+}
+
+// deliverDue : attempt every notification due at now
+func (s *Notifier) deliverDue(now time.Time, report func(n Notification, err error)) {
+	due, err := s.m.NotifyDB.Due(now)
+	if err != nil {
+		report(Notification{}, err)
+		return
+	}
+	for _, n := range due {
+		select {
+		case <-s.stop:
+			return
+		default:
+		}
+		report(s.deliver(n, now))
+	}
+}
+
+// deliver : attempt n at now. It leaves the queue unless it is to be retried
+func (s *Notifier) deliver(n Notification, now time.Time) (Notification, error) {
+	err := s.send(n)
+	if err == nil || errors.Is(err, ErrUndeliverable) {
+		if derr := s.m.Store.DeleteNotification(n.ID); derr != nil {
+			return n, derr
+		}
+		return n, err
+	}
+	n, retrying, rerr := s.m.NotifyDB.retry(n, err, s.policy, now)
+	if rerr != nil {
+		return n, rerr
+	}
+	if !retrying {
+		return n, fmt.Errorf("%w after %d attempts, %v", ErrUndeliverable, n.Attempts, err)
+	}
+	return n, err
+}
+
+// send : hand n to its channel
+func (s *Notifier) send(n Notification) error {
+	ch, ok := s.channels[n.Channel]
+	if !ok {
+		return fmt.Errorf("%w, no channel %q", ErrUndeliverable, n.Channel)
+	}
+	u, err := s.m.UserDB.Get(n.User)
+	if err == ErrUserNotFound {
+		return fmt.Errorf("%w, %v", ErrUndeliverable, err)
+	}
+	if err != nil {
+		return err
+	}
+	if n.Kind == NotifyReminder {
+		// the booking may have gone without its reminders being cancelled
+		if b, exists := s.m.BookingDB.Get(n.BookingID); !exists || b.User != n.User {
+			return fmt.Errorf("%w, booking %d is no longer theirs", ErrUndeliverable, n.BookingID)
+		}
+	}
+	return ch.Deliver(u, n)
+}
+
+//Stop : stop the notifier and wait for a running delivery to finish
+func (s *Notifier) Stop() {
+	close(s.stop)
+	<-s.done
+}
@@ -0,0 +1,179 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	p := RetryPolicy{Base: time.Minute, Max: 10 * time.Minute, Attempts: 5}
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{0, time.Minute},
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{3, 4 * time.Minute},
+		{4, 8 * time.Minute},
+		{5, 10 * time.Minute},
+		{50, 10 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := p.Backoff(tt.attempt); got != tt.want {
+			t.Errorf("Backoff(%d) = %v, want %v", tt.attempt, got, tt.want)
+		}
+	}
+}
+
+// fakeChannel : Channel failing with errs in turn, then delivering
+type fakeChannel struct {
+	errs      []error
+	delivered []Notification
+}
+
+func (c *fakeChannel) Deliver(u User, n Notification) error {
+	if len(c.errs) > 0 {
+		err := c.errs[0]
+		c.errs = c.errs[1:]
+		return err
+	}
+	c.delivered = append(c.delivered, n)
+	return nil
+}
+
+var errDown = errors.New("channel is down")
+
+// newTestNotifier : notifier over m through ch, never started, so tests
+// attempt deliveries themselves
+func newTestNotifier(m *Model, ch Channel, p RetryPolicy) *Notifier {
+	return &Notifier{
+		m:        m,
+		channels: map[string]Channel{"fake": ch},
+		policy:   p,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+func TestNotifierDeliver(t *testing.T) {
+	p := RetryPolicy{Base: time.Minute, Max: time.Hour, Attempts: 3}
+	now := time.Now()
+	tests := []struct {
+		name     string
+		n        Notification
+		channel  string
+		errs     []error
+		want     error // errors.Is of what deliver gives
+		queued   bool  // left to retry
+		attempts int
+	}{
+		{"delivered", Notification{User: "ann", Kind: NotifyConfirmed}, "fake", nil, nil, false, 0},
+		{"failure is retried", Notification{User: "ann", Kind: NotifyConfirmed}, "fake", []error{errDown}, errDown, true, 1},
+		{"undeliverable is not retried", Notification{User: "ann", Kind: NotifyConfirmed}, "fake",
+			[]error{fmt.Errorf("%w, no address", ErrUndeliverable)}, ErrUndeliverable, false, 0},
+		{"last attempt fails", Notification{User: "ann", Kind: NotifyConfirmed, Attempts: 2}, "fake", []error{errDown}, ErrUndeliverable, false, 3},
+		{"no such channel", Notification{User: "ann", Kind: NotifyConfirmed}, "pigeon", nil, ErrUndeliverable, false, 0},
+		{"no such user", Notification{User: "nobody", Kind: NotifyConfirmed}, "fake", nil, ErrUndeliverable, false, 0},
+		{"reminder of a cancelled booking", Notification{User: "ann", Kind: NotifyReminder, BookingID: 99}, "fake", nil, ErrUndeliverable, false, 0},
+	}
+	for _, tt := range tests {
+		m, _, _ := newTestModel(t)
+		if err := m.UserDB.Add(User{Username: "ann"}); err != nil {
+			t.Fatal(err)
+		}
+		ch := &fakeChannel{errs: tt.errs}
+		s := newTestNotifier(&m, ch, p)
+		n, err := m.NotifyDB.Queue(tt.n, tt.channel)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n, err = s.deliver(n, now)
+		if !errors.Is(err, tt.want) || (tt.want == nil && err != nil) {
+			t.Errorf("%s: deliver gave %v, want %v", tt.name, err, tt.want)
+		}
+		if n.Attempts != tt.attempts {
+			t.Errorf("%s: %d attempts, want %d", tt.name, n.Attempts, tt.attempts)
+		}
+		all, _ := m.Store.Notifications()
+		stored, queued := all[n.ID]
+		if queued != tt.queued {
+			t.Errorf("%s: queued %t, want %t", tt.name, queued, tt.queued)
+		}
+		if queued && !stored.Due.Equal(now.Add(p.Backoff(stored.Attempts))) {
+			t.Errorf("%s: retry due %v, want after %v", tt.name, stored.Due, p.Backoff(stored.Attempts))
+		}
+	}
+}
+
+func TestNotifierRetries(t *testing.T) {
+	m, _, _ := newTestModel(t)
+	if err := m.UserDB.Add(User{Username: "ann"}); err != nil {
+		t.Fatal(err)
+	}
+	p := RetryPolicy{Base: time.Minute, Max: time.Hour, Attempts: 5}
+	ch := &fakeChannel{errs: []error{errDown, errDown}}
+	s := newTestNotifier(&m, ch, p)
+	n, err := m.NotifyDB.Queue(Notification{User: "ann", Kind: NotifyConfirmed}, "fake")
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := n.Due
+	steps := []struct {
+		name      string
+		at        time.Duration
+		attempts  int // of what is reported, none if -1
+		delivered int
+	}{
+		{"first attempt fails", 0, 1, 0},
+		{"not due before its backoff", 59 * time.Second, -1, 0},
+		{"second attempt fails", time.Minute, 2, 0},
+		{"backoff doubled", 2 * time.Minute, -1, 0},
+		{"third attempt delivers", 3 * time.Minute, 2, 1},
+		{"nothing left", time.Hour, -1, 1},
+	}
+	for _, tt := range steps {
+		var reported []Notification
+		s.deliverDue(start.Add(tt.at), func(n Notification, err error) {
+			reported = append(reported, n)
+		})
+		if tt.attempts < 0 && len(reported) != 0 {
+			t.Errorf("%s: attempted %v", tt.name, reported)
+		}
+		if tt.attempts >= 0 && (len(reported) != 1 || reported[0].Attempts != tt.attempts) {
+			t.Errorf("%s: attempted %v, want one with %d failures", tt.name, reported, tt.attempts)
+		}
+		if len(ch.delivered) != tt.delivered {
+			t.Errorf("%s: %d delivered, want %d", tt.name, len(ch.delivered), tt.delivered)
+		}
+	}
+}
+
+func TestCancelReminders(t *testing.T) {
+	m, _, _ := newTestModel(t)
+	later := time.Now().Add(time.Hour)
+	queue := []Notification{
+		{User: "ann", Kind: NotifyReminder, BookingID: 1, Due: later},
+		{User: "ann", Kind: NotifyConfirmed, BookingID: 1},
+		{User: "ann", Kind: NotifyReminder, BookingID: 2, Due: later},
+	}
+	for _, n := range queue {
+		if _, err := m.NotifyDB.Queue(n, "fake"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n, err := m.NotifyDB.CancelReminders(1); n != 1 || err != nil {
+		t.Fatalf("cancelled %d, %v, want the one reminder of booking 1", n, err)
+	}
+	all, _ := m.Store.Notifications()
+	for _, n := range all {
+		if n.Kind == NotifyReminder && n.BookingID == 1 {
+			t.Fatalf("reminder of booking 1 still queued, %v", n)
+		}
+	}
+	if len(all) != 2 {
+		t.Fatalf("%d notifications left, want 2", len(all))
+	}
+}
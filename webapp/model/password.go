@@ -0,0 +1,101 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+)
+
+var (
+	//ErrPasswordMixedCase : password needs upper and lower case letters
+	ErrPasswordMixedCase = errors.New("password must mix upper and lower case letters")
+	//ErrPasswordDigit : password needs a digit
+	ErrPasswordDigit = errors.New("password must contain a digit")
+	//ErrPasswordSymbol : password needs a symbol
+	ErrPasswordSymbol = errors.New("password must contain a symbol")
+	//ErrPasswordUsername : password contains the username
+	ErrPasswordUsername = errors.New("password must not contain the username")
+)
+
+// PasswordPolicy : rules a new password must follow. MaxLength should be
+// at most 72, bcrypt ignores anything longer
+type PasswordPolicy struct {
+	MinLength        int
+	MaxLength        int
+	RequireMixedCase bool
+	RequireDigit     bool
+	RequireSymbol    bool
+}
+
+//Check : nil if password is allowed for username, or the first rule it breaks
+func (p PasswordPolicy) Check(username string, password string) error {
+	if len(password) < p.MinLength {
+		return fmt.Errorf("password must be at least %d characters", p.MinLength)
+	}
+	if p.MaxLength > 0 && len(password) > p.MaxLength {
+		return fmt.Errorf("password must be at most %d characters", p.MaxLength)
+	}
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			symbol = true
+		}
+	}
+	if p.RequireMixedCase && !(upper && lower) {
+		return ErrPasswordMixedCase
+	}
+	if p.RequireDigit && !digit {
+		return ErrPasswordDigit
+	}
+	if p.RequireSymbol && !symbol {
+		return ErrPasswordSymbol
+	}
+	if username != "" && strings.Contains(strings.ToLower(password), strings.ToLower(username)) {
+		return ErrPasswordUsername
+	}
+	return nil
+}
+
+// Lockout : how many failed logins in a row lock an account, and for how long
+type Lockout struct {
+	Threshold int
+	Duration  time.Duration
+}
+
+//Locked : true if u cannot log in at now
+func (u User) Locked(now time.Time) bool {
+	return now.Before(u.LockedUntil)
+}
+
+//LoginFailed : count a failed login of username, locking the account
+//once l.Threshold failures in a row are reached
+func (uDB *userDB) LoginFailed(username string, l Lockout, now time.Time) (User, error) {
+	return uDB.Update(username, func(u *User) {
+		u.FailedLogins++
+		if u.FailedLogins >= l.Threshold {
+			u.FailedLogins = 0
+			u.LockedUntil = now.Add(l.Duration)
+		}
+	})
+}
+
+//LoginSucceeded : clear the failed logins of username, and replace
+//their password hash with rehash if it is not nil
+func (uDB *userDB) LoginSucceeded(username string, rehash []byte) (User, error) {
+	return uDB.Update(username, func(u *User) {
+		u.FailedLogins = 0
+		u.LockedUntil = time.Time{}
+		if rehash != nil {
+			u.Password = rehash
+		}
+	})
+}
@@ -0,0 +1,83 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPasswordPolicy(t *testing.T) {
+	p := PasswordPolicy{MinLength: 8, MaxLength: 16, RequireMixedCase: true, RequireDigit: true, RequireSymbol: true}
+	tests := []struct {
+		name     string
+		password string
+		ok       bool
+		want     error
+	}{
+		{"follows every rule", "Tr0mbone!", true, nil},
+		{"space as the symbol", "Tr0m bone", true, nil},
+		{"too short", "Tr0m!", false, nil},
+		{"too long", "Tr0mbone!Tr0mbone!", false, nil},
+		{"lower case only", "tr0mbone!", false, ErrPasswordMixedCase},
+		{"upper case only", "TR0MBONE!", false, ErrPasswordMixedCase},
+		{"no digit", "Trombone!", false, ErrPasswordDigit},
+		{"no symbol", "Tr0mbone", false, ErrPasswordSymbol},
+		{"username in any case", "xANN1!abcD", false, ErrPasswordUsername},
+	}
+	for _, tt := range tests {
+		err := p.Check("ann", tt.password)
+		if (err == nil) != tt.ok || (tt.want != nil && err != tt.want) {
+			t.Errorf("%s: Check gave %v, want ok %t, %v", tt.name, err, tt.ok, tt.want)
+		}
+	}
+	// rules that are off are not checked
+	if err := (PasswordPolicy{MinLength: 4}).Check("ann", "plain"); err != nil {
+		t.Errorf("loose policy refused a plain password, %v", err)
+	}
+}
+
+func TestLockout(t *testing.T) {
+	m, err := InitModel(NewMemStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	uDB := m.UserDB
+	if err := uDB.Add(User{Username: "ann"}); err != nil {
+		t.Fatal(err)
+	}
+	l := Lockout{Threshold: 3, Duration: 15 * time.Minute}
+	start := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	steps := []struct {
+		name   string
+		at     time.Duration
+		failed bool // else a successful login
+		locked bool // locked at the time of the step, after it
+		count  int
+	}{
+		{"first failure", 0, true, false, 1},
+		{"success clears the count", time.Minute, false, false, 0},
+		{"failure", 2 * time.Minute, true, false, 1},
+		{"failure", 3 * time.Minute, true, false, 2},
+		{"third in a row locks", 4 * time.Minute, true, true, 0},
+		{"still locked", 18 * time.Minute, true, true, 1},
+		{"lock over", 20 * time.Minute, true, false, 2},
+	}
+	for _, tt := range steps {
+		now := start.Add(tt.at)
+		var u User
+		var err error
+		if tt.failed {
+			u, err = uDB.LoginFailed("ann", l, now)
+		} else {
+			u, err = uDB.LoginSucceeded("ann", nil)
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if u.Locked(now) != tt.locked || u.FailedLogins != tt.count {
+			t.Errorf("%s: locked %t with %d failures, want %t with %d", tt.name, u.Locked(now), u.FailedLogins, tt.locked, tt.count)
+		}
+	}
+	if _, err := uDB.LoginFailed("nobody", l, start); err != ErrUserNotFound {
+		t.Errorf("failed login of an unknown user gave %v, want ErrUserNotFound", err)
+	}
+}
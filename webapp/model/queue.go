@@ -7,10 +7,11 @@ import (
 
 //Node n
 type qNode struct {
-	date      int
+	date      int64
 	next      *qNode
 	priority  int
 	bookingid int
+	user      string
 }
 
 //Queue :
@@ -20,16 +21,21 @@ type Queue struct {
 	size  int
 }
 
-func (p *Queue) enqueue(date int, bookingid int, pr int) error {
+// enqueue : lower pr is served first, equal pr in arrival order
+func (p *Queue) enqueue(date int64, bookingid int, user string, pr int) error {
 	newNode := &qNode{
 		date:      date,
 		next:      nil,
 		priority:  pr,
 		bookingid: bookingid,
+		user:      user,
 	}
 	if p.front == nil {
 		p.front = newNode
-
+		p.back = newNode
+	} else if p.front.priority > pr {
+		newNode.next = p.front
+		p.front = newNode
 	} else {
 		currentN := p.front
 		for currentN.next != nil {
@@ -41,22 +47,19 @@ func (p *Queue) enqueue(date int, bookingid int, pr int) error {
 		tempNode := currentN.next
 		currentN.next = newNode
 		newNode.next = tempNode
-
-		//p.back.next = newNode
+		if tempNode == nil {
+			p.back = newNode
+		}
 	}
-	p.back = newNode
 	p.size++
 	return nil
 }
 
-func (p *Queue) dequeue() (int, int, error) {
-	var date int
-	var bookingid int
+func (p *Queue) dequeue() (*qNode, error) {
 	if p.front == nil {
-		return 0, 0, errors.New("Empty queue")
+		return nil, errors.New("Empty queue")
 	}
-	bookingid = p.front.bookingid
-	date = p.front.date
+	n := p.front
 	if p.size == 1 {
 		p.front = nil
 		p.back = nil
@@ -64,7 +67,20 @@ func (p *Queue) dequeue() (int, int, error) {
 		p.front = p.front.next
 	}
 	p.size--
-	return date, bookingid, nil
+	n.next = nil
+	return n, nil
+}
+
+// position : 1 based place of user in queue, 0 if not queued
+func (p *Queue) position(user string) int {
+	i := 1
+	for n := p.front; n != nil; n = n.next {
+		if n.user == user {
+			return i
+		}
+		i++
+	}
+	return 0
 }
 
 func (p *Queue) printAllNodes() error {
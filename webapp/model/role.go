@@ -0,0 +1,80 @@
+package model
+
+import "errors"
+
+//ErrUnknownRole : role is not one of Roles
+var ErrUnknownRole = errors.New("unknown role")
+
+// Role : what a user is allowed to do, see rolePermissions
+type Role string
+
+// roles, from least to most allowed
+const (
+	RoleUser    Role = "user"
+	RoleManager Role = "venue-manager"
+	RoleAdmin   Role = "admin"
+)
+
+//Roles : every role, in the order they are offered
+var Roles = []Role{RoleUser, RoleManager, RoleAdmin}
+
+// Permission : a single thing a role allows
+type Permission string
+
+// permissions
+const (
+	//PermBook : make and cancel one's own bookings
+	PermBook Permission = "book"
+	//PermManageVenues : add venues and manage the venues one owns
+	PermManageVenues Permission = "manage-venues"
+	//PermManageAllVenues : manage every venue and its bookings
+	PermManageAllVenues Permission = "manage-all-venues"
+	//PermAssignRoles : change the role of any user
+	PermAssignRoles Permission = "assign-roles"
+)
+
+var rolePermissions = map[Role][]Permission{
+	RoleUser:    {PermBook},
+	RoleManager: {PermBook, PermManageVenues},
+	RoleAdmin:   {PermBook, PermManageVenues, PermManageAllVenues, PermAssignRoles},
+}
+
+//ParseRole : role named s
+func ParseRole(s string) (Role, error) {
+	for _, r := range Roles {
+		if string(r) == s {
+			return r, nil
+		}
+	}
+	return "", ErrUnknownRole
+}
+
+//GetRole : role of u, users saved before roles existed are RoleUser
+func (u User) GetRole() Role {
+	if u.Role == "" {
+		return RoleUser
+	}
+	return u.Role
+}
+
+//Can : true if u's role has permission p
+func (u User) Can(p Permission) bool {
+	if u.Username == "" {
+		return false
+	}
+	for _, have := range rolePermissions[u.GetRole()] {
+		if have == p {
+			return true
+		}
+	}
+	return false
+}
+
+//CanManage : true if u may manage venue v, either any venue
+//or one they own
+func (u User) CanManage(v Venue) bool {
+	if u.Can(PermManageAllVenues) {
+		return true
+	}
+	return u.Can(PermManageVenues) && v.Owner == u.Username
+}
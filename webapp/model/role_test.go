@@ -0,0 +1,66 @@
+package model
+
+import "testing"
+
+func TestCan(t *testing.T) {
+	tests := []struct {
+		role Role
+		perm Permission
+		want bool
+	}{
+		{"", PermBook, true}, // saved before roles
+		{"", PermManageVenues, false},
+		{RoleUser, PermBook, true},
+		{RoleUser, PermManageVenues, false},
+		{RoleManager, PermBook, true},
+		{RoleManager, PermManageVenues, true},
+		{RoleManager, PermManageAllVenues, false},
+		{RoleManager, PermAssignRoles, false},
+		{RoleAdmin, PermManageAllVenues, true},
+		{RoleAdmin, PermAssignRoles, true},
+		{"owner", PermBook, false},
+	}
+	for _, tt := range tests {
+		u := User{Username: "ann", Role: tt.role}
+		if got := u.Can(tt.perm); got != tt.want {
+			t.Errorf("%q can %s = %v, want %v", tt.role, tt.perm, got, tt.want)
+		}
+	}
+	if (User{Role: RoleAdmin}).Can(PermBook) {
+		t.Error("nobody logged in can book")
+	}
+}
+
+func TestCanManage(t *testing.T) {
+	own := Venue{Name: "Hall", Owner: "ann"}
+	other := Venue{Name: "Room", Owner: "bob"}
+	tests := []struct {
+		role  Role
+		venue Venue
+		want  bool
+	}{
+		{RoleUser, own, false},
+		{RoleManager, own, true},
+		{RoleManager, other, false},
+		{RoleAdmin, other, true},
+	}
+	for _, tt := range tests {
+		u := User{Username: "ann", Role: tt.role}
+		if got := u.CanManage(tt.venue); got != tt.want {
+			t.Errorf("%s can manage %s's venue = %v, want %v", tt.role, tt.venue.Owner, got, tt.want)
+		}
+	}
+}
+
+func TestParseRole(t *testing.T) {
+	for _, r := range Roles {
+		if got, err := ParseRole(string(r)); got != r || err != nil {
+			t.Errorf("ParseRole(%q) = %q, %v", r, got, err)
+		}
+	}
+	for _, s := range []string{"", "Admin", "root"} {
+		if _, err := ParseRole(s); err != ErrUnknownRole {
+			t.Errorf("ParseRole(%q) gave %v, want ErrUnknownRole", s, err)
+		}
+	}
+}
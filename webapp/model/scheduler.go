@@ -0,0 +1,51 @@
+package model
+
+import "time"
+
+// Scheduler : rolls every venue's booking window forward at midnight,
+// adding the new last day and archiving the slots that have passed
+type Scheduler struct {
+	m    *Model
+	stop chan struct{}
+	done chan struct{}
+}
+
+//StartScheduler : start rolling windows in the background until Stop
+func (m *Model) StartScheduler() *Scheduler {
+	s := &Scheduler{
+		m:    m,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+func (s *Scheduler) run() {
+	defer close(s.done)
+	for {
+		now := time.Now()
+		midnight := dayStart(now).AddDate(0, 0, 1)
+		timer := time.NewTimer(midnight.Sub(now))
+		select {
+		case <-s.stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+			s.m.Advance(time.Now())
+		}
+	}
+}
+
+//Stop : stop the scheduler and wait for a running advance to finish
+func (s *Scheduler) Stop() {
+	close(s.stop)
+	<-s.done
+}
+
+//Advance : roll every venue's window to start on the day of now
+func (m *Model) Advance(now time.Time) {
+	for _, rdt := range m.BookingDB.reserves() {
+		rdt.advance(now)
+	}
+}
@@ -0,0 +1,49 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAdvance(t *testing.T) {
+	tests := []struct {
+		name      string
+		days      int // after the window was laid out
+		available int
+		reserved  int
+		archived  int
+	}{
+		{"same day", 0, 8, 1, 0},
+		{"booked day is today", 1, 8, 1, 0},
+		{"booked day has passed", 2, 9, 0, 1},
+		{"long after", 10, 9, 0, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rdt := &ReserveDT{}
+			rdt.init(3, DefaultDayParts)
+			// tomorrow morning
+			slot := rdt.ReadAvailable()[len(DefaultDayParts)]
+			rdt.Reserve(&Booking{IDBook: 1, Slot: slot})
+
+			today := dayStart(time.Now()).AddDate(0, 0, tt.days)
+			rdt.advance(today.Add(time.Hour))
+			if n := rdt.available.Size(); n != tt.available {
+				t.Errorf("%d slots available, want %d", n, tt.available)
+			}
+			if n := rdt.unavailable.Size(); n != tt.reserved {
+				t.Errorf("%d slots reserved, want %d", n, tt.reserved)
+			}
+			if n := rdt.archive.Size(); n != tt.archived {
+				t.Errorf("%d slots archived, want %d", n, tt.archived)
+			}
+			if first, _ := rdt.date.Min(); rdt.date.Size() != 3 || first != today.Unix() {
+				t.Errorf("window has %d days from %v, want 3 from %v",
+					rdt.date.Size(), time.Unix(first, 0), today)
+			}
+			if first := rdt.ReadAvailable()[0]; first.Start.Before(today) {
+				t.Errorf("slot %v before %v still available", first, today)
+			}
+		})
+	}
+}
@@ -0,0 +1,279 @@
+package model
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// weights of a term by the field it is found in
+const (
+	nameWeight = 3
+	descWeight = 1
+)
+
+// how much a query token counts for by how it matches a term
+const (
+	exactMatch  = 1.0
+	prefixMatch = 0.6
+	fuzzyMatch  = 0.4
+)
+
+// stopWords : too common to tell venues apart, left out of the index and queries
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "at": true, "for": true, "in": true,
+	"of": true, "on": true, "or": true, "the": true, "to": true, "with": true,
+}
+
+// tokenize : lower case words and numbers of s, without stop words
+func tokenize(s string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	tokens := fields[:0]
+	for _, f := range fields {
+		if !stopWords[f] {
+			tokens = append(tokens, f)
+		}
+	}
+	return tokens
+}
+
+// textIndex : inverted index of venue names and descriptions. Terms are
+// kept in order so those starting with a prefix are next to each other
+type textIndex struct {
+	terms *Tree[string, map[int]float64] // term to its weight in each venue
+	docs  map[int][]string               // terms of each venue, to take it out again
+}
+
+func newTextIndex() *textIndex {
+	return &textIndex{
+		terms: &Tree[string, map[int]float64]{},
+		docs:  make(map[int][]string),
+	}
+}
+
+// add : index the name and description of venue id
+func (t *textIndex) add(id int, v Venue) {
+	weights := make(map[string]float64)
+	for _, term := range tokenize(v.Name) {
+		weights[term] += nameWeight
+	}
+	for _, term := range tokenize(v.Desc) {
+		weights[term] += descWeight
+	}
+	for term, w := range weights {
+		postings, exists := t.terms.Get(term)
+		if !exists {
+			postings = make(map[int]float64)
+			t.terms.Put(term, postings)
+		}
+		postings[id] = w
+		t.docs[id] = append(t.docs[id], term)
+	}
+}
+
+// remove : undo add of venue id
+func (t *textIndex) remove(id int) {
+	for _, term := range t.docs[id] {
+		if postings, exists := t.terms.Get(term); exists {
+			delete(postings, id)
+			if len(postings) == 0 {
+				t.terms.Delete(term)
+			}
+		}
+	}
+	delete(t.docs, id)
+}
+
+// maxEdits : typos allowed in a token before it no longer matches
+func maxEdits(token string) int {
+	switch n := len([]rune(token)); {
+	case n < 4:
+		return 0
+	case n < 8:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// editDistance : Levenshtein distance of a and b, or more than limit if
+// it is known to be over it
+func editDistance(a string, b string, limit int) int {
+	ra, rb := []rune(a), []rune(b)
+	if d := len(ra) - len(rb); d > limit || -d > limit {
+		return limit + 1
+	}
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		best := cur[0]
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			best = min(best, cur[j])
+		}
+		if best > limit {
+			return limit + 1
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+// match : score of every venue for one query token. Each venue counts
+// the term it matches best, exact before prefix before fuzzy, weighted
+// so that rare terms count for more
+func (t *textIndex) match(token string) map[int]float64 {
+	scores := make(map[int]float64)
+	n := float64(len(t.docs))
+	score := func(postings map[int]float64, factor float64) {
+		idf := math.Log(1 + n/float64(len(postings)))
+		for id, w := range postings {
+			if s := w * idf * factor; s > scores[id] {
+				scores[id] = s
+			}
+		}
+	}
+	if postings, exists := t.terms.Get(token); exists {
+		score(postings, exactMatch)
+	}
+	if len([]rune(token)) >= 2 {
+		for it := t.terms.Seek(token); it.Valid() && strings.HasPrefix(it.Key(), token); it.Next() {
+			if it.Key() != token {
+				score(it.Value(), prefixMatch)
+			}
+		}
+	}
+	if limit := maxEdits(token); limit > 0 {
+		for it := t.terms.Seek(""); it.Valid(); it.Next() {
+			term := it.Key()
+			if term == token || strings.HasPrefix(term, token) {
+				continue
+			}
+			if d := editDistance(token, term, limit); d <= limit {
+				score(it.Value(), fuzzyMatch/float64(d))
+			}
+		}
+	}
+	return scores
+}
+
+// search : venues matching every token of text, most relevant first.
+// Ok is false if text has no tokens to search for
+func (t *textIndex) search(text string) ([]int, bool) {
+	tokens := tokenize(text)
+	if len(tokens) == 0 {
+		return nil, false
+	}
+	var total map[int]float64
+	for _, token := range tokens {
+		scores := t.match(token)
+		if total == nil {
+			total = scores
+			continue
+		}
+		for id := range total {
+			if s, found := scores[id]; found {
+				total[id] += s
+			} else {
+				delete(total, id)
+			}
+		}
+	}
+	ranked := make([]int, 0, len(total))
+	for id := range total {
+		ranked = append(ranked, id)
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if total[ranked[i]] != total[ranked[j]] {
+			return total[ranked[i]] > total[ranked[j]]
+		}
+		return ranked[i] < ranked[j]
+	})
+	return ranked, true
+}
+
+//FreeSlots : day part slots that can still be booked and lie within
+//from and to. A zero to is the end of the booking window
+func (rdt *ReserveDT) FreeSlots(from time.Time, to time.Time) []Slot {
+	rdt.mu.RLock()
+	defer rdt.mu.RUnlock()
+	var free []Slot
+	if rdt.closed {
+		return free
+	}
+	// slots of today that have started are only dropped at midnight
+	if now := time.Now(); from.Before(now) {
+		from = now
+	}
+	for it := rdt.available.Seek(from.Unix()); it.Valid(); it.Next() {
+		slot := it.Value()
+		if !to.IsZero() && slot.End.After(to) {
+			// slots of a day can end in any order, a later one may still fit
+			if slot.Start.Before(to) {
+				continue
+			}
+			break
+		}
+		free = append(free, slot)
+	}
+	return free
+}
+
+// reservesOf : reservations of each of ids that has them, under one lock
+func (b *bookingDB) reservesOf(ids []int) map[int]*ReserveDT {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	rdts := make(map[int]*ReserveDT, len(ids))
+	for _, id := range ids {
+		if rdt, exists := b.VenueReserve[id]; exists {
+			rdts[id] = rdt
+		}
+	}
+	return rdts
+}
+
+//Match : venue found by Model.Search, with its free slots between
+//q.DateMin and q.DateMax if either is given
+type Match struct {
+	ID    int
+	Venue Venue
+	Free  []Slot
+}
+
+//Search : venues matching q in the order of VenueDB.Filter. When q has
+//a DateMin or DateMax only venues with a slot free between them are kept.
+//The indexes narrow the venues down first so only their own slots in
+//the window are walked, not every venue's
+func (m *Model) Search(q Query) []Match {
+	venues, order := m.VenueDB.Filter(q)
+	matches := make([]Match, 0, len(order))
+	if q.DateMin.IsZero() && q.DateMax.IsZero() {
+		for _, id := range order {
+			matches = append(matches, Match{ID: id, Venue: venues[id]})
+		}
+		return matches
+	}
+	rdts := m.BookingDB.reservesOf(order)
+	for _, id := range order {
+		rdt, exists := rdts[id]
+		if !exists {
+			continue
+		}
+		if free := rdt.FreeSlots(q.DateMin, q.DateMax); len(free) > 0 {
+			matches = append(matches, Match{ID: id, Venue: venues[id], Free: free})
+		}
+	}
+	return matches
+}
@@ -0,0 +1,225 @@
+package model
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"Main Hall", []string{"main", "hall"}},
+		{"The Hall of the North", []string{"hall", "north"}},
+		{"Room 101, first-floor", []string{"room", "101", "first", "floor"}},
+		{"Café Über", []string{"café", "über"}},
+		{"the and of", []string{}},
+		{"", []string{}},
+	}
+	for _, tt := range tests {
+		got := tokenize(tt.in)
+		if len(got) == 0 && len(tt.want) == 0 {
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("tokenize(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b  string
+		limit int
+		want  int
+	}{
+		{"hall", "hall", 2, 0},
+		{"hall", "hal", 2, 1},
+		{"hall", "hell", 2, 1},
+		{"garden", "gardne", 2, 2},
+		{"café", "cafe", 2, 1},
+		{"studio", "sdio", 1, 2},     // known over the limit from the lengths
+		{"kitchen", "mansion", 2, 3}, // stopped once every row is over
+	}
+	for _, tt := range tests {
+		if got := editDistance(tt.a, tt.b, tt.limit); got != tt.want {
+			t.Errorf("editDistance(%q, %q, %d) = %d, want %d", tt.a, tt.b, tt.limit, got, tt.want)
+		}
+	}
+}
+
+func TestTextSearch(t *testing.T) {
+	idx := newTextIndex()
+	venues := map[int]Venue{
+		1: {Name: "Main Hall", Desc: "A large hall with a stage"},
+		2: {Name: "Garden Room", Desc: "Looks over the hall gardens"},
+		3: {Name: "Studio", Desc: "Small room for rehearsals"},
+		4: {Name: "Hallway Gallery", Desc: "Paintings"},
+	}
+	for id, v := range venues {
+		idx.add(id, v)
+	}
+	tests := []struct {
+		name string
+		text string
+		want []int // in rank order, nil if nothing is searched for
+	}{
+		{"name counts over description", "hall", []int{1, 4, 2}},
+		{"exact and prefix in one venue", "garden", []int{2}},
+		{"prefix", "stud", []int{3}},
+		{"typo", "studo", []int{3}},
+		{"too many typos", "sutdoi", []int{}},
+		{"short prefix", "roo", []int{2, 3}},
+		{"every token must match", "room rehearsals", []int{3}},
+		{"case and punctuation", "MAIN-hall!", []int{1}},
+		{"no match", "kitchen", []int{}},
+		{"stop words only", "the of", nil},
+	}
+	for _, tt := range tests {
+		got, ok := idx.search(tt.text)
+		if ok != (tt.want != nil) {
+			t.Errorf("%s: search(%q) ok %t", tt.name, tt.text, ok)
+			continue
+		}
+		if len(got) != len(tt.want) || (len(got) > 0 && !reflect.DeepEqual(got, tt.want)) {
+			t.Errorf("%s: search(%q) = %v, want %v", tt.name, tt.text, got, tt.want)
+		}
+	}
+
+	// a removed venue is no longer found, and its terms go with it
+	idx.remove(3)
+	if got, _ := idx.search("studio"); len(got) != 0 {
+		t.Fatalf("removed venue found, %v", got)
+	}
+	if _, exists := idx.terms.Get("rehearsals"); exists {
+		t.Fatal("terms of the removed venue left in the index")
+	}
+}
+
+func TestFreeSlots(t *testing.T) {
+	m, vid, rdt := newTestModel(t)
+	// tomorrow's morning, afternoon and evening
+	slots := rdt.ReadAvailable()[len(rdt.Parts()):]
+	morning, afternoon, evening := slots[0], slots[1], slots[2]
+	if _, err := m.BookingDB.Reserve(vid, afternoon, "ann"); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		from time.Time
+		to   time.Time
+		want []Slot
+	}{
+		{"whole day, less the booked slot", morning.Start, evening.End, []Slot{morning, evening}},
+		{"slot ending at to", morning.Start, morning.End, []Slot{morning}},
+		{"slot running past to", morning.Start, morning.End.Add(-time.Minute), nil},
+		{"from inside a slot", morning.Start.Add(time.Minute), evening.End, []Slot{evening}},
+		{"only the booked slot", afternoon.Start, afternoon.End, nil},
+		{"between slots", morning.End, afternoon.Start, nil},
+		{"before the window", morning.Start.AddDate(-1, 0, 0), morning.Start.AddDate(0, 0, -7), nil},
+	}
+	for _, tt := range tests {
+		got := rdt.FreeSlots(tt.from, tt.to)
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: %d free, want %d", tt.name, len(got), len(tt.want))
+			continue
+		}
+		for i := range got {
+			if got[i].Key() != tt.want[i].Key() {
+				t.Errorf("%s: free %v, want %v", tt.name, got, tt.want)
+				break
+			}
+		}
+	}
+	// a zero to runs to the end of the window
+	if n := len(rdt.FreeSlots(morning.Start, time.Time{})); n != len(slots)-1 {
+		t.Fatalf("%d free to the end of the window, want %d", n, len(slots)-1)
+	}
+	rdt.close(true)
+	if free := rdt.FreeSlots(morning.Start, evening.End); len(free) != 0 {
+		t.Fatalf("closed venue has free slots %v", free)
+	}
+}
+
+func TestFreeIntervals(t *testing.T) {
+	m, vid, rdt := newTestModel(t)
+	slots := rdt.ReadAvailable()[len(rdt.Parts()):]
+	morning := slots[0]
+	day := morning.Start.Add(-8 * time.Hour)
+	at := func(h int) time.Time { return day.Add(time.Duration(h) * time.Hour) }
+	if _, err := m.BookingDB.Reserve(vid, morning, "ann"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.BookingDB.Reserve(vid, CustomSlot(Interval{Start: at(14), End: at(15)}), "bob"); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		from time.Time
+		to   time.Time
+		want []Interval
+	}{
+		{"around both", at(6), at(16), []Interval{{at(6), at(8)}, {at(12), at(14)}, {at(15), at(16)}}},
+		{"inside a booking", at(9), at(11), []Interval{}},
+		{"starting in a booking", at(10), at(13), []Interval{{at(12), at(13)}}},
+		{"nothing booked", at(16), at(20), []Interval{{at(16), at(20)}}},
+		{"ending where a booking starts", at(6), at(8), []Interval{{at(6), at(8)}}},
+	}
+	for _, tt := range tests {
+		got := m.BookingDB.FreeIntervals(vid, tt.from, tt.to)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: free %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	if got := m.BookingDB.FreeIntervals(9, at(6), at(16)); got != nil {
+		t.Fatalf("venue 9 has free intervals %v", got)
+	}
+}
+
+func TestModelSearch(t *testing.T) {
+	m, _, rdt := newTestModel(t)
+	if err := m.AddVenue(Venue{Name: "Barn", Kind: "Barn", Location: "South", Capacity: 30}); err != nil {
+		t.Fatal(err)
+	}
+	slots := rdt.ReadAvailable()[len(rdt.Parts()):]
+	morning := slots[0]
+	// the hall is booked all tomorrow morning, the barn is not
+	if _, err := m.BookingDB.Reserve(1, morning, "ann"); err != nil {
+		t.Fatal(err)
+	}
+	all := Query{Location: "Nil", Kind: "Nil", CapMin: 0, CapMax: 100}
+	in := func(from, to time.Time) Query {
+		q := all
+		q.DateMin, q.DateMax = from, to
+		return q
+	}
+	tests := []struct {
+		name string
+		q    Query
+		want []int // ids, sorted
+		free int   // free slots of each, -1 if not asked
+	}{
+		{"no dates", all, []int{1, 2}, -1},
+		{"free tomorrow morning", in(morning.Start, morning.End), []int{2}, 1},
+		{"free tomorrow", in(morning.Start, slots[2].End), []int{1, 2}, -1},
+		{"from only", in(morning.Start, time.Time{}), []int{1, 2}, -1},
+		{"too short for a slot", in(morning.Start, morning.Start.Add(time.Hour)), []int{}, 0},
+	}
+	for _, tt := range tests {
+		matches := m.Search(tt.q)
+		var ids []int
+		for _, match := range matches {
+			ids = append(ids, match.ID)
+			if tt.free >= 0 && len(match.Free) != tt.free {
+				t.Errorf("%s: venue %d has %d free, want %d", tt.name, match.ID, len(match.Free), tt.free)
+			}
+		}
+		sort.Ints(ids)
+		if len(ids) != len(tt.want) || (len(ids) > 0 && !reflect.DeepEqual(ids, tt.want)) {
+			t.Errorf("%s: found %v, want %v", tt.name, ids, tt.want)
+		}
+	}
+}
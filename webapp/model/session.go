@@ -0,0 +1,178 @@
+package model
+
+import "time"
+
+// touchEvery : how stale LastSeen may get before a request rewrites it,
+// so browsing does not write to the store on every page
+const touchEvery = time.Minute
+
+// Session : a browser login. The id is random and is what the cookie holds,
+// a new one is made on every login so an id known before login is useless
+type Session struct {
+	ID       string
+	Username string
+	Created  time.Time
+	LastSeen time.Time
+}
+
+// SessionPolicy : how long sessions last, MaxAge from login and
+// Idle since the last request
+type SessionPolicy struct {
+	MaxAge time.Duration
+	Idle   time.Duration
+}
+
+//Expires : when s expires if it is not used again
+func (p SessionPolicy) Expires(s Session) time.Time {
+	end := s.Created.Add(p.MaxAge)
+	if idle := s.LastSeen.Add(p.Idle); idle.Before(end) {
+		return idle
+	}
+	return end
+}
+
+//Expired : true if s has expired at now
+func (p SessionPolicy) Expired(s Session, now time.Time) bool {
+	return !now.Before(p.Expires(s))
+}
+
+//StartSession : log username in with a new session, ending the
+//session previous if it is not empty
+func (uDB *userDB) StartSession(username string, previous string) (Session, error) {
+	id, err := newToken()
+	if err != nil {
+		return Session{}, err
+	}
+	if previous != "" {
+		if err := uDB.store.DeleteSession(previous); err != nil {
+			return Session{}, err
+		}
+	}
+	now := time.Now()
+	s := Session{
+		ID:       id,
+		Username: username,
+		Created:  now,
+		LastSeen: now,
+	}
+	return s, uDB.store.PutSession(s)
+}
+
+//Session : live session with id, marked as just used.
+//Expired sessions are deleted and ErrSessionNotFound
+func (uDB *userDB) Session(id string, p SessionPolicy) (Session, error) {
+	s, err := uDB.store.Session(id)
+	if err != nil {
+		return s, err
+	}
+	now := time.Now()
+	if p.Expired(s, now) {
+		uDB.store.DeleteSession(id)
+		return Session{}, ErrSessionNotFound
+	}
+	if now.Sub(s.LastSeen) > touchEvery {
+		if err := uDB.touch(id, now); err != nil {
+			return Session{}, err
+		}
+		s.LastSeen = now
+	}
+	return s, nil
+}
+
+// touch : mark session id as used at now. Under mu and only if the
+// session is still there, so one being logged out is not written back
+func (uDB *userDB) touch(id string, now time.Time) error {
+	uDB.mu.Lock()
+	defer uDB.mu.Unlock()
+	s, err := uDB.store.Session(id)
+	if err != nil {
+		return err
+	}
+	s.LastSeen = now
+	return uDB.store.PutSession(s)
+}
+
+//DeleteSession : log session id out
+func (uDB *userDB) DeleteSession(id string) error {
+	return uDB.store.DeleteSession(id)
+}
+
+//DeleteSessions : log username out of every session, the number ended
+func (uDB *userDB) DeleteSessions(username string) (int, error) {
+	return uDB.deleteSessions(func(s Session) bool {
+		return s.Username == username
+	})
+}
+
+//SweepSessions : delete every expired session, the number deleted
+func (uDB *userDB) SweepSessions(p SessionPolicy, now time.Time) (int, error) {
+	return uDB.deleteSessions(func(s Session) bool {
+		return p.Expired(s, now)
+	})
+}
+
+func (uDB *userDB) deleteSessions(match func(s Session) bool) (int, error) {
+	uDB.mu.Lock()
+	defer uDB.mu.Unlock()
+	sessions, err := uDB.store.Sessions()
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for id, s := range sessions {
+		if !match(s) {
+			continue
+		}
+		if err := uDB.store.DeleteSession(id); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// Sweeper : deletes expired sessions and api tokens in the background,
+// those that are never used again would otherwise be kept forever
+type Sweeper struct {
+	uDB    *userDB
+	policy SessionPolicy
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+//StartSweeper : start sweeping sessions and tokens every interval until
+//Stop, sweep is called for each with what was swept, "sessions" or
+//"tokens", and the number deleted or an error
+func (m *Model) StartSweeper(p SessionPolicy, every time.Duration, sweep func(what string, n int, err error)) *Sweeper {
+	s := &Sweeper{
+		uDB:    m.UserDB,
+		policy: p,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go s.run(every, sweep)
+	return s
+}
+
+func (s *Sweeper) run(every time.Duration, sweep func(what string, n int, err error)) {
+	defer close(s.done)
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case now := <-ticker.C:
+			n, err := s.uDB.SweepSessions(s.policy, now)
+			sweep("sessions", n, err)
+			n, err = s.uDB.SweepTokens(now)
+			sweep("tokens", n, err)
+		}
+	}
+}
+
+//Stop : stop the sweeper and wait for a running sweep to finish
+func (s *Sweeper) Stop() {
+	close(s.stop)
+	<-s.done
+}
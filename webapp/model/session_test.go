@@ -0,0 +1,134 @@
+package model
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSessionPolicy(t *testing.T) {
+	p := SessionPolicy{MaxAge: 24 * time.Hour, Idle: time.Hour}
+	login := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		lastSeen time.Time
+		now      time.Time
+		expires  time.Time
+		expired  bool
+	}{
+		{"just logged in", login, login, login.Add(time.Hour), false},
+		{"idle too long", login, login.Add(time.Hour), login.Add(time.Hour), true},
+		{"kept alive", login.Add(5 * time.Hour), login.Add(5*time.Hour + 30*time.Minute), login.Add(6 * time.Hour), false},
+		{"used but too old", login.Add(23*time.Hour + 30*time.Minute), login.Add(24 * time.Hour), login.Add(24 * time.Hour), true},
+		{"max age caps idle", login.Add(23*time.Hour + 30*time.Minute), login.Add(23*time.Hour + 45*time.Minute), login.Add(24 * time.Hour), false},
+	}
+	for _, tt := range tests {
+		s := Session{ID: "s", Username: "ann", Created: login, LastSeen: tt.lastSeen}
+		if got := p.Expires(s); !got.Equal(tt.expires) {
+			t.Errorf("%s: expires %v, want %v", tt.name, got, tt.expires)
+		}
+		if got := p.Expired(s, tt.now); got != tt.expired {
+			t.Errorf("%s: expired %t, want %t", tt.name, got, tt.expired)
+		}
+	}
+}
+
+func TestSessionTouchRace(t *testing.T) {
+	m, err := InitModel(NewMemStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	uDB := m.UserDB
+	p := SessionPolicy{MaxAge: 24 * time.Hour, Idle: time.Hour}
+	// stale enough that every lookup writes LastSeen back
+	stale := time.Now().Add(-10 * time.Minute)
+	const n = 32
+	ids := make([]string, n)
+	for i := range ids {
+		ids[i] = fmt.Sprint("session", i)
+		s := Session{ID: ids[i], Username: "ann", Created: stale, LastSeen: stale}
+		if err := m.Store.PutSession(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for _, id := range ids {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			<-start
+			if _, err := uDB.Session(id, p); err != nil && err != ErrSessionNotFound {
+				t.Errorf("session %s gave %v", id, err)
+			}
+		}(id)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		<-start
+		if _, err := uDB.DeleteSessions("ann"); err != nil {
+			t.Errorf("DeleteSessions gave %v", err)
+		}
+	}()
+	close(start)
+	wg.Wait()
+	// a touch racing the logout must not bring a session back
+	for _, id := range ids {
+		if _, err := uDB.Session(id, p); err != ErrSessionNotFound {
+			t.Errorf("session %s after logging out everywhere gave %v, want ErrSessionNotFound", id, err)
+		}
+	}
+}
+
+func TestSweeper(t *testing.T) {
+	m, err := InitModel(NewMemStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := SessionPolicy{MaxAge: 24 * time.Hour, Idle: time.Hour}
+	old := time.Now().Add(-2 * time.Hour)
+	if err := m.Store.PutSession(Session{ID: "old", Username: "ann", Created: old, LastSeen: old}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.UserDB.StartSession("ann", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.UserDB.IssueTokens("ann", -time.Minute, -time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	swept := map[string]int{}
+	done := make(chan struct{})
+	s := m.StartSweeper(p, time.Millisecond, func(what string, n int, err error) {
+		if err != nil {
+			t.Errorf("sweeping %s gave %v", what, err)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		swept[what] += n
+		if what == "tokens" && len(swept) == 2 {
+			select {
+			case <-done:
+			default:
+				close(done)
+			}
+		}
+	})
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("sweeper did not run")
+	}
+	s.Stop()
+	mu.Lock()
+	defer mu.Unlock()
+	if swept["sessions"] != 1 || swept["tokens"] != 2 {
+		t.Fatalf("swept %v, want 1 session and 2 tokens", swept)
+	}
+	sessions, err := m.Store.Sessions()
+	if err != nil || len(sessions) != 1 {
+		t.Fatalf("%d sessions left, %v, want the live one", len(sessions), err)
+	}
+}
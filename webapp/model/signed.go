@@ -0,0 +1,195 @@
+package model
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+//ErrLinkInvalid : signed link is forged, expired or already used
+var ErrLinkInvalid = errors.New("link is invalid, expired or already used")
+
+// purposes of signed links
+const (
+	purposeReset  = "reset"
+	purposeVerify = "verify"
+	purposeFeed   = "feed"
+)
+
+// Signer : makes links that cannot be forged without its key. Links are
+// not stored, they carry what they are for and are checked against the
+// user when they are used
+type Signer struct {
+	key []byte
+}
+
+//NewSigner : signer using key, which must stay secret and the same
+//across restarts for links to keep working
+func NewSigner(key []byte) *Signer {
+	return &Signer{key: key}
+}
+
+// signed : what a link carries. Bind is a fingerprint of the user's state
+// the link is only good for, so it stops working once that changes
+type signed struct {
+	Purpose  string `json:"p"`
+	Username string `json:"u"`
+	Expires  int64  `json:"e"` // unix seconds, 0 for never
+	Bind     string `json:"b"`
+}
+
+func (s *Signer) mac(payload []byte) []byte {
+	h := hmac.New(sha256.New, s.key)
+	h.Write(payload)
+	return h.Sum(nil)
+}
+
+// sign : token of v
+func (s *Signer) sign(v signed) (string, error) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString(payload) + "." + enc.EncodeToString(s.mac(payload)), nil
+}
+
+// open : what token carries, if this signer made it for purpose
+// and it has not expired
+func (s *Signer) open(token string, purpose string, now time.Time) (signed, error) {
+	var v signed
+	enc := base64.RawURLEncoding
+	p, m, ok := strings.Cut(token, ".")
+	if !ok {
+		return v, ErrLinkInvalid
+	}
+	payload, err1 := enc.DecodeString(p)
+	mac, err2 := enc.DecodeString(m)
+	if err1 != nil || err2 != nil || !hmac.Equal(mac, s.mac(payload)) {
+		return v, ErrLinkInvalid
+	}
+	if json.Unmarshal(payload, &v) != nil || v.Purpose != purpose || (v.Expires != 0 && now.Unix() > v.Expires) {
+		return v, ErrLinkInvalid
+	}
+	return v, nil
+}
+
+// fingerprint : short hash of b to bind a link to
+func fingerprint(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:8])
+}
+
+// link : signed token for username, purpose and bind, valid for ttl
+// or until bind changes if ttl is 0
+func (s *Signer) link(purpose string, username string, bind []byte, ttl time.Duration) (string, error) {
+	v := signed{
+		Purpose:  purpose,
+		Username: username,
+		Bind:     fingerprint(bind),
+	}
+	if ttl != 0 {
+		v.Expires = time.Now().Add(ttl).Unix()
+	}
+	return s.sign(v)
+}
+
+//ResetLink : token to reset the password of u, valid for ttl. It is
+//bound to u's password, so it is used up once the password changes
+func (s *Signer) ResetLink(u User, ttl time.Duration) (string, error) {
+	return s.link(purposeReset, u.Username, passwordOf(u), ttl)
+}
+
+//VerifyLink : token to verify the email of u, valid for ttl. It is
+//bound to u's email, so changing the email makes it useless
+func (s *Signer) VerifyLink(u User, ttl time.Duration) (string, error) {
+	return s.link(purposeVerify, u.Username, emailOf(u), ttl)
+}
+
+//FeedLink : token for the calendar feed of u. It does not expire, but
+//stops working once u's feed key is changed by ResetFeed
+func (s *Signer) FeedLink(u User) (string, error) {
+	return s.link(purposeFeed, u.Username, feedKeyOf(u), 0)
+}
+
+// check : user token was made for purpose, if it is still bound to
+// their state
+func (uDB *userDB) check(s *Signer, token string, purpose string, bind func(u User) []byte) (User, error) {
+	v, err := s.open(token, purpose, time.Now())
+	if err != nil {
+		return User{}, err
+	}
+	u, err := uDB.store.User(v.Username)
+	if err == ErrUserNotFound {
+		return User{}, ErrLinkInvalid
+	}
+	if err != nil {
+		return User{}, err
+	}
+	if fingerprint(bind(u)) != v.Bind {
+		return User{}, ErrLinkInvalid
+	}
+	return u, nil
+}
+
+// use : check token, then apply fn to its user in one step
+func (uDB *userDB) use(s *Signer, token string, purpose string, bind func(u User) []byte, fn func(u *User)) (User, error) {
+	uDB.mu.Lock()
+	defer uDB.mu.Unlock()
+	u, err := uDB.check(s, token, purpose, bind)
+	if err != nil {
+		return u, err
+	}
+	fn(&u)
+	return u, uDB.store.PutUser(u)
+}
+
+func passwordOf(u User) []byte { return u.Password }
+
+func emailOf(u User) []byte { return []byte(u.Email) }
+
+func feedKeyOf(u User) []byte { return []byte(u.FeedKey) }
+
+//ResetUser : user a reset token was made for, without using it up
+func (uDB *userDB) ResetUser(s *Signer, token string) (User, error) {
+	return uDB.check(s, token, purposeReset, passwordOf)
+}
+
+//ResetPassword : set the password hash of the user token was made for,
+//clearing any lockout. The token cannot be used again
+func (uDB *userDB) ResetPassword(s *Signer, token string, hash []byte) (User, error) {
+	return uDB.use(s, token, purposeReset, passwordOf, func(u *User) {
+		u.Password = hash
+		u.FailedLogins = 0
+		u.LockedUntil = time.Time{}
+	})
+}
+
+//FeedUser : user a calendar feed token was made for
+func (uDB *userDB) FeedUser(s *Signer, token string) (User, error) {
+	return uDB.check(s, token, purposeFeed, feedKeyOf)
+}
+
+//ResetFeed : give username a new feed key, so links to their calendar
+//feed made before stop working
+func (uDB *userDB) ResetFeed(username string) (User, error) {
+	key, err := newToken()
+	if err != nil {
+		return User{}, err
+	}
+	return uDB.Update(username, func(u *User) {
+		u.FeedKey = key
+	})
+}
+
+//VerifyEmail : mark the email of the user token was made for as verified
+func (uDB *userDB) VerifyEmail(s *Signer, token string) (User, error) {
+	return uDB.use(s, token, purposeVerify, emailOf, func(u *User) {
+		u.Verified = true
+	})
+}
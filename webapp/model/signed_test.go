@@ -0,0 +1,76 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSignedLinks(t *testing.T) {
+	m, err := InitModel(NewMemStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	uDB := m.UserDB
+	ann := User{Username: "ann", Password: []byte("hash"), Email: "ann@example.com"}
+	if err := uDB.Add(ann); err != nil {
+		t.Fatal(err)
+	}
+	s := NewSigner([]byte("key"))
+	reset, err := s.ResetLink(ann, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verify, err := s.VerifyLink(ann, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, err := s.ResetLink(ann, -time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged, err := NewSigner([]byte("other key")).ResetLink(ann, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ghost, err := s.ResetLink(User{Username: "ghost"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{"reset link", reset, nil},
+		{"verify link used to reset", verify, ErrLinkInvalid},
+		{"expired", expired, ErrLinkInvalid},
+		{"signed with another key", forged, ErrLinkInvalid},
+		{"payload changed", "x" + reset, ErrLinkInvalid},
+		{"no signature", "nodot", ErrLinkInvalid},
+		{"unknown user", ghost, ErrLinkInvalid},
+	}
+	for _, tt := range tests {
+		if _, err := uDB.ResetUser(s, tt.token); err != tt.want {
+			t.Errorf("%s: ResetUser gave %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	// a reset changes the password the link is bound to, so it works once
+	if _, err := uDB.ResetPassword(s, reset, []byte("new hash")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := uDB.ResetPassword(s, reset, []byte("newer hash")); err != ErrLinkInvalid {
+		t.Fatalf("reset link used twice gave %v, want ErrLinkInvalid", err)
+	}
+	// a verify link stops working once the email it was sent to changes
+	if _, err := uDB.Update("ann", func(u *User) { u.Email = "ann@example.org" }); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := uDB.VerifyEmail(s, verify); err != ErrLinkInvalid {
+		t.Fatalf("verify link for an old email gave %v, want ErrLinkInvalid", err)
+	}
+	u, _ := uDB.Get("ann")
+	if string(u.Password) != "new hash" || u.Verified {
+		t.Fatalf("ann has password %q and verified %t", u.Password, u.Verified)
+	}
+}
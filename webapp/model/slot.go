@@ -0,0 +1,158 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+//Location : time zone venues lay out their day parts in
+var Location = time.Local
+
+// DayPart : named bookable part of a day, offsets are from midnight
+type DayPart struct {
+	Name  string
+	Start time.Duration
+	End   time.Duration
+}
+
+//DefaultDayParts : morning, afternoon and evening.
+//Their order matches the T digit of the old YYMMDDT encoding
+var DefaultDayParts = []DayPart{
+	{Name: "Morning", Start: 8 * time.Hour, End: 12 * time.Hour},
+	{Name: "Afternoon", Start: 13 * time.Hour, End: 17 * time.Hour},
+	{Name: "Evening", Start: 18 * time.Hour, End: 22 * time.Hour},
+}
+
+func (p DayPart) String() string {
+	return fmt.Sprintf("%s %s-%s", p.Name, clock(p.Start), clock(p.End))
+}
+
+// clock : format offset from midnight as HH:MM
+func clock(d time.Duration) string {
+	return fmt.Sprintf("%02d:%02d", int(d.Hours()), int(d.Minutes())%60)
+}
+
+// on : slot of this day part on the day of t
+func (p DayPart) on(t time.Time, part int) Slot {
+	year, month, day := t.In(Location).Date()
+	return Slot{
+		Start: time.Date(year, month, day, 0, 0, 0, int(p.Start), Location),
+		End:   time.Date(year, month, day, 0, 0, 0, int(p.End), Location),
+		Part:  part,
+		Name:  p.Name,
+	}
+}
+
+// ParseDayParts : parse one "Name HH:MM-HH:MM" day part per line.
+// An empty string gives DefaultDayParts
+func ParseDayParts(s string) ([]DayPart, error) {
+	var parts []DayPart
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		i := strings.LastIndex(line, " ")
+		if i < 1 {
+			return nil, fmt.Errorf("day part %q: want \"Name HH:MM-HH:MM\"", line)
+		}
+		span := strings.SplitN(line[i+1:], "-", 2)
+		if len(span) != 2 {
+			return nil, fmt.Errorf("day part %q: want \"Name HH:MM-HH:MM\"", line)
+		}
+		start, err1 := parseClock(span[0])
+		end, err2 := parseClock(span[1])
+		if err1 != nil || err2 != nil || end <= start {
+			return nil, fmt.Errorf("day part %q: invalid times", line)
+		}
+		if len(parts) > 0 && start < parts[len(parts)-1].End {
+			return nil, fmt.Errorf("day part %q: overlaps previous part", line)
+		}
+		parts = append(parts, DayPart{
+			Name:  strings.TrimSpace(line[:i]),
+			Start: start,
+			End:   end,
+		})
+	}
+	if len(parts) == 0 {
+		return DefaultDayParts, nil
+	}
+	return parts, nil
+}
+
+// parseClock : HH:MM to offset from midnight, 24:00 allowed as end of day
+func parseClock(s string) (time.Duration, error) {
+	var h, m int
+	if _, err := fmt.Sscanf(s, "%d:%d", &h, &m); err != nil {
+		return 0, err
+	}
+	if h < 0 || m < 0 || m > 59 || h*60+m > 24*60 {
+		return 0, errors.New("time out of range")
+	}
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute, nil
+}
+
+//CustomPart : Slot.Part of a custom time range booking
+const CustomPart = -1
+
+// Slot : a bookable period of a venue, either one of its day parts
+// or a custom time range
+type Slot struct {
+	Start time.Time
+	End   time.Time
+	Part  int    // index into the venue's day parts, or CustomPart
+	Name  string // name of the day part
+}
+
+// CustomSlot : slot of a custom time range booking over iv
+func CustomSlot(iv Interval) Slot {
+	return Slot{Start: iv.Start, End: iv.End, Part: CustomPart, Name: "Custom"}
+}
+
+// Key : tree key of slot, its start in unix seconds
+func (s Slot) Key() int64 {
+	return s.Start.Unix()
+}
+
+// Date : start date of slot, for display
+func (s Slot) Date() string {
+	return s.Start.Format("Mon 02 Jan 2006")
+}
+
+// Time : day part and clock range of slot, for display.
+// End date is included when the slot runs past the day it starts
+func (s Slot) Time() string {
+	end := s.End.Format("15:04")
+	if !s.End.After(dayStart(s.Start).AddDate(0, 0, 1)) {
+		return fmt.Sprintf("%s %s-%s", s.Name, s.Start.Format("15:04"), end)
+	}
+	return fmt.Sprintf("%s %s - %s %s", s.Name, s.Start.Format("15:04"), s.End.Format("Mon 02 Jan 2006"), end)
+}
+
+func (s Slot) String() string {
+	return s.Date() + " " + s.Time()
+}
+
+// dayStart : midnight starting the day of t
+func dayStart(t time.Time) time.Time {
+	year, month, day := t.In(Location).Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, Location)
+}
+
+// ParseSlotCode : read an old YYMMDDT encoded slot, e.g. 2012303 is
+// 30 Dec 2020, third day part. YY is taken as 20YY
+func ParseSlotCode(code int, parts []DayPart) (Slot, error) {
+	part := code%10 - 1
+	date := code / 10
+	if part < 0 || part >= len(parts) || date < 10101 || date > 991231 {
+		return Slot{}, fmt.Errorf("invalid slot code %d", code)
+	}
+	year, month, day := 2000+date/10000, time.Month(date/100%100), date%100
+	t := time.Date(year, month, day, 0, 0, 0, 0, Location)
+	if t.Month() != month || t.Day() != day {
+		return Slot{}, fmt.Errorf("invalid slot code %d", code)
+	}
+	return parts[part].on(t, part), nil
+}
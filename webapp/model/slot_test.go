@@ -0,0 +1,120 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseClock(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+		ok   bool
+	}{
+		{"08:00", 8 * time.Hour, true},
+		{"13:45", 13*time.Hour + 45*time.Minute, true},
+		{"24:00", 24 * time.Hour, true},
+		{"00:00", 0, true},
+		{"24:01", 0, false},
+		{"12:60", 0, false},
+		{"-1:00", 0, false},
+		{"noon", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := parseClock(tt.in)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("parseClock(%q) = %v, %v, want %v, ok %v", tt.in, got, err, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestParseDayParts(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want []DayPart
+		ok   bool
+	}{
+		{"empty gives defaults", "", DefaultDayParts, true},
+		{"blank lines give defaults", "\n  \n", DefaultDayParts, true},
+		{"one part", "Morning 08:00-12:00", []DayPart{{"Morning", 8 * time.Hour, 12 * time.Hour}}, true},
+		{"name with spaces", "Late night 22:00-24:00", []DayPart{{"Late night", 22 * time.Hour, 24 * time.Hour}}, true},
+		{"several, trimmed", " Early 06:00-09:00 \nLate 09:00-11:30\n", []DayPart{
+			{"Early", 6 * time.Hour, 9 * time.Hour},
+			{"Late", 9 * time.Hour, 11*time.Hour + 30*time.Minute},
+		}, true},
+		{"no name", "08:00-12:00", nil, false},
+		{"no range", "Morning 08:00", nil, false},
+		{"end before start", "Morning 12:00-08:00", nil, false},
+		{"empty part", "Morning 08:00-08:00", nil, false},
+		{"bad time", "Morning 08:00-25:00", nil, false},
+		{"overlap", "Morning 08:00-12:00\nLunch 11:00-13:00", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseDayParts(tt.in)
+			if (err == nil) != tt.ok {
+				t.Fatalf("error %v, want ok %v", err, tt.ok)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("part %d is %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseSlotCode(t *testing.T) {
+	tests := []struct {
+		code  int
+		start time.Time
+		part  int
+		ok    bool
+	}{
+		{2012303, time.Date(2020, time.December, 30, 18, 0, 0, 0, Location), 2, true},
+		{2101011, time.Date(2021, time.January, 1, 8, 0, 0, 0, Location), 0, true},
+		{2402292, time.Date(2024, time.February, 29, 13, 0, 0, 0, Location), 1, true},
+		{2302292, time.Time{}, 0, false}, // not a leap year
+		{2013011, time.Time{}, 0, false}, // month 13
+		{2012304, time.Time{}, 0, false}, // no fourth part
+		{2012300, time.Time{}, 0, false}, // no part 0
+		{123, time.Time{}, 0, false},
+	}
+	for _, tt := range tests {
+		s, err := ParseSlotCode(tt.code, DefaultDayParts)
+		if (err == nil) != tt.ok {
+			t.Errorf("ParseSlotCode(%d) error %v, want ok %v", tt.code, err, tt.ok)
+			continue
+		}
+		if !tt.ok {
+			continue
+		}
+		if !s.Start.Equal(tt.start) || s.Part != tt.part || s.Name != DefaultDayParts[tt.part].Name {
+			t.Errorf("ParseSlotCode(%d) = %v part %d, want %v part %d", tt.code, s, s.Part, tt.start, tt.part)
+		}
+		if s.Key() != tt.start.Unix() {
+			t.Errorf("ParseSlotCode(%d) has key %d, want %d", tt.code, s.Key(), tt.start.Unix())
+		}
+	}
+}
+
+func TestSlotFormat(t *testing.T) {
+	s := DefaultDayParts[1].on(time.Date(2020, time.December, 30, 9, 0, 0, 0, Location), 1)
+	tests := []struct {
+		got, want string
+	}{
+		{s.Date(), "Wed 30 Dec 2020"},
+		{s.Time(), "Afternoon 13:00-17:00"},
+		{s.String(), "Wed 30 Dec 2020 Afternoon 13:00-17:00"},
+		{DefaultDayParts[0].String(), "Morning 08:00-12:00"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("got %q, want %q", tt.got, tt.want)
+		}
+	}
+}
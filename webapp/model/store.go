@@ -0,0 +1,310 @@
+package model
+
+import (
+	"errors"
+	"sync"
+)
+
+var (
+	//ErrUserNotFound : no user with the given username
+	ErrUserNotFound = errors.New("user not found")
+	//ErrUserExists : username is already taken
+	ErrUserExists = errors.New("username already taken")
+	//ErrSessionNotFound : no login with the given session id
+	ErrSessionNotFound = errors.New("session not found")
+)
+
+// counters kept in the store, each the next id to give out. They are
+// saved so ids of deleted records are never given out again
+const (
+	venueCounter   = "venues"
+	bookingCounter = "bookings"
+)
+
+// Store : where users, sessions, venues, bookings and notifications are kept.
+// Venues and bookings are loaded once by InitModel, which keeps its own
+// search trees of them, and written back as they change.
+// Users, sessions, tokens and notifications are read from the store on every use.
+// Counter is 0 for a counter that was never put
+type Store interface {
+	User(username string) (User, error)
+	Users() (map[string]User, error)
+	PutUser(u User) error
+	Session(id string) (Session, error)
+	Sessions() (map[string]Session, error)
+	PutSession(s Session) error
+	DeleteSession(id string) error
+	Token(hash string) (Token, error)
+	Tokens() (map[string]Token, error)
+	PutToken(t Token) error
+	DeleteToken(hash string) error
+	Venues() (map[int]Venue, error)
+	PutVenue(id int, v Venue) error
+	DeleteVenue(id int) error
+	Bookings() (map[int]Booking, error)
+	PutBooking(b Booking) error
+	DeleteBooking(id int) error
+	Counter(name string) (int, error)
+	PutCounter(name string, next int) error
+	Notifications() (map[int]Notification, error)
+	PutNotification(n Notification) error
+	DeleteNotification(id int) error
+	Close() error
+}
+
+// MemStore : Store kept in maps, everything is lost on restart.
+// Records are copied in and out, like the disk stores it stands in for
+type MemStore struct {
+	mu       sync.RWMutex
+	users    map[string]User
+	sessions map[string]Session
+	tokens   map[string]Token
+	venues   map[int]Venue
+	bookings map[int]Booking
+	counters map[string]int
+	notes    map[int]Notification
+}
+
+//NewMemStore : empty in memory store
+func NewMemStore() *MemStore {
+	return &MemStore{
+		users:    make(map[string]User),
+		sessions: make(map[string]Session),
+		tokens:   make(map[string]Token),
+		venues:   make(map[int]Venue),
+		bookings: make(map[int]Booking),
+		counters: make(map[string]int),
+		notes:    make(map[int]Notification),
+	}
+}
+
+// copyUser : u sharing no slices with the user it was copied from
+func copyUser(u User) User {
+	u.Password = append([]byte(nil), u.Password...)
+	u.Bookings = append([]int(nil), u.Bookings...)
+	u.Notices = append([]string(nil), u.Notices...)
+	return u
+}
+
+// copyVenue : v sharing no slices or maps with the venue it was copied from
+func copyVenue(v Venue) Venue {
+	v.DayParts = append([]DayPart(nil), v.DayParts...)
+	v.Amenities = append([]string(nil), v.Amenities...)
+	v.Tags = append([]string(nil), v.Tags...)
+	v.Media = append([]Media(nil), v.Media...)
+	if v.Attrs != nil {
+		attrs := make(map[string]float64, len(v.Attrs))
+		for k, n := range v.Attrs {
+			attrs[k] = n
+		}
+		v.Attrs = attrs
+	}
+	return v
+}
+
+//User : user with username
+func (s *MemStore) User(username string) (User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	u, ok := s.users[username]
+	if !ok {
+		return User{}, ErrUserNotFound
+	}
+	return copyUser(u), nil
+}
+
+//Users : every user by username
+func (s *MemStore) Users() (map[string]User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	users := make(map[string]User, len(s.users))
+	for k, u := range s.users {
+		users[k] = u
+	}
+	return users, nil
+}
+
+//PutUser : add or replace u
+func (s *MemStore) PutUser(u User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users[u.Username] = copyUser(u)
+	return nil
+}
+
+//Session : login with session id
+func (s *MemStore) Session(id string) (Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	sess, ok := s.sessions[id]
+	if !ok {
+		return Session{}, ErrSessionNotFound
+	}
+	return sess, nil
+}
+
+//Sessions : every login by session id
+func (s *MemStore) Sessions() (map[string]Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	sessions := make(map[string]Session, len(s.sessions))
+	for k, sess := range s.sessions {
+		sessions[k] = sess
+	}
+	return sessions, nil
+}
+
+//PutSession : add or replace login sess
+func (s *MemStore) PutSession(sess Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions[sess.ID] = sess
+	return nil
+}
+
+//DeleteSession : log session id out
+func (s *MemStore) DeleteSession(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, id)
+	return nil
+}
+
+//Token : token stored under hash
+func (s *MemStore) Token(hash string) (Token, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	t, ok := s.tokens[hash]
+	if !ok {
+		return Token{}, ErrTokenInvalid
+	}
+	return t, nil
+}
+
+//Tokens : every token by hash
+func (s *MemStore) Tokens() (map[string]Token, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	tokens := make(map[string]Token, len(s.tokens))
+	for k, t := range s.tokens {
+		tokens[k] = t
+	}
+	return tokens, nil
+}
+
+//PutToken : add or replace t
+func (s *MemStore) PutToken(t Token) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens[t.Hash] = t
+	return nil
+}
+
+//DeleteToken : remove token stored under hash
+func (s *MemStore) DeleteToken(hash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.tokens, hash)
+	return nil
+}
+
+//Venues : every venue by id
+func (s *MemStore) Venues() (map[int]Venue, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	venues := make(map[int]Venue, len(s.venues))
+	for k, v := range s.venues {
+		venues[k] = copyVenue(v)
+	}
+	return venues, nil
+}
+
+//PutVenue : add or replace venue id
+func (s *MemStore) PutVenue(id int, v Venue) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.venues[id] = copyVenue(v)
+	return nil
+}
+
+//DeleteVenue : remove venue id
+func (s *MemStore) DeleteVenue(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.venues, id)
+	return nil
+}
+
+//Bookings : every booking by id
+func (s *MemStore) Bookings() (map[int]Booking, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	bookings := make(map[int]Booking, len(s.bookings))
+	for k, b := range s.bookings {
+		bookings[k] = b
+	}
+	return bookings, nil
+}
+
+//PutBooking : add or replace b
+func (s *MemStore) PutBooking(b Booking) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.bookings[b.IDBook] = b
+	return nil
+}
+
+//DeleteBooking : remove booking id
+func (s *MemStore) DeleteBooking(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.bookings, id)
+	return nil
+}
+
+//Counter : next id counter name gives out
+func (s *MemStore) Counter(name string) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.counters[name], nil
+}
+
+//PutCounter : set the next id counter name gives out
+func (s *MemStore) PutCounter(name string, next int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counters[name] = next
+	return nil
+}
+
+//Notifications : every queued notification by id
+func (s *MemStore) Notifications() (map[int]Notification, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	notes := make(map[int]Notification, len(s.notes))
+	for k, n := range s.notes {
+		notes[k] = n
+	}
+	return notes, nil
+}
+
+//PutNotification : add or replace n
+func (s *MemStore) PutNotification(n Notification) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.notes[n.ID] = n
+	return nil
+}
+
+//DeleteNotification : remove notification id
+func (s *MemStore) DeleteNotification(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.notes, id)
+	return nil
+}
+
+//Close : nothing to release
+func (s *MemStore) Close() error {
+	return nil
+}
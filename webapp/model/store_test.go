@@ -0,0 +1,187 @@
+package model
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// stores : every Store kept on disk, opened on dir
+var stores = map[string]func(dir string) (Store, error){
+	"bolt": func(dir string) (Store, error) {
+		return OpenBoltStore(filepath.Join(dir, "data.db"))
+	},
+	"journal": func(dir string) (Store, error) {
+		return OpenJournalStore(dir, time.Hour)
+	},
+}
+
+func TestIDsNotReused(t *testing.T) {
+	for name, open := range stores {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			reopen := func() Model {
+				t.Helper()
+				store, err := open(dir)
+				if err != nil {
+					t.Fatal(err)
+				}
+				m, err := InitModel(store)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return m
+			}
+			m := reopen()
+			for _, n := range []string{"One", "Two"} {
+				if err := m.AddVenue(Venue{Name: n, Kind: "Hall", Location: "North", Capacity: 10}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			rdt, _ := m.BookingDB.Venue(1)
+			slots := rdt.ReadAvailable()[len(rdt.Parts()):]
+			for i := 0; i < 2; i++ {
+				if _, err := m.BookingDB.Reserve(1, slots[i], "user"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// the highest ids are deleted before the restart
+			if _, err := m.BookingDB.DelReserve(2); err != nil {
+				t.Fatal(err)
+			}
+			if _, _, err := m.DeleteVenue(2, true); err != nil {
+				t.Fatal(err)
+			}
+			if err := m.Store.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			m = reopen()
+			defer m.Store.Close()
+			if err := m.AddVenue(Venue{Name: "Three", Kind: "Hall", Location: "North", Capacity: 10}); err != nil {
+				t.Fatal(err)
+			}
+			if id, _ := m.VenueDB.getID("Three"); id != 3 {
+				t.Fatalf("venue added after the restart got id %d, want 3", id)
+			}
+			id, err := m.BookingDB.Reserve(1, slots[2], "user")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if id != 3 {
+				t.Fatalf("booking made after the restart got id %d, want 3", id)
+			}
+		})
+	}
+}
+
+func TestMemStoreCopies(t *testing.T) {
+	s := NewMemStore()
+	parts := []DayPart{{"Morning", 8 * time.Hour, 12 * time.Hour}}
+	attrs := map[string]float64{"area": 120}
+	s.PutVenue(1, Venue{Name: "Hall", DayParts: parts, Amenities: []string{"kitchen"}, Tags: []string{"quiet"}, Attrs: attrs, Media: []Media{{Key: "a.png"}}})
+	s.PutUser(User{Username: "ann", Bookings: []int{1}, Notices: []string{"hello"}})
+	tests := []struct {
+		name    string
+		change  func()
+		changed func() bool
+	}{
+		{"day parts put", func() { parts[0].Name = "Changed" }, func() bool {
+			venues, _ := s.Venues()
+			return venues[1].DayParts[0].Name != "Morning"
+		}},
+		{"day parts read", func() {
+			venues, _ := s.Venues()
+			venues[1].DayParts[0].Name = "Changed"
+		}, func() bool {
+			venues, _ := s.Venues()
+			return venues[1].DayParts[0].Name != "Morning"
+		}},
+		{"attributes put", func() { attrs["area"] = 1 }, func() bool {
+			venues, _ := s.Venues()
+			return venues[1].Attrs["area"] != 120
+		}},
+		{"attributes read", func() {
+			venues, _ := s.Venues()
+			venues[1].Attrs["area"] = 1
+		}, func() bool {
+			venues, _ := s.Venues()
+			return venues[1].Attrs["area"] != 120
+		}},
+		{"amenities and tags read", func() {
+			venues, _ := s.Venues()
+			venues[1].Amenities[0] = "changed"
+			venues[1].Tags[0] = "changed"
+		}, func() bool {
+			venues, _ := s.Venues()
+			return venues[1].Amenities[0] != "kitchen" || venues[1].Tags[0] != "quiet"
+		}},
+		{"media read", func() {
+			venues, _ := s.Venues()
+			venues[1].Media[0].Key = "changed"
+		}, func() bool {
+			venues, _ := s.Venues()
+			return venues[1].Media[0].Key != "a.png"
+		}},
+		{"user bookings read", func() {
+			u, _ := s.User("ann")
+			u.Bookings[0] = 2
+		}, func() bool {
+			u, _ := s.User("ann")
+			return u.Bookings[0] != 1
+		}},
+		{"user notices read", func() {
+			u, _ := s.User("ann")
+			u.Notices[0] = "changed"
+		}, func() bool {
+			u, _ := s.User("ann")
+			return u.Notices[0] != "hello"
+		}},
+	}
+	for _, tt := range tests {
+		tt.change()
+		if tt.changed() {
+			t.Errorf("%s: stored record changed without a put", tt.name)
+		}
+	}
+}
+
+func TestSweepTokens(t *testing.T) {
+	for name, open := range stores {
+		t.Run(name, func(t *testing.T) {
+			store, err := open(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer store.Close()
+			m, err := InitModel(store)
+			if err != nil {
+				t.Fatal(err)
+			}
+			old, err := m.UserDB.IssueTokens("ann", time.Minute, time.Hour)
+			if err != nil {
+				t.Fatal(err)
+			}
+			live, err := m.UserDB.IssueTokens("ann", time.Hour, 2*time.Hour)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// the old access token has expired, its refresh token has not
+			n, err := m.UserDB.SweepTokens(time.Now().Add(30 * time.Minute))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != 1 {
+				t.Fatalf("%d tokens swept, want 1", n)
+			}
+			if _, err := store.Token(hashToken(old.Access)); err == nil {
+				t.Fatal("expired access token kept")
+			}
+			for _, token := range []string{old.Refresh, live.Access, live.Refresh} {
+				if _, err := store.Token(hashToken(token)); err != nil {
+					t.Fatalf("live token swept, %v", err)
+				}
+			}
+		})
+	}
+}
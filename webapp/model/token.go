@@ -0,0 +1,174 @@
+package model
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+//ErrTokenInvalid : token is unknown, expired, revoked or of the wrong kind
+var ErrTokenInvalid = errors.New("invalid or expired token")
+
+// kinds of token
+const (
+	AccessToken  = "access"
+	RefreshToken = "refresh"
+)
+
+// Token : an issued bearer token. Tokens are random and only their hash
+// is stored, access and refresh tokens are issued and revoked in pairs
+type Token struct {
+	Hash     string
+	Username string
+	Kind     string
+	Expires  time.Time
+	Pair     string // hash of the other token of the pair
+}
+
+// TokenPair : tokens handed to a client, Expires is when Access expires
+type TokenPair struct {
+	Access  string
+	Refresh string
+	Expires time.Time
+}
+
+// hashToken : key a token is stored under
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// newToken : random url safe token
+func newToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+//IssueTokens : new access and refresh token for username
+func (uDB *userDB) IssueTokens(username string, accessTTL time.Duration, refreshTTL time.Duration) (TokenPair, error) {
+	access, err := newToken()
+	if err != nil {
+		return TokenPair{}, err
+	}
+	refresh, err := newToken()
+	if err != nil {
+		return TokenPair{}, err
+	}
+	now := time.Now()
+	a := Token{
+		Hash:     hashToken(access),
+		Username: username,
+		Kind:     AccessToken,
+		Expires:  now.Add(accessTTL),
+		Pair:     hashToken(refresh),
+	}
+	r := Token{
+		Hash:     a.Pair,
+		Username: username,
+		Kind:     RefreshToken,
+		Expires:  now.Add(refreshTTL),
+		Pair:     a.Hash,
+	}
+	if err := uDB.store.PutToken(a); err != nil {
+		return TokenPair{}, err
+	}
+	if err := uDB.store.PutToken(r); err != nil {
+		uDB.store.DeleteToken(a.Hash)
+		return TokenPair{}, err
+	}
+	return TokenPair{Access: access, Refresh: refresh, Expires: a.Expires}, nil
+}
+
+// lookup : stored token of kind, expired tokens are deleted
+func (uDB *userDB) lookup(token string, kind string) (Token, error) {
+	t, err := uDB.store.Token(hashToken(token))
+	if err != nil {
+		return Token{}, err
+	}
+	if time.Now().After(t.Expires) {
+		uDB.store.DeleteToken(t.Hash)
+		return Token{}, ErrTokenInvalid
+	}
+	if t.Kind != kind {
+		return Token{}, ErrTokenInvalid
+	}
+	return t, nil
+}
+
+//Authenticate : username an access token was issued to
+func (uDB *userDB) Authenticate(access string) (string, error) {
+	t, err := uDB.lookup(access, AccessToken)
+	if err != nil {
+		return "", err
+	}
+	return t.Username, nil
+}
+
+//Refresh : swap a refresh token for a new pair, the old pair is revoked
+func (uDB *userDB) Refresh(refresh string, accessTTL time.Duration, refreshTTL time.Duration) (TokenPair, error) {
+	uDB.mu.Lock()
+	defer uDB.mu.Unlock()
+	t, err := uDB.lookup(refresh, RefreshToken)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	if err := uDB.revoke(t); err != nil {
+		return TokenPair{}, err
+	}
+	return uDB.IssueTokens(t.Username, accessTTL, refreshTTL)
+}
+
+//Revoke : revoke token, access or refresh, together with its pair
+func (uDB *userDB) Revoke(token string) error {
+	t, err := uDB.store.Token(hashToken(token))
+	if err != nil {
+		return err
+	}
+	return uDB.revoke(t)
+}
+
+//RevokeTokens : revoke every token issued to username, the number revoked
+func (uDB *userDB) RevokeTokens(username string) (int, error) {
+	return uDB.deleteTokens(func(t Token) bool {
+		return t.Username == username
+	})
+}
+
+//SweepTokens : delete every token expired at now, the number deleted.
+//Tokens that are never presented again would otherwise be kept forever
+func (uDB *userDB) SweepTokens(now time.Time) (int, error) {
+	return uDB.deleteTokens(func(t Token) bool {
+		return now.After(t.Expires)
+	})
+}
+
+func (uDB *userDB) deleteTokens(match func(t Token) bool) (int, error) {
+	tokens, err := uDB.store.Tokens()
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for hash, t := range tokens {
+		if !match(t) {
+			continue
+		}
+		if err := uDB.store.DeleteToken(hash); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+func (uDB *userDB) revoke(t Token) error {
+	if err := uDB.store.DeleteToken(t.Pair); err != nil {
+		return err
+	}
+	return uDB.store.DeleteToken(t.Hash)
+}
@@ -0,0 +1,64 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokens(t *testing.T) {
+	m, err := InitModel(NewMemStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	uDB := m.UserDB
+	first, err := uDB.IssueTokens("ann", time.Hour, 2*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, err := uDB.IssueTokens("ann", -time.Minute, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	revoked, err := uDB.IssueTokens("ann", time.Hour, 2*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := uDB.Revoke(revoked.Refresh); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{"access token", first.Access, nil},
+		{"refresh token as access", first.Refresh, ErrTokenInvalid},
+		{"unknown token", "not-a-token", ErrTokenInvalid},
+		{"expired access token", expired.Access, ErrTokenInvalid},
+		{"access token of a revoked pair", revoked.Access, ErrTokenInvalid},
+	}
+	for _, tt := range tests {
+		username, err := uDB.Authenticate(tt.token)
+		if err != tt.want || (err == nil && username != "ann") {
+			t.Errorf("%s: Authenticate gave %q, %v, want ann, %v", tt.name, username, err, tt.want)
+		}
+	}
+
+	next, err := uDB.Refresh(first.Refresh, time.Hour, 2*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := uDB.Authenticate(next.Access); err != nil {
+		t.Fatalf("refreshed access token refused, %v", err)
+	}
+	// the swapped pair is gone, so a stolen refresh token is used only once
+	if _, err := uDB.Authenticate(first.Access); err != ErrTokenInvalid {
+		t.Fatalf("access token of a refreshed pair gave %v, want ErrTokenInvalid", err)
+	}
+	if _, err := uDB.Refresh(first.Refresh, time.Hour, 2*time.Hour); err != ErrTokenInvalid {
+		t.Fatalf("refresh token used twice gave %v, want ErrTokenInvalid", err)
+	}
+	if _, err := uDB.Refresh(next.Access, time.Hour, 2*time.Hour); err != ErrTokenInvalid {
+		t.Fatalf("access token refreshed with %v, want ErrTokenInvalid", err)
+	}
+}
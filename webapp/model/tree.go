@@ -1,66 +1,91 @@
 package model
 
-import "fmt"
+import (
+	"cmp"
+	"errors"
+	"fmt"
+)
+
+//ErrDuplicateKey : key added is already in the tree
+var ErrDuplicateKey = errors.New("key already in tree")
 
 // The keys in a binary search tree are always sorted.
+// Tree is an ordered map kept height balanced (AVL), so keys inserted in
+// ascending order by ReserveDT.init do not degrade it into a list.
 
 // Tree struct
-type Tree struct {
-	root *Node // May contain multiple same value keys
+type Tree[K cmp.Ordered, V any] struct {
+	root *Node[K, V] // Keys are unique, Put replaces the value of an existing key, Add refuses it
+	size int
 }
 
 // Node Struct
-type Node struct {
+type Node[K cmp.Ordered, V any] struct {
 	// for any node x
 	// if y is left child of x then y.key < x.key
 	// if y is right child of x then y.key > x.key
-	key    int
-	parent *Node
-	left   *Node
-	right  *Node
-	bookID int
+	key    K
+	value  V
+	parent *Node[K, V]
+	left   *Node[K, V]
+	right  *Node[K, V]
+	height int // height of subtree rooted at node, leaf is 1
 }
 
-// newNode: create a new node from key, with satellite data
-func newNodeA(key int, bookID int) *Node {
-	n := Node{
-		key: key,
+// newNode: create a new node from key, with its value
+func newNode[K cmp.Ordered, V any](key K, value V) *Node[K, V] {
+	n := Node[K, V]{
+		key:    key,
+		value:  value,
+		height: 1,
 	}
 	return &n
 }
 
-// AddA key to tree, with satellite data
-func (t *Tree) AddA(key int, bookID int) {
-	n := newNodeA(key, bookID)
-	t.insert(n)
+// Put key with value into tree, replacing the value if key exists
+func (t *Tree[K, V]) Put(key K, value V) {
+	if n := t.root.find(key); n != nil {
+		n.value = value
+		return
+	}
+	t.insert(newNode(key, value))
+}
+
+// Add key with value into tree, ErrDuplicateKey if key exists so a value
+// held for it is never lost
+func (t *Tree[K, V]) Add(key K, value V) error {
+	return t.insert(newNode(key, value))
 }
 
-func newNode(key int) *Node {
-	n := Node{
-		key: key,
+// Get value stored for key, ok if found
+func (t *Tree[K, V]) Get(key K) (V, bool) {
+	n := t.root.find(key)
+	if n == nil {
+		var zero V
+		return zero, false
 	}
-	return &n
+	return n.value, true
 }
 
-// Add key to tree, no satellite data
-func (t *Tree) Add(key int) {
-	n := newNode(key)
-	t.insert(n)
+// Has : true if key is in tree
+func (t *Tree[K, V]) Has(key K) bool {
+	return t.root.find(key) != nil
 }
 
-// insert node n into t
-func (t *Tree) insert(new *Node) {
+// insert node n into t, ErrDuplicateKey if n.key is already present
+func (t *Tree[K, V]) insert(new *Node[K, V]) error {
 	if t.root == nil {
 		t.root = new
-		return
+		t.size++
+		return nil
 	}
 	// find position
-	var p *Node = nil
+	var p *Node[K, V] = nil
 	n := t.root
 	for n != nil {
 		p = n
 		if new.key == n.key {
-			return
+			return ErrDuplicateKey
 		} else if new.key < n.key {
 			n = n.left
 		} else {
@@ -74,27 +99,37 @@ func (t *Tree) insert(new *Node) {
 		p.right = new
 	}
 	new.parent = p
+	t.size++
+	t.rebalance(p)
+	return nil
 }
 
 // Delete node with key from tree
 // true if deleted
-func (t *Tree) Delete(key int) bool {
+func (t *Tree[K, V]) Delete(key K) bool {
 	n := t.root.find(key)
 	if n == nil {
 		return false
 	}
 	t.delete(n)
+	t.size--
 	return true
 }
 
-func (t *Tree) delete(d *Node) {
+func (t *Tree[K, V]) delete(d *Node[K, V]) {
+	// lowest node whose subtree changed, rebalance from there up
+	var from *Node[K, V]
 	if d.left == nil {
+		from = d.parent
 		t.transplant(d, d.right)
 	} else if d.right == nil {
+		from = d.parent
 		t.transplant(d, d.left)
 	} else {
 		n := d.right.min()
+		from = n
 		if n.parent != d {
+			from = n.parent
 			t.transplant(n, n.right)
 			n.right = d.right
 			n.right.parent = n
@@ -103,9 +138,10 @@ func (t *Tree) delete(d *Node) {
 		n.left = d.left
 		n.left.parent = n
 	}
+	t.rebalance(from)
 }
 
-func (t *Tree) transplant(u, v *Node) {
+func (t *Tree[K, V]) transplant(u, v *Node[K, V]) {
 	if u.parent == nil {
 		t.root = v
 	} else if u == u.parent.left {
@@ -118,31 +154,98 @@ func (t *Tree) transplant(u, v *Node) {
 	}
 }
 
+// rebalance: walk from n up to the root, fixing heights and
+// rotating any node whose subtrees differ in height by more than 1
+func (t *Tree[K, V]) rebalance(n *Node[K, V]) {
+	for n != nil {
+		n.update()
+		switch bf := n.balance(); {
+		case bf > 1:
+			if n.left.balance() < 0 {
+				t.rotateLeft(n.left)
+			}
+			n = t.rotateRight(n)
+		case bf < -1:
+			if n.right.balance() > 0 {
+				t.rotateRight(n.right)
+			}
+			n = t.rotateLeft(n)
+		}
+		n = n.parent
+	}
+}
+
+// rotateLeft: x's right child takes its place, returns the new subtree root
+func (t *Tree[K, V]) rotateLeft(x *Node[K, V]) *Node[K, V] {
+	y := x.right
+	x.right = y.left
+	if y.left != nil {
+		y.left.parent = x
+	}
+	t.transplant(x, y)
+	y.left = x
+	x.parent = y
+	x.update()
+	y.update()
+	return y
+}
+
+// rotateRight: x's left child takes its place, returns the new subtree root
+func (t *Tree[K, V]) rotateRight(x *Node[K, V]) *Node[K, V] {
+	y := x.left
+	x.left = y.right
+	if y.right != nil {
+		y.right.parent = x
+	}
+	t.transplant(x, y)
+	y.right = x
+	x.parent = y
+	x.update()
+	y.update()
+	return y
+}
+
+// height of subtree rooted at n, 0 for an empty subtree
+func (n *Node[K, V]) getHeight() int {
+	if n == nil {
+		return 0
+	}
+	return n.height
+}
+
+// update: recompute height of n from its children
+func (n *Node[K, V]) update() {
+	n.height = max(n.left.getHeight(), n.right.getHeight()) + 1
+}
+
+// balance factor of n, positive when left subtree is taller
+func (n *Node[K, V]) balance() int {
+	return n.left.getHeight() - n.right.getHeight()
+}
+
 // Flatten : return inorder slice of keys
-func (t *Tree) Flatten() []int {
-	var keys []int
-	fn := func(n *Node) {
+func (t *Tree[K, V]) Flatten() []K {
+	keys := make([]K, 0, t.size)
+	fn := func(n *Node[K, V]) {
 		keys = append(keys, n.key)
 	}
 	t.root.inorder(fn)
 	return keys
 }
 
-// FlattenA : return inorder slice of keys and bookID
-func (t *Tree) FlattenA() ([]int, []int) {
-	var keys []int
-	var bookids []int
-	fn := func(n *Node) {
-		keys = append(keys, n.key)
-		bookids = append(bookids, n.bookID)
+// Values : return values in key order
+func (t *Tree[K, V]) Values() []V {
+	values := make([]V, 0, t.size)
+	fn := func(n *Node[K, V]) {
+		values = append(values, n.value)
 	}
 	t.root.inorder(fn)
-	return keys, bookids
+	return values
 }
 
 //recursive function
 // Walk tree in order calling fn for each node
-func (n *Node) inorder(fn func(n *Node)) {
+func (n *Node[K, V]) inorder(fn func(n *Node[K, V])) {
 	if n != nil {
 		n.left.inorder(fn)
 		fn(n)
@@ -151,16 +254,17 @@ func (n *Node) inorder(fn func(n *Node)) {
 }
 
 // Max : return maximum key from tree
-func (t *Tree) Max() (int, error) {
+func (t *Tree[K, V]) Max() (K, error) {
 	if t.root == nil {
-		return 0, fmt.Errorf("Max() called on empty tree")
+		var zero K
+		return zero, fmt.Errorf("Max() called on empty tree")
 	}
 	n := t.root.max()
 	return n.key, nil
 }
 
 // max: find node with maximum key from tree rooted at n
-func (n *Node) max() *Node {
+func (n *Node[K, V]) max() *Node[K, V] {
 	for n.right != nil {
 		n = n.right
 	}
@@ -168,38 +272,143 @@ func (n *Node) max() *Node {
 }
 
 // Min : return minimum key from tree
-func (t *Tree) Min() (int, error) {
+func (t *Tree[K, V]) Min() (K, error) {
 	if t.root == nil {
-		return 0, fmt.Errorf("Min() called on empty tree")
+		var zero K
+		return zero, fmt.Errorf("Min() called on empty tree")
 	}
 	n := t.root.min()
 	return n.key, nil
 }
 
 // min: find node with minimum key from tree rooted at n
-func (n *Node) min() *Node {
+func (n *Node[K, V]) min() *Node[K, V] {
 	for n.left != nil {
 		n = n.left
 	}
 	return n
 }
 
+// Floor : find largest key value smaller than or equal to key
+// ok if found
+func (t *Tree[K, V]) Floor(key K) (K, bool) {
+	n := t.root.floor(key)
+	if n == nil {
+		var zero K
+		return zero, false
+	}
+	return n.key, true
+}
+
+// floor: return node with largest key <= key in tree rooted at n
+func (n *Node[K, V]) floor(key K) *Node[K, V] {
+	var best *Node[K, V]
+	for n != nil {
+		if key == n.key {
+			return n
+		} else if key < n.key {
+			n = n.left
+		} else {
+			best = n
+			n = n.right
+		}
+	}
+	return best
+}
+
+// Ceiling : find smallest key value larger than or equal to key
+// ok if found
+func (t *Tree[K, V]) Ceiling(key K) (K, bool) {
+	n := t.root.ceiling(key)
+	if n == nil {
+		var zero K
+		return zero, false
+	}
+	return n.key, true
+}
+
+// ceiling: return node with smallest key >= key in tree rooted at n
+func (n *Node[K, V]) ceiling(key K) *Node[K, V] {
+	var best *Node[K, V]
+	for n != nil {
+		if key == n.key {
+			return n
+		} else if key < n.key {
+			best = n
+			n = n.left
+		} else {
+			n = n.right
+		}
+	}
+	return best
+}
+
+// Range : return inorder slice of keys between lo and hi inclusive
+func (t *Tree[K, V]) Range(lo K, hi K) []K {
+	var keys []K
+	for it := t.Seek(lo); it.Valid() && it.Key() <= hi; it.Next() {
+		keys = append(keys, it.Key())
+	}
+	return keys
+}
+
+// Iterator : lazy in order walk over a tree, only the nodes visited are touched.
+// Loop with Valid/Next and break out early once past the wanted keys.
+// The tree must not be modified while iterating.
+type Iterator[K cmp.Ordered, V any] struct {
+	n *Node[K, V]
+}
+
+// Iter : iterator positioned at the minimum key
+func (t *Tree[K, V]) Iter() *Iterator[K, V] {
+	if t.root == nil {
+		return &Iterator[K, V]{}
+	}
+	return &Iterator[K, V]{n: t.root.min()}
+}
+
+// Seek : iterator positioned at the smallest key >= key
+func (t *Tree[K, V]) Seek(key K) *Iterator[K, V] {
+	return &Iterator[K, V]{n: t.root.ceiling(key)}
+}
+
+// Valid : false once the iterator has moved past the last key
+func (it *Iterator[K, V]) Valid() bool {
+	return it.n != nil
+}
+
+// Next : advance to the next larger key
+func (it *Iterator[K, V]) Next() {
+	it.n = it.n.successor()
+}
+
+// Key : current key
+func (it *Iterator[K, V]) Key() K {
+	return it.n.key
+}
+
+// Value : value stored for current key
+func (it *Iterator[K, V]) Value() V {
+	return it.n.value
+}
+
 // Successor : find smallest key value larger than key
 // panic if key not present, ok if found
-func (t *Tree) Successor(key int) (int, bool) {
+func (t *Tree[K, V]) Successor(key K) (K, bool) {
 	n := t.root.find(key)
 	if n == nil {
 		panic("Succesor() called with non-existant key")
 	}
 	next := n.successor()
 	if next == nil {
-		return 0, false
+		var zero K
+		return zero, false
 	}
 	return next.key, true
 }
 
 // find node by key
-func (n *Node) find(key int) *Node {
+func (n *Node[K, V]) find(key K) *Node[K, V] {
 	for n != nil && key != n.key {
 		if key < n.key {
 			n = n.left
@@ -211,7 +420,7 @@ func (n *Node) find(key int) *Node {
 }
 
 // successor: return node with smallest key larger than n.key
-func (n *Node) successor() *Node {
+func (n *Node[K, V]) successor() *Node[K, V] {
 	if n.right != nil {
 		return n.right.min()
 	}
@@ -225,20 +434,21 @@ func (n *Node) successor() *Node {
 
 // Predecessor : find largest key value smaller than key
 // panic if key not present, ok if found
-func (t *Tree) Predecessor(key int) (int, bool) {
+func (t *Tree[K, V]) Predecessor(key K) (K, bool) {
 	n := t.root.find(key)
 	if n == nil {
 		panic("Predecessor() called with non-existant key")
 	}
 	prev := n.predecessor()
 	if prev == nil {
-		return 0, false
+		var zero K
+		return zero, false
 	}
 	return prev.key, true
 }
 
 // predecessor: return node with largest key smaller than n.key
-func (n *Node) predecessor() *Node {
+func (n *Node[K, V]) predecessor() *Node[K, V] {
 	if n.left != nil {
 		return n.left.max()
 	}
@@ -251,28 +461,6 @@ func (n *Node) predecessor() *Node {
 }
 
 // Size of tree
-func (t *Tree) Size() int {
-	if t.root == nil {
-		return 0
-	}
-	return t.root.size()
-}
-
-// size of tree rooted at node n
-func (n *Node) size() int {
-	total := 0
-	fn := func(n *Node) {
-		if n != nil {
-			total++
-		}
-	}
-	n.inorder(fn)
-	return total
-}
-
-func max(a, b int) int {
-	if a > b {
-		return a
-	}
-	return b
+func (t *Tree[K, V]) Size() int {
+	return t.size
 }
@@ -0,0 +1,298 @@
+package model
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// bst : the unbalanced binary search tree Tree replaced, kept to compare
+// against. Keys inserted in order turn it into a list
+type bst struct {
+	root *bstNode
+}
+
+type bstNode struct {
+	key   int
+	left  *bstNode
+	right *bstNode
+}
+
+func (t *bst) put(key int) {
+	p := &t.root
+	for *p != nil {
+		if key == (*p).key {
+			return
+		} else if key < (*p).key {
+			p = &(*p).left
+		} else {
+			p = &(*p).right
+		}
+	}
+	*p = &bstNode{key: key}
+}
+
+func (t *bst) has(key int) bool {
+	n := t.root
+	for n != nil && key != n.key {
+		if key < n.key {
+			n = n.left
+		} else {
+			n = n.right
+		}
+	}
+	return n != nil
+}
+
+// checkNode : height of the subtree at n, failing t if its keys are out
+// of order, a height is stale, a parent link is wrong or it is unbalanced
+func checkNode(t *testing.T, n *Node[int, int], lo int, hi int) int {
+	t.Helper()
+	if n == nil {
+		return 0
+	}
+	if n.key < lo || n.key > hi {
+		t.Fatalf("key %d outside [%d, %d]", n.key, lo, hi)
+	}
+	for _, c := range []*Node[int, int]{n.left, n.right} {
+		if c != nil && c.parent != n {
+			t.Fatalf("child %d of %d has the wrong parent", c.key, n.key)
+		}
+	}
+	l := checkNode(t, n.left, lo, n.key-1)
+	r := checkNode(t, n.right, n.key+1, hi)
+	if l-r > 1 || r-l > 1 {
+		t.Fatalf("node %d unbalanced, left height %d, right height %d", n.key, l, r)
+	}
+	if n.height != max(l, r)+1 {
+		t.Fatalf("node %d has height %d, want %d", n.key, n.height, max(l, r)+1)
+	}
+	return n.height
+}
+
+func checkTree(t *testing.T, tree *Tree[int, int], want map[int]int) {
+	t.Helper()
+	if tree.root != nil && tree.root.parent != nil {
+		t.Fatal("root has a parent")
+	}
+	checkNode(t, tree.root, -1<<31, 1<<31)
+	if tree.Size() != len(want) {
+		t.Fatalf("size %d, want %d", tree.Size(), len(want))
+	}
+	for k, v := range want {
+		if got, ok := tree.Get(k); !ok || got != v {
+			t.Fatalf("Get(%d) = %d, %v, want %d", k, got, ok, v)
+		}
+	}
+}
+
+func TestTreeBalanced(t *testing.T) {
+	tree := &Tree[int, int]{}
+	want := make(map[int]int)
+	// ascending keys, as ReserveDT adds slots, then random ones
+	for k := 0; k < 1000; k++ {
+		tree.Put(k, k)
+		want[k] = k
+	}
+	checkTree(t, tree, want)
+	if h := tree.root.getHeight(); h > 15 {
+		t.Fatalf("height %d for 1000 ascending keys", h)
+	}
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 5000; i++ {
+		k := r.Intn(3000)
+		if r.Intn(3) == 0 {
+			tree.Delete(k)
+			delete(want, k)
+		} else {
+			tree.Put(k, i)
+			want[k] = i
+		}
+		if i%250 == 0 {
+			checkTree(t, tree, want)
+		}
+	}
+	checkTree(t, tree, want)
+	for k := range want {
+		tree.Delete(k)
+	}
+	checkTree(t, tree, map[int]int{})
+}
+
+func TestTreeAdd(t *testing.T) {
+	tree := &Tree[int, int]{}
+	if err := tree.Add(5, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := tree.Add(5, 2); err != ErrDuplicateKey {
+		t.Fatalf("Add of an existing key gave %v, want ErrDuplicateKey", err)
+	}
+	if v, _ := tree.Get(5); v != 1 || tree.Size() != 1 {
+		t.Fatalf("Add of an existing key changed the tree, value %d, size %d", v, tree.Size())
+	}
+	tree.Put(5, 3)
+	if v, _ := tree.Get(5); v != 3 || tree.Size() != 1 {
+		t.Fatalf("Put of an existing key gave value %d, size %d", v, tree.Size())
+	}
+}
+
+// benchKeys : keys put in ascending order, looked up spread across them
+const benchKeys = 2000
+
+func BenchmarkInsert(b *testing.B) {
+	b.Run("avl", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			tree := &Tree[int, int]{}
+			for k := 0; k < benchKeys; k++ {
+				tree.Put(k, k)
+			}
+		}
+	})
+	b.Run("bst", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			tree := &bst{}
+			for k := 0; k < benchKeys; k++ {
+				tree.put(k)
+			}
+		}
+	})
+}
+
+func BenchmarkGet(b *testing.B) {
+	b.Run("avl", func(b *testing.B) {
+		tree := &Tree[int, int]{}
+		for k := 0; k < benchKeys; k++ {
+			tree.Put(k, k)
+		}
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			tree.Get(i * 7919 % benchKeys)
+		}
+	})
+	b.Run("bst", func(b *testing.B) {
+		tree := &bst{}
+		for k := 0; k < benchKeys; k++ {
+			tree.put(k)
+		}
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			tree.has(i * 7919 % benchKeys)
+		}
+	})
+}
+
+func TestTreeRangeQueries(t *testing.T) {
+	tree := &Tree[int, bool]{}
+	for _, k := range []int{10, 20, 30, 40, 50} {
+		tree.Put(k, true)
+	}
+	tests := []struct {
+		key       int
+		floor     int
+		floorOK   bool
+		ceiling   int
+		ceilingOK bool
+	}{
+		{key: 5, ceiling: 10, ceilingOK: true},
+		{key: 10, floor: 10, floorOK: true, ceiling: 10, ceilingOK: true},
+		{key: 25, floor: 20, floorOK: true, ceiling: 30, ceilingOK: true},
+		{key: 50, floor: 50, floorOK: true, ceiling: 50, ceilingOK: true},
+		{key: 55, floor: 50, floorOK: true},
+	}
+	for _, tt := range tests {
+		if k, ok := tree.Floor(tt.key); k != tt.floor || ok != tt.floorOK {
+			t.Errorf("Floor(%d) = %d, %v, want %d, %v", tt.key, k, ok, tt.floor, tt.floorOK)
+		}
+		if k, ok := tree.Ceiling(tt.key); k != tt.ceiling || ok != tt.ceilingOK {
+			t.Errorf("Ceiling(%d) = %d, %v, want %d, %v", tt.key, k, ok, tt.ceiling, tt.ceilingOK)
+		}
+	}
+
+	ranges := []struct {
+		lo, hi int
+		want   []int
+	}{
+		{0, 100, []int{10, 20, 30, 40, 50}},
+		{20, 40, []int{20, 30, 40}},
+		{21, 39, []int{30}},
+		{31, 39, nil},
+		{60, 70, nil},
+		{40, 20, nil},
+	}
+	for _, tt := range ranges {
+		got := tree.Range(tt.lo, tt.hi)
+		if len(got) != len(tt.want) {
+			t.Errorf("Range(%d, %d) = %v, want %v", tt.lo, tt.hi, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("Range(%d, %d) = %v, want %v", tt.lo, tt.hi, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestTreeIter(t *testing.T) {
+	tree := &Tree[int, bool]{}
+	if tree.Iter().Valid() {
+		t.Fatal("iterator over an empty tree is valid")
+	}
+	for k := 1; k <= 5; k++ {
+		tree.Put(k*10, true)
+	}
+	var keys []int
+	for it := tree.Iter(); it.Valid(); it.Next() {
+		keys = append(keys, it.Key())
+	}
+	if len(keys) != 5 || keys[0] != 10 || keys[4] != 50 {
+		t.Fatalf("Iter walked %v, want 10 to 50", keys)
+	}
+	// stopping early leaves the rest of the tree unvisited
+	it := tree.Seek(25)
+	if !it.Valid() || it.Key() != 30 {
+		t.Fatal("Seek(25) not at 30")
+	}
+	it.Next()
+	if it.Key() != 40 {
+		t.Fatalf("Next after 30 is %d, want 40", it.Key())
+	}
+	if tree.Seek(51).Valid() {
+		t.Fatal("Seek past the last key is valid")
+	}
+}
+
+func TestTreeOrderedMap(t *testing.T) {
+	tree := &Tree[string, int]{}
+	for i, k := range []string{"pear", "apple", "fig", "kiwi"} {
+		tree.Put(k, i)
+	}
+	tests := []struct {
+		key   string
+		value int
+		ok    bool
+	}{
+		{"pear", 0, true},
+		{"apple", 1, true},
+		{"kiwi", 3, true},
+		{"plum", 0, false},
+	}
+	for _, tt := range tests {
+		if v, ok := tree.Get(tt.key); v != tt.value || ok != tt.ok {
+			t.Errorf("Get(%q) = %d, %v, want %d, %v", tt.key, v, ok, tt.value, tt.ok)
+		}
+		if tree.Has(tt.key) != tt.ok {
+			t.Errorf("Has(%q) = %v, want %v", tt.key, !tt.ok, tt.ok)
+		}
+	}
+	keys, values := tree.Flatten(), tree.Values()
+	want := []string{"apple", "fig", "kiwi", "pear"}
+	for i := range want {
+		if keys[i] != want[i] {
+			t.Fatalf("Flatten() = %v, want %v", keys, want)
+		}
+		if v, _ := tree.Get(keys[i]); values[i] != v {
+			t.Fatalf("Values() = %v, not in key order", values)
+		}
+	}
+}
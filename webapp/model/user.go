@@ -0,0 +1,123 @@
+package model
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/microcosm-cc/bluemonday"
+)
+
+// User : User object
+type User struct {
+	Username string
+	Password []byte
+	First    string
+	Last     string
+	Email    string
+	Verified bool // Email is known to be theirs
+	Bookings []int
+	Role     Role     // empty for users saved before roles, see GetRole
+	VIP      bool     // served first on waitlists
+	Notices  []string // shown once on the view bookings page
+	FeedKey  string   // calendar feed links are bound to, see ResetFeed
+
+	FailedLogins int       // in a row, see Lockout
+	LockedUntil  time.Time // no logins before this
+}
+
+// namePolicy : html left in names, only what is safe to show
+var namePolicy = bluemonday.UGCPolicy()
+
+//SetName : set the first and last name of u, stripped of unsafe html.
+//A nil name is left as it is
+func (u *User) SetName(first *string, last *string) {
+	if first != nil {
+		u.First = namePolicy.Sanitize(*first)
+	}
+	if last != nil {
+		u.Last = namePolicy.Sanitize(*last)
+	}
+}
+
+// userDB : users and login sessions, kept in the store.
+// mu makes check then write of a user one step
+type userDB struct {
+	mu    sync.Mutex
+	store Store
+}
+
+//Get : user with username
+func (uDB *userDB) Get(username string) (User, error) {
+	return uDB.store.User(username)
+}
+
+//Add : store new user u, ErrUserExists if username is taken
+func (uDB *userDB) Add(u User) error {
+	uDB.mu.Lock()
+	defer uDB.mu.Unlock()
+	_, err := uDB.store.User(u.Username)
+	if err == nil {
+		return ErrUserExists
+	}
+	if err != ErrUserNotFound {
+		return err
+	}
+	return uDB.store.PutUser(u)
+}
+
+//Update : apply fn to the stored user in one step, so concurrent
+//edits of the same user are not lost
+func (uDB *userDB) Update(username string, fn func(u *User)) (User, error) {
+	uDB.mu.Lock()
+	defer uDB.mu.Unlock()
+	u, err := uDB.store.User(username)
+	if err != nil {
+		return u, err
+	}
+	fn(&u)
+	return u, uDB.store.PutUser(u)
+}
+
+//List : every user, by username
+func (uDB *userDB) List() ([]User, error) {
+	users, err := uDB.store.Users()
+	if err != nil {
+		return nil, err
+	}
+	list := make([]User, 0, len(users))
+	for _, u := range users {
+		list = append(list, u)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Username < list[j].Username
+	})
+	return list, nil
+}
+
+//ByEmail : every user with email, which need not be unique
+func (uDB *userDB) ByEmail(email string) ([]User, error) {
+	users, err := uDB.List()
+	if err != nil {
+		return nil, err
+	}
+	var found []User
+	for _, u := range users {
+		if u.Email != "" && strings.EqualFold(u.Email, email) {
+			found = append(found, u)
+		}
+	}
+	return found, nil
+}
+
+//SetRole : give username role
+func (uDB *userDB) SetRole(username string, role Role) error {
+	if _, err := ParseRole(string(role)); err != nil {
+		return err
+	}
+	_, err := uDB.Update(username, func(u *User) {
+		u.Role = role
+	})
+	return err
+}
@@ -0,0 +1,214 @@
+package model
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+var (
+	//ErrVenueExists : another venue already has the name
+	ErrVenueExists = errors.New("venue name already taken")
+	//ErrVenueHasBookings : venue cannot be deleted while bookings of it are still to come
+	ErrVenueHasBookings = errors.New("venue has bookings still to come")
+)
+
+// removeMap : take id out of the ids of s, s goes once it has none
+func (vDB *venueDB) removeMap(m map[string][]int, s string, id int) {
+	ids := m[s]
+	for i, v := range ids {
+		if v == id {
+			ids = append(ids[:i:i], ids[i+1:]...)
+			break
+		}
+	}
+	if len(ids) == 0 {
+		delete(m, s)
+		return
+	}
+	m[s] = ids
+}
+
+// unindex : undo put of v under id, vDB.mu must be held
+func (vDB *venueDB) unindex(id int, v Venue) {
+	delete(vDB.Venues, id)
+	delete(vDB.VenueMap, id)
+	if v.Archived {
+		return
+	}
+	vDB.removeMap(vDB.kindMap, v.Kind, id)
+	vDB.removeMap(vDB.locationMap, v.Location, id)
+	if ids, exists := vDB.capacityTree.Get(v.Capacity); exists {
+		delete(ids, id)
+		if len(ids) == 0 {
+			vDB.capacityTree.Delete(v.Capacity)
+		}
+	}
+	vDB.unindexFeatures(id, v)
+	vDB.text.remove(id)
+}
+
+//Update : apply fn to venue id in one step, moving it in the indexes.
+//Fails with ErrVenueNotFound, ErrVenueExists if fn renames it to the
+//name of another venue, or an error of features it does not know
+func (vDB *venueDB) Update(id int, fn func(v *Venue)) (Venue, error) {
+	vDB.mu.Lock()
+	defer vDB.mu.Unlock()
+	old, exists := vDB.Venues[id]
+	if !exists {
+		return Venue{}, ErrVenueNotFound
+	}
+	v := old
+	fn(&v)
+	v, err := features(v)
+	if err != nil {
+		return old, err
+	}
+	if other, taken := vDB.getID(v.Name); taken && other != id {
+		return old, ErrVenueExists
+	}
+	if err := vDB.store.PutVenue(id, v); err != nil {
+		return old, err
+	}
+	vDB.unindex(id, old)
+	vDB.put(id, v)
+	return v, nil
+}
+
+//Delete : remove venue id, see Model.DeleteVenue for its bookings
+func (vDB *venueDB) Delete(id int) error {
+	vDB.mu.Lock()
+	defer vDB.mu.Unlock()
+	v, exists := vDB.Venues[id]
+	if !exists {
+		return ErrVenueNotFound
+	}
+	if err := vDB.store.DeleteVenue(id); err != nil {
+		return err
+	}
+	vDB.unindex(id, v)
+	return nil
+}
+
+//Active : copy of every venue not archived, by id
+func (vDB *venueDB) Active() map[int]Venue {
+	vDB.mu.RLock()
+	defer vDB.mu.RUnlock()
+	venues := make(map[int]Venue, len(vDB.Venues))
+	for k, v := range vDB.Venues {
+		if !v.Archived {
+			venues[k] = v
+		}
+	}
+	return venues
+}
+
+// close : stop or start taking bookings and waiters
+func (rdt *ReserveDT) close(closed bool) {
+	rdt.mu.Lock()
+	defer rdt.mu.Unlock()
+	rdt.closed = closed
+}
+
+// deleteVenue : remove every booking of venue id, releasing its slots as
+// each goes. Unless cancel is true nothing is removed if any of them ends
+// after now. Bookings removed before an error are returned with it
+func (b *bookingDB) deleteVenue(id int, cancel bool, now time.Time) ([]Booking, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var removed []*Booking
+	for _, booking := range b.Bookings {
+		if booking.VenueID != id {
+			continue
+		}
+		if !cancel && booking.Slot.End.After(now) {
+			return nil, ErrVenueHasBookings
+		}
+		removed = append(removed, booking)
+	}
+	sort.Slice(removed, func(i, j int) bool {
+		return removed[i].Slot.Start.Before(removed[j].Slot.Start)
+	})
+	rdt := b.VenueReserve[id]
+	var done []Booking
+	for _, booking := range removed {
+		if err := b.store.DeleteBooking(booking.IDBook); err != nil {
+			return done, err
+		}
+		delete(b.Bookings, booking.IDBook)
+		if rdt != nil {
+			rdt.delReserve(booking, nil)
+		}
+		done = append(done, *booking)
+	}
+	return done, nil
+}
+
+// lost : places in before that are no longer in after and are for slots
+// still to come at now
+func lost(before []Waiting, after []Waiting, now time.Time) []Waiting {
+	type place struct {
+		user string
+		key  int64
+	}
+	left := make(map[place]bool, len(after))
+	for _, w := range after {
+		left[place{w.User, w.Slot.Key()}] = true
+	}
+	var gone []Waiting
+	for _, w := range before {
+		if !left[place{w.User, w.Slot.Key()}] && w.Slot.End.After(now) {
+			gone = append(gone, w)
+		}
+	}
+	return gone
+}
+
+//ArchiveVenue : hide venue id from searches and close it to new bookings,
+//or open it again if archived is false. Its bookings stand either way
+func (m *Model) ArchiveVenue(id int, archived bool) error {
+	if _, err := m.VenueDB.Update(id, func(v *Venue) {
+		v.Archived = archived
+	}); err != nil {
+		return err
+	}
+	if rdt, exists := m.BookingDB.Venue(id); exists {
+		rdt.close(archived)
+	}
+	return nil
+}
+
+//DeleteVenue : remove venue id and every booking of it, returning the
+//bookings removed and the waitlist places for slots still to come that
+//went with them. While any booking is still to come it fails with
+//ErrVenueHasBookings, unless cancel is true. On any other error the venue
+//is opened again, less what was removed before it
+func (m *Model) DeleteVenue(id int, cancel bool) ([]Booking, []Waiting, error) {
+	v, exists := m.VenueDB.Get(id)
+	if !exists {
+		return nil, nil, ErrVenueNotFound
+	}
+	// no bookings are made between looking at them and removing them
+	rdt, open := m.BookingDB.Venue(id)
+	if !open {
+		rdt = &ReserveDT{}
+	}
+	rdt.close(true)
+	waiters := rdt.waiters()
+	for i := range waiters {
+		waiters[i].VenueID = id
+	}
+	now := time.Now()
+	removed, err := m.BookingDB.deleteVenue(id, cancel, now)
+	if err == nil {
+		err = m.VenueDB.Delete(id)
+	}
+	if err != nil {
+		rdt.close(v.Archived)
+		return removed, lost(waiters, rdt.waiters(), now), err
+	}
+	m.BookingDB.mu.Lock()
+	delete(m.BookingDB.VenueReserve, id)
+	m.BookingDB.mu.Unlock()
+	return removed, lost(waiters, nil, now), nil
+}
@@ -0,0 +1,202 @@
+package model
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestVenueUpdate(t *testing.T) {
+	tests := []struct {
+		name   string
+		id     int
+		fn     func(v *Venue)
+		want   error
+		kind   string // kind the venue is found under after
+		byName string // name the venue is found by after
+	}{
+		{"rename", 1, func(v *Venue) { v.Name = "Great Hall" }, nil, "Hall", "Great Hall"},
+		{"new kind", 1, func(v *Venue) { v.Kind = "Studio" }, nil, "Studio", "Hall"},
+		{"name of another venue", 1, func(v *Venue) { v.Name = "Barn" }, ErrVenueExists, "Hall", "Hall"},
+		{"same name", 1, func(v *Venue) { v.Capacity = 20 }, nil, "Hall", "Hall"},
+		{"no such venue", 9, func(v *Venue) {}, ErrVenueNotFound, "Hall", "Hall"},
+	}
+	for _, tt := range tests {
+		m, _, _ := newTestModel(t)
+		if err := m.AddVenue(Venue{Name: "Barn", Kind: "Barn", Location: "South", Capacity: 5}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := m.VenueDB.Update(tt.id, tt.fn); err != tt.want {
+			t.Errorf("%s: Update gave %v, want %v", tt.name, err, tt.want)
+		}
+		if id, _ := m.VenueDB.GetID(tt.byName); id != 1 {
+			t.Errorf("%s: %q is venue %d, want 1", tt.name, tt.byName, id)
+		}
+		_, ids := m.VenueDB.Filter(Query{Location: "Nil", Kind: tt.kind, CapMin: 0, CapMax: 100})
+		if len(ids) != 1 || ids[0] != 1 {
+			t.Errorf("%s: kind %q finds %v, want venue 1 only", tt.name, tt.kind, ids)
+		}
+	}
+}
+
+func TestArchiveVenue(t *testing.T) {
+	m, vid, rdt := newTestModel(t)
+	slots := rdt.ReadAvailable()[len(rdt.Parts()):]
+	if _, err := m.BookingDB.Reserve(vid, slots[0], "ann"); err != nil {
+		t.Fatal(err)
+	}
+	all := Query{Location: "Nil", Kind: "Nil", CapMin: 0, CapMax: 100}
+	steps := []struct {
+		name     string
+		archived bool
+		book     error // of booking the next free slot
+		found    int   // venues the search finds
+	}{
+		{"archived", true, ErrVenueArchived, 0},
+		{"archived twice", true, ErrVenueArchived, 0},
+		{"opened again", false, nil, 1},
+	}
+	for i, tt := range steps {
+		if err := m.ArchiveVenue(vid, tt.archived); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := m.BookingDB.Reserve(vid, slots[i+1], "bob"); err != tt.book {
+			t.Errorf("%s: booking gave %v, want %v", tt.name, err, tt.book)
+		}
+		if _, ids := m.VenueDB.Filter(all); len(ids) != tt.found {
+			t.Errorf("%s: search finds %v, want %d venues", tt.name, ids, tt.found)
+		}
+		if _, exists := m.BookingDB.Get(1); !exists {
+			t.Errorf("%s: booking of the venue gone", tt.name)
+		}
+	}
+	if err := m.ArchiveVenue(9, true); err != ErrVenueNotFound {
+		t.Fatalf("archiving venue 9 gave %v, want ErrVenueNotFound", err)
+	}
+}
+
+func TestDeleteVenue(t *testing.T) {
+	tests := []struct {
+		name    string
+		id      int
+		cancel  bool
+		want    error
+		removed int
+		dropped int
+	}{
+		{"bookings to come", 1, false, ErrVenueHasBookings, 0, 0},
+		{"cancelled", 1, true, nil, 2, 1},
+		{"no such venue", 9, true, ErrVenueNotFound, 0, 0},
+	}
+	for _, tt := range tests {
+		m, vid, rdt := newTestModel(t)
+		slots := rdt.ReadAvailable()[len(rdt.Parts()):]
+		for i, user := range []string{"ann", "bob"} {
+			if _, err := m.BookingDB.Reserve(vid, slots[i], user); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := m.BookingDB.Waitlist(vid, slots[0], "cat", false); err != nil {
+			t.Fatal(err)
+		}
+		removed, dropped, err := m.DeleteVenue(tt.id, tt.cancel)
+		if err != tt.want {
+			t.Errorf("%s: DeleteVenue gave %v, want %v", tt.name, err, tt.want)
+		}
+		if len(removed) != tt.removed || len(dropped) != tt.dropped {
+			t.Errorf("%s: removed %d bookings and %d waiters, want %d and %d", tt.name, len(removed), len(dropped), tt.removed, tt.dropped)
+		}
+		_, exists := m.VenueDB.Get(vid)
+		if exists == (tt.want == nil) {
+			t.Errorf("%s: venue still there %t", tt.name, exists)
+		}
+		if tt.want == nil {
+			if _, open := m.BookingDB.Venue(vid); open {
+				t.Errorf("%s: reservations of the venue left", tt.name)
+			}
+			if _, err := m.BookingDB.Reserve(vid, slots[2], "ann"); err != ErrVenueNotFound {
+				t.Errorf("%s: booking the deleted venue gave %v", tt.name, err)
+			}
+		} else if _, err := m.BookingDB.Reserve(vid, slots[2], "ann"); err != nil {
+			t.Errorf("%s: venue not opened again, booking gave %v", tt.name, err)
+		}
+	}
+}
+
+// failingDeletes : MemStore that deletes the first bookings bookings, then
+// fails to delete bookings or venues
+type failingDeletes struct {
+	*MemStore
+	bookings int
+}
+
+func (s *failingDeletes) DeleteBooking(id int) error {
+	if s.bookings == 0 {
+		return errBroken
+	}
+	s.bookings--
+	return s.MemStore.DeleteBooking(id)
+}
+
+func (s *failingDeletes) DeleteVenue(id int) error {
+	return errBroken
+}
+
+func TestDeleteVenuePartly(t *testing.T) {
+	tests := []struct {
+		name     string
+		bookings int // deletes that work
+		removed  int
+		dropped  int
+	}{
+		{"first booking fails", 0, 0, 0},
+		{"second booking fails", 1, 1, 1},
+		{"venue fails", 2, 2, 1},
+	}
+	for _, tt := range tests {
+		store := NewMemStore()
+		m, err := InitModel(store)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := m.AddVenue(Venue{Name: "Hall", Kind: "Hall", Location: "North", Capacity: 10}); err != nil {
+			t.Fatal(err)
+		}
+		rdt, _ := m.BookingDB.Venue(1)
+		slots := rdt.ReadAvailable()[len(rdt.Parts()):]
+		for i, user := range []string{"ann", "bob"} {
+			if _, err := m.BookingDB.Reserve(1, slots[i], user); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := m.BookingDB.Waitlist(1, slots[0], "cat", false); err != nil {
+			t.Fatal(err)
+		}
+		broken := &failingDeletes{MemStore: store, bookings: tt.bookings}
+		m.BookingDB.store = broken
+		m.VenueDB.store = broken
+
+		removed, dropped, err := m.DeleteVenue(1, true)
+		if !errors.Is(err, errBroken) {
+			t.Fatalf("%s: DeleteVenue gave %v, want the store's error", tt.name, err)
+		}
+		if len(removed) != tt.removed || len(dropped) != tt.dropped {
+			t.Errorf("%s: removed %d bookings and %d waiters, want %d and %d", tt.name, len(removed), len(dropped), tt.removed, tt.dropped)
+		}
+		if _, exists := m.VenueDB.Get(1); !exists {
+			t.Fatalf("%s: venue gone", tt.name)
+		}
+		// what was removed is free, what was not is still held
+		for i, slot := range slots[:2] {
+			err := m.BookingDB.Check(1, slot)
+			if free := err == nil; free != (i < tt.removed) {
+				t.Errorf("%s: slot %d checks as %v after %d removed", tt.name, i, err, tt.removed)
+			}
+		}
+		if err := m.BookingDB.Check(1, slots[2]); err != nil {
+			t.Errorf("%s: venue not opened again, %v", tt.name, err)
+		}
+		if _, stored := store.bookings[2]; stored != (tt.removed < 2) {
+			t.Errorf("%s: second booking stored %t", tt.name, stored)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+//Package notify : channels booking notifications are delivered through
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	mail "gia/mail"
+	model "gia/model"
+	"net/http"
+	"time"
+)
+
+// Email : Channel mailing notifications to the verified email of their user
+type Email struct {
+	Mailer mail.Mailer
+}
+
+//Deliver : mail n to u, who must have a verified email
+func (c Email) Deliver(u model.User, n model.Notification) error {
+	if u.Email == "" || !u.Verified {
+		return fmt.Errorf("%w, %s has no verified email", model.ErrUndeliverable, u.Username)
+	}
+	return c.Mailer.Send(mail.Message{
+		To:      u.Email,
+		Subject: n.Subject,
+		Body:    n.Body,
+	})
+}
+
+// Webhook : Channel posting notifications as json to a url, for other
+// systems to pass on. Any status other than 2xx is a failed delivery
+type Webhook struct {
+	URL    string
+	Client *http.Client
+}
+
+//NewWebhook : webhook posting to url, giving up on a post after timeout
+func NewWebhook(url string, timeout time.Duration) *Webhook {
+	return &Webhook{
+		URL:    url,
+		Client: &http.Client{Timeout: timeout},
+	}
+}
+
+// payload : what is posted for a notification
+type payload struct {
+	ID        int       `json:"id"`
+	Kind      string    `json:"kind"`
+	User      string    `json:"user"`
+	Email     string    `json:"email,omitempty"` // only once verified
+	BookingID int       `json:"bookingId"`
+	Subject   string    `json:"subject"`
+	Body      string    `json:"body"`
+	Created   time.Time `json:"created"`
+}
+
+//Deliver : post n about u. The id lets the receiver drop a notification
+//it already has, a retry may repeat one whose answer was lost
+func (c *Webhook) Deliver(u model.User, n model.Notification) error {
+	p := payload{
+		ID:        n.ID,
+		Kind:      n.Kind,
+		User:      u.Username,
+		BookingID: n.BookingID,
+		Subject:   n.Subject,
+		Body:      n.Body,
+		Created:   n.Created,
+	}
+	if u.Verified {
+		p.Email = u.Email
+	}
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	res, err := c.Client.Post(c.URL, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("webhook answered %s", res.Status)
+	}
+	return nil
+}
+
+// Users : where Inbox keeps notices, model.Model.UserDB
+type Users interface {
+	Update(username string, fn func(u *model.User)) (model.User, error)
+}
+
+// Inbox : Channel adding notifications to the notices a user sees in
+// the app, on their next visit to the view bookings page
+type Inbox struct {
+	Users Users
+}
+
+//Deliver : add the subject of n to the notices of u
+func (c Inbox) Deliver(u model.User, n model.Notification) error {
+	_, err := c.Users.Update(u.Username, func(u *model.User) {
+		u.Notices = append(u.Notices, n.Subject)
+	})
+	if err == model.ErrUserNotFound {
+		return fmt.Errorf("%w, %v", model.ErrUndeliverable, err)
+	}
+	return err
+}
@@ -0,0 +1,75 @@
+//Package thumb : small previews of images, made without cgo
+package thumb
+
+import (
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+)
+
+//Quality : jpeg quality thumbnails are encoded with
+const Quality = 80
+
+//Fit : size of a w by h image scaled down to fit in a max by max square,
+//keeping its shape. Images that already fit keep their size
+func Fit(w int, h int, max int) (int, int) {
+	if w <= max && h <= max {
+		return w, h
+	}
+	if w >= h {
+		return max, imax(1, h*max/w)
+	}
+	return imax(1, w*max/h), max
+}
+
+func imax(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+//Make : src scaled down to fit in a max by max square. Each pixel is the
+//average of the block of src it covers, so fine detail is smoothed rather
+//than dropped, and anything transparent is laid on white as jpeg has no alpha
+func Make(src image.Image, max int) *image.RGBA {
+	b := src.Bounds()
+	sw, sh := b.Dx(), b.Dy()
+	tw, th := Fit(sw, sh, max)
+	dst := image.NewRGBA(image.Rect(0, 0, tw, th))
+	for y := 0; y < th; y++ {
+		y0 := b.Min.Y + y*sh/th
+		y1 := imax(y0+1, b.Min.Y+(y+1)*sh/th)
+		for x := 0; x < tw; x++ {
+			x0 := b.Min.X + x*sw/tw
+			x1 := imax(x0+1, b.Min.X+(x+1)*sw/tw)
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					// premultiplied 16 bit channels
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r += uint64(cr)
+					g += uint64(cg)
+					bl += uint64(cb)
+					a += uint64(ca)
+					n++
+				}
+			}
+			// over white: colour plus what the alpha leaves uncovered
+			white := 0xffff - a/n
+			dst.SetRGBA(x, y, color.RGBA{
+				R: uint8((r/n + white) >> 8),
+				G: uint8((g/n + white) >> 8),
+				B: uint8((bl/n + white) >> 8),
+				A: 0xff,
+			})
+		}
+	}
+	return dst
+}
+
+//Encode : write img to w as a jpeg
+func Encode(w io.Writer, img image.Image) error {
+	return jpeg.Encode(w, img, &jpeg.Options{Quality: Quality})
+}
@@ -0,0 +1,61 @@
+package thumb
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+)
+
+func TestFit(t *testing.T) {
+	tests := []struct {
+		w, h, max int
+		tw, th    int
+	}{
+		{100, 50, 320, 100, 50},
+		{320, 320, 320, 320, 320},
+		{1280, 640, 320, 320, 160},
+		{640, 1280, 320, 160, 320},
+		{10000, 1, 320, 320, 1},
+		{1, 10000, 320, 1, 320},
+	}
+	for _, tt := range tests {
+		if tw, th := Fit(tt.w, tt.h, tt.max); tw != tt.tw || th != tt.th {
+			t.Errorf("Fit(%d, %d, %d) = %d, %d, want %d, %d", tt.w, tt.h, tt.max, tw, th, tt.tw, tt.th)
+		}
+	}
+}
+
+func TestMake(t *testing.T) {
+	tests := []struct {
+		name string
+		fill color.Color
+		want color.RGBA
+	}{
+		{"opaque", color.RGBA{R: 200, G: 100, B: 50, A: 255}, color.RGBA{R: 200, G: 100, B: 50, A: 255}},
+		{"transparent is laid on white", color.RGBA{}, color.RGBA{R: 255, G: 255, B: 255, A: 255}},
+	}
+	for _, tt := range tests {
+		src := image.NewRGBA(image.Rect(0, 0, 64, 32))
+		for y := 0; y < 32; y++ {
+			for x := 0; x < 64; x++ {
+				src.Set(x, y, tt.fill)
+			}
+		}
+		dst := Make(src, 16)
+		if b := dst.Bounds(); b.Dx() != 16 || b.Dy() != 8 {
+			t.Errorf("%s: thumbnail is %v, want 16x8", tt.name, b)
+		}
+		if got := dst.RGBAAt(3, 3); got != tt.want {
+			t.Errorf("%s: pixel %v, want %v", tt.name, got, tt.want)
+		}
+		var b bytes.Buffer
+		if err := Encode(&b, dst); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if _, err := jpeg.Decode(&b); err != nil {
+			t.Errorf("%s: thumbnail does not decode, %v", tt.name, err)
+		}
+	}
+}